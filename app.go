@@ -1,27 +1,63 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 
+	"github.com/ekrishgupta/Hush/internal/blobstore"
+	"github.com/ekrishgupta/Hush/internal/block"
 	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/config"
+	"github.com/ekrishgupta/Hush/internal/groupkey"
+	"github.com/ekrishgupta/Hush/internal/invite"
+	"github.com/ekrishgupta/Hush/internal/moderation"
 	"github.com/ekrishgupta/Hush/internal/network"
+	"github.com/ekrishgupta/Hush/internal/rooms"
+	"github.com/ekrishgupta/Hush/internal/theme"
+	"github.com/ekrishgupta/Hush/internal/transfer"
+	"github.com/ekrishgupta/Hush/internal/trust"
 )
 
+// maxOffers is how many file offers App remembers for AcceptFile and
+// SaveAttachment. The least recently offered are forgotten first.
+const maxOffers = 1000
+
 // App struct
 type App struct {
 	ctx      context.Context
 	chat     *chat.Chat
+	files    *transfer.Service
+	trust    *trust.Store
+	blocks   *block.List
+	invites  *invite.Service
+	mod      *moderation.Room
+	keys     *groupkey.Keys
+	rooms    *rooms.Manager
+	cfg      *config.Config
 	username string
+
+	mu         sync.Mutex
+	offers     map[string]chat.ChatMessage // file offers seen or made, by attachment hash
+	offerOrder []string                    // hashes in offers, oldest first
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
 	return &App{
 		username: fmt.Sprintf("Ghost-%d", time.Now().Unix()%1000),
+		offers:   make(map[string]chat.ChatMessage),
 	}
 }
 
@@ -30,57 +66,556 @@ func NewApp() *App {
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
+	// Load settings, including who is muted and blocked
+	cfg, err := config.Load()
+	if err != nil {
+		runtime.LogErrorf(ctx, "Failed to load config: %v", err)
+		return
+	}
+	a.cfg = cfg
+	a.blocks = block.New(cfg)
+
 	// Initialize libp2p host
-	h, err := network.NewHost()
+	h, err := network.NewHost(network.DesktopIdentity, libp2p.ConnectionGater(a.blocks))
 	if err != nil {
 		runtime.LogErrorf(ctx, "Failed to create host: %v", err)
 		return
 	}
+	a.blocks.SetNetwork(h.Network())
 
-	// Setup mDNS discovery
+	// Issue and redeem invites
+	invitePath, err := invite.DefaultPath()
+	if err == nil {
+		a.invites, err = invite.NewService(h, invitePath)
+	}
+	if err != nil {
+		runtime.LogErrorf(ctx, "Failed to set up invites: %v", err)
+		return
+	}
+
+	// Setup mDNS discovery, and dial peers we were pointed at
 	if err := network.SetupDiscovery(h); err != nil {
 		runtime.LogErrorf(ctx, "Failed to setup discovery: %v", err)
 		return
 	}
+	network.Bootstrap(ctx, h, cfg.Bootstrap)
 
-	// Setup GossipSub
-	topic, sub, err := network.SetupPubSub(ctx, h)
+	// Setup GossipSub, scoring down peers whose traffic we have to drop
+	limiter := chat.NewLimiter(chat.DefaultReceiveRate, chat.DefaultReceiveBurst)
+	ps, err := network.NewPubSub(ctx, h,
+		pubsub.WithBlacklist(a.blocks),
+		network.PeerScore(limiter.Score),
+	)
 	if err != nil {
 		runtime.LogErrorf(ctx, "Failed to setup pubsub: %v", err)
 		return
 	}
 
-	a.chat = chat.NewChat(topic, sub, h.ID())
+	store, err := blobstore.Open(blobstore.DefaultDir(), blobstore.DefaultMaxBytes)
+	if err != nil {
+		runtime.LogErrorf(ctx, "Failed to open attachment cache: %v", err)
+		return
+	}
+	a.files = transfer.NewService(h, store, transfer.DefaultDir(), transfer.WithBlocked(a.blocks.Contains))
+
+	// Remember which key each name uses and warn about impersonation
+	trustPath, err := trust.DefaultPath()
+	if err == nil {
+		a.trust, err = trust.Open(trustPath)
+	}
+	if err != nil {
+		runtime.LogErrorf(ctx, "Failed to open trust store: %v", err)
+		return
+	}
 
-	// Start listening for messages and pipe them to frontend events
+	// Join the room, enforcing its kicks and bans if it has an owner.
+	// Owned rooms are encrypted, with keys rotated as members leave.
+	modPath, err := moderation.DefaultPath()
+	if err != nil {
+		runtime.LogErrorf(ctx, "Failed to open moderation log: %v", err)
+		return
+	}
+	joined := rooms.New(h, ps, cfg, rooms.Services{
+		Limiter: limiter,
+		Scored:  true,
+		Files:   a.files,
+		Trust:   a.trust,
+		ModPath: modPath,
+	})
+	joined.SetName(a.username)
+	a.invites.SetAdmit(joined.Admit)
+	room, err := joined.Join(ctx, cmp.Or(cfg.Room, network.TopicName))
+	if room == nil {
+		runtime.LogErrorf(ctx, "Failed to join room: %v", err)
+		return
+	}
+	a.rooms = joined
+	a.chat, a.mod, a.keys = room.Chat, room.Mod, room.Keys
+
+	go func() {
+		for alert := range room.Alerts {
+			runtime.EventsEmit(ctx, "trust_alert", alert.String())
+		}
+	}()
+
+	// Tell the frontend about new moderators, bans and topics
+	go func() {
+		for {
+			select {
+			case <-a.mod.Changes():
+				runtime.EventsEmit(ctx, "room_state", a.GetRoomState())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Pipe messages to frontend events
 	go func() {
-		for msg := range a.chat.ListenForMessages(ctx) {
-			runtime.EventsEmit(ctx, "new_message", msg)
+		for ev := range room.Events() {
+			if a.blocks.Muted(ev.From) {
+				continue
+			}
+			if ev.Message.Attachment != nil {
+				a.rememberOffer(ev.Message)
+			}
+			runtime.EventsEmit(ctx, "new_message", ev.Message)
+			if ev.Message.Mentioned(room.Chat.Self()) {
+				runtime.EventsEmit(ctx, "mention", ev.Message)
+			}
+		}
+	}()
+
+	// Forward file transfer progress
+	go func() {
+		for {
+			select {
+			case p := <-a.files.Updates():
+				runtime.EventsEmit(ctx, "file_progress", p)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Surface undecodable traffic instead of dropping it silently
+	go func() {
+		for {
+			select {
+			case err := <-a.chat.Errors():
+				runtime.LogWarningf(ctx, "Dropped incoming message: %v", err)
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
 	runtime.LogInfo(ctx, "App started successfully, listening for messages...")
 }
 
-// SendMessage publishes a message to the network
-func (a *App) SendMessage(text string) {
+// SendMessage publishes a message to the network. The returned error
+// (e.g. chat.ErrMessageTooLarge) rejects the promise on the frontend.
+func (a *App) SendMessage(text string) error {
 	if a.chat == nil {
-		return
+		return errors.New("not connected to the network yet")
 	}
 
-	if err := a.chat.Publish(a.username, text); err != nil {
+	msg, err := a.chat.Publish(a.username, text)
+	if err != nil {
 		runtime.LogErrorf(a.ctx, "Failed to publish message: %v", err)
-		return
+		return err
 	}
 
 	// Emit back to UI immediately (as a "self" message)
-	msg := chat.NewChatMessage(a.username, text)
 	runtime.EventsEmit(a.ctx, "new_message", msg)
+	return nil
+}
+
+// SendFile offers the file at path to the room.
+func (a *App) SendFile(path string) error {
+	if a.chat == nil {
+		return errors.New("not connected to the network yet")
+	}
+
+	att, err := a.files.Share(a.chat, path)
+	if err != nil {
+		return err
+	}
+	return a.offer(att)
+}
+
+// SendFileData offers in-memory content, e.g. an image pasted from the
+// clipboard, to the room. data is base64 encoded.
+func (a *App) SendFileData(name, data string) error {
+	if a.chat == nil {
+		return errors.New("not connected to the network yet")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("decoding pasted data: %w", err)
+	}
+	att, err := a.files.ShareData(a.chat, name, raw)
+	if err != nil {
+		return err
+	}
+	return a.offer(att)
+}
+
+func (a *App) offer(att chat.Attachment) error {
+	msg, err := a.chat.PublishAttachment(a.username, att)
+	if err != nil {
+		return err
+	}
+	a.rememberOffer(msg)
+
+	runtime.EventsEmit(a.ctx, "new_message", msg)
+	return nil
+}
+
+// rememberOffer records msg's attachment for AcceptFile and
+// SaveAttachment, forgetting the oldest offer past maxOffers.
+func (a *App) rememberOffer(msg chat.ChatMessage) {
+	hash := msg.Attachment.Hash
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if i := slices.Index(a.offerOrder, hash); i >= 0 {
+		a.offerOrder = slices.Delete(a.offerOrder, i, i+1)
+	}
+	a.offerOrder = append(a.offerOrder, hash)
+	a.offers[hash] = msg
+	if len(a.offerOrder) > maxOffers {
+		delete(a.offers, a.offerOrder[0])
+		a.offerOrder = slices.Delete(a.offerOrder, 0, 1)
+	}
+}
+
+// SaveAttachment asks where to save a file we already have (downloaded
+// or shared by us) and copies it there. It returns the chosen path, or
+// "" if the dialog was cancelled.
+func (a *App) SaveAttachment(hash string) (string, error) {
+	a.mu.Lock()
+	offer, ok := a.offers[hash]
+	a.mu.Unlock()
+	if !ok {
+		return "", errors.New("no such file offer")
+	}
+
+	dst, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:                "Save attachment",
+		DefaultFilename:      offer.Attachment.Name,
+		CanCreateDirectories: true,
+	})
+	if err != nil || dst == "" {
+		return "", err
+	}
+	if err := a.files.SaveAs(hash, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// AcceptFile starts downloading an offered file. Progress arrives as
+// "file_progress" events.
+func (a *App) AcceptFile(hash string) error {
+	a.mu.Lock()
+	offer, ok := a.offers[hash]
+	a.mu.Unlock()
+	if !ok {
+		return errors.New("no such file offer")
+	}
+
+	a.files.Download(a.ctx, a.chat, offer.From, *offer.Attachment)
+	return nil
+}
+
+// VerifyPeer returns the safety number and words to compare with the
+// peer currently using name. Given the key those were shown for, it
+// marks them verified instead, unless someone else has taken the name.
+func (a *App) VerifyPeer(name, key string) (string, error) {
+	if a.trust == nil {
+		return "", errors.New("not connected to the network yet")
+	}
+
+	if key != "" {
+		rec, err := a.trust.Confirm(name, key)
+		switch {
+		case errors.Is(err, trust.ErrUnknownPeer):
+			return "", fmt.Errorf("nobody called %q has been seen", name)
+		case errors.Is(err, trust.ErrKeyChanged):
+			return "", fmt.Errorf("%s is now using key …%s, not …%s — run /verify %s again", rec.Name, trust.ShortID(rec.ID), key, rec.Name)
+		case err != nil:
+			return "", err
+		}
+		return fmt.Sprintf("✓ %s is verified", rec.Name), nil
+	}
+
+	recs := a.trust.Lookup(name)
+	if len(recs) == 0 {
+		return "", fmt.Errorf("nobody called %q has been seen", name)
+	}
+	rec := recs[0]
+
+	number, err := trust.SafetyNumber(a.chat.Self(), rec.ID)
+	if err != nil {
+		return "", err
+	}
+	words, err := trust.Words(a.chat.Self(), rec.ID)
+	if err != nil {
+		return "", err
+	}
+	status := "not verified"
+	if rec.Verified {
+		status = "verified " + rec.VerifiedAt.Format("Jan 2 2006")
+	}
+	return fmt.Sprintf("%s · key …%s · first seen %s · %s\n\nSafety number\n%s\n\nWords\n%s\n\nCompare these with %s in person or over a call. If they match: /verify %s confirm %s",
+		rec.Name, trust.ShortID(rec.ID), rec.FirstSeen.Format("Jan 2 2006 15:04"), status,
+		number, strings.Join(words, " "), rec.Name, rec.Name, trust.ShortID(rec.ID)), nil
+}
+
+// MutePeer hides messages from the peer using name. It returns their
+// peer ID so the frontend can hide what they already said.
+func (a *App) MutePeer(name string) (string, error) {
+	return a.setBlocked(name, false, (*block.List).Mute)
+}
+
+// BlockPeer drops the peer using name at the gossip layer and refuses
+// their connections. It returns their peer ID.
+func (a *App) BlockPeer(name string) (string, error) {
+	return a.setBlocked(name, false, (*block.List).Block)
+}
+
+// UnmutePeer undoes MutePeer.
+func (a *App) UnmutePeer(name string) (string, error) {
+	return a.setBlocked(name, true, func(l *block.List, id peer.ID, _ string) error { return l.Unmute(id) })
+}
+
+// UnblockPeer undoes BlockPeer.
+func (a *App) UnblockPeer(name string) (string, error) {
+	return a.setBlocked(name, true, func(l *block.List, id peer.ID, _ string) error { return l.Unblock(id) })
+}
+
+// ListBlocked returns everyone muted or blocked.
+func (a *App) ListBlocked() []block.Entry {
+	if a.blocks == nil {
+		return nil
+	}
+	return a.blocks.Entries()
+}
+
+// setBlocked applies a change to the peer behind who. Undoing one
+// prefers the key already on the list, as the name may have moved on.
+func (a *App) setBlocked(who string, listed bool, apply func(*block.List, peer.ID, string) error) (string, error) {
+	if a.blocks == nil {
+		return "", errors.New("not connected to the network yet")
+	}
+
+	id, name, ok := a.blocks.Find(who)
+	if !(listed && ok) && a.trust != nil {
+		if recs := a.trust.Lookup(who); len(recs) > 0 {
+			id, name, ok = recs[0].ID, recs[0].Name, true
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("nobody called %q has been seen", who)
+	}
+	if err := apply(a.blocks, id, name); err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// InviteCode is an invite ready to show.
+type InviteCode struct {
+	Code    string `json:"code"`
+	Summary string `json:"summary"` // e.g. "#design · expires Jan 2 15:04 · single use"
+	QR      string `json:"qr"`      // base64 PNG
+}
+
+// CreateInvite makes an invite code for this room. ttl is a duration
+// such as "2h", or "never"; empty means a day.
+func (a *App) CreateInvite(once bool, ttl string) (InviteCode, error) {
+	if a.invites == nil || a.chat == nil {
+		return InviteCode{}, errors.New("not connected to the network yet")
+	}
+
+	opts := invite.Options{TTL: 24 * time.Hour, Once: once}
+	opts.Admit = a.mod != nil && a.mod.CanAdmit(a.chat.Self())
+	switch ttl {
+	case "":
+	case "never":
+		opts.TTL = 0
+	default:
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return InviteCode{}, fmt.Errorf("invalid expiry %q, try 2h or never", ttl)
+		}
+		opts.TTL = d
+	}
+
+	code, err := a.invites.Create(a.chat.Room(), opts)
+	if err != nil {
+		return InviteCode{}, err
+	}
+	inv, err := invite.Parse(code)
+	if err != nil {
+		return InviteCode{}, err
+	}
+	png, err := invite.QRImage(code, 256)
+	if err != nil {
+		return InviteCode{}, err
+	}
+	return InviteCode{
+		Code:    code,
+		Summary: inv.Describe(),
+		QR:      base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// JoinInvite applies an invite code: it redeems single-use and admitting
+// codes with their issuer, dials the issuer and makes the invite's room
+// the one we join. Rooms are joined at startup, so moving to a different room takes
+// a restart; the returned text says so.
+func (a *App) JoinInvite(code string) (string, error) {
+	if a.invites == nil || a.chat == nil {
+		return "", errors.New("not connected to the network yet")
+	}
+	inv, err := invite.Parse(code)
+	if err != nil {
+		return "", err
+	}
+	if err := a.invites.Join(a.ctx, inv); err != nil {
+		return "", err
+	}
+	if err := a.cfg.Update(inv.Apply); err != nil {
+		return "", err
+	}
+
+	name := moderation.DisplayName(inv.Room)
+	if inv.Room == a.chat.Room() {
+		return fmt.Sprintf("✓ joined #%s", name), nil
+	}
+	return fmt.Sprintf("✓ invite saved, restart Hush to move to #%s", name), nil
+}
+
+// RoomState describes the room and its moderation for the frontend.
+type RoomState struct {
+	Room       string   `json:"room"` // without the owner suffix
+	Topic      string   `json:"topic"`
+	Owned      bool     `json:"owned"`
+	Owner      string   `json:"owner"`
+	Moderators []string `json:"moderators"`
+	Members    []string `json:"members"` // admitted, besides the owner and moderators
+	Banned     []string `json:"banned"`  // kicked or banned peer IDs
+}
+
+// GetRoomState returns the room's name, topic, moderators, members and
+// bans.
+// Changes arrive as "room_state" events.
+func (a *App) GetRoomState() RoomState {
+	if a.mod == nil || a.chat == nil {
+		return RoomState{}
+	}
+	st := a.mod.State()
+	rs := RoomState{
+		Room:       moderation.DisplayName(st.Room),
+		Topic:      st.Topic,
+		Owned:      a.mod.Owned(),
+		Owner:      st.Owner.String(),
+		Moderators: []string{},
+		Members:    []string{},
+		Banned:     []string{},
+	}
+	for _, id := range st.Moderators {
+		rs.Moderators = append(rs.Moderators, id.String())
+	}
+	for _, id := range st.Members {
+		rs.Members = append(rs.Members, id.String())
+	}
+	for _, s := range st.Sanctions {
+		rs.Banned = append(rs.Banned, s.ID.String())
+	}
+	return rs
+}
+
+// Moderate runs a moderation action against the peer using name:
+// "kick" (for duration, e.g. "30m"; empty means the default), "ban",
+// "unban", "op", "deop", "admit" or "remove". It returns a confirmation
+// to show.
+func (a *App) Moderate(action, name, duration string) (string, error) {
+	if a.mod == nil || a.trust == nil {
+		return "", errors.New("not connected to the network yet")
+	}
+	recs := a.trust.Lookup(name)
+	if len(recs) == 0 {
+		return "", fmt.Errorf("nobody called %q has been seen", name)
+	}
+	id, name := recs[0].ID, recs[0].Name
+
+	var (
+		err  error
+		done string
+	)
+	switch action {
+	case "kick":
+		d := moderation.DefaultKick
+		if duration != "" {
+			if d, err = time.ParseDuration(duration); err != nil || d <= 0 {
+				return "", fmt.Errorf("invalid duration %q, try 30m", duration)
+			}
+		}
+		err, done = a.mod.Kick(id, d), fmt.Sprintf("✓ kicked %s for %s", name, d)
+	case "ban":
+		err, done = a.mod.Ban(id), "✓ banned "+name
+	case "unban":
+		err, done = a.mod.Unban(id), "✓ unbanned "+name
+	case "op":
+		err, done = a.mod.Grant(id), fmt.Sprintf("✓ %s is now a moderator", name)
+	case "deop":
+		err, done = a.mod.Revoke(id), fmt.Sprintf("✓ %s is no longer a moderator", name)
+	case "admit":
+		err, done = a.mod.Admit(id), fmt.Sprintf("✓ %s is now a member", name)
+	case "remove":
+		err, done = a.mod.Remove(id), fmt.Sprintf("✓ %s is no longer a member", name)
+	default:
+		return "", fmt.Errorf("unknown moderation action %q", action)
+	}
+	if err != nil {
+		return "", err
+	}
+	return done, nil
+}
+
+// SetTopic sets the room topic; empty clears it.
+func (a *App) SetTopic(topic string) error {
+	if a.mod == nil {
+		return errors.New("not connected to the network yet")
+	}
+	return a.mod.SetTopic(topic)
+}
+
+// CreateRoom makes a new room owned by us, which we can moderate, and
+// makes it the one we join. Like JoinInvite, it takes a restart.
+func (a *App) CreateRoom(name string) (string, error) {
+	if a.chat == nil {
+		return "", errors.New("not connected to the network yet")
+	}
+	room, err := moderation.OwnedRoom(name, a.chat.Self())
+	if err != nil {
+		return "", err
+	}
+	if err := a.cfg.Update(func(cfg *config.Config) { cfg.Room = room }); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("✓ created #%s, restart Hush to move there, then /invite people", name), nil
 }
 
 // SetUsername updates the current user's name
 func (a *App) SetUsername(name string) {
 	a.username = name
+	if a.rooms != nil {
+		a.rooms.SetName(name)
+	}
 }
 
 // GetUsername returns the current user's name
@@ -88,6 +623,60 @@ func (a *App) GetUsername() string {
 	return a.username
 }
 
+// GetPeerID returns our own peer ID, which tells our messages apart
+// from those of anyone using the same name.
+func (a *App) GetPeerID() string {
+	if a.chat == nil {
+		return ""
+	}
+	return a.chat.Self().String()
+}
+
+// GetKeyEpoch returns the epoch of the key we encrypt the room with,
+// or 0 if the room isn't encrypted.
+func (a *App) GetKeyEpoch() int {
+	if a.keys == nil {
+		return 0
+	}
+	return int(a.keys.Epoch())
+}
+
+// ThemeColors is a color theme as CSS custom properties.
+type ThemeColors struct {
+	Name string            `json:"name"`
+	Vars map[string]string `json:"vars"` // e.g. "--ghost-purple": "#B388FF"
+}
+
+// GetTheme returns the color theme picked with the TUI's /theme, dark
+// if none was, for the frontend to set on :root.
+func (a *App) GetTheme() (ThemeColors, error) {
+	name := theme.Default
+	if a.cfg != nil && a.cfg.Theme != "" {
+		name = a.cfg.Theme
+	}
+	t, err := theme.Load(name)
+	if err != nil {
+		return ThemeColors{}, err
+	}
+	return ThemeColors{Name: t.Name, Vars: t.CSS()}, nil
+}
+
+// GetPeerNames returns the names of the peers in the room, sorted, for
+// completing @mentions.
+func (a *App) GetPeerNames() []string {
+	names := []string{}
+	if a.chat == nil {
+		return names
+	}
+	for _, id := range a.chat.Peers() {
+		if name, ok := a.chat.PeerName(id); ok && name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.SortFunc(names, func(x, y string) int { return strings.Compare(strings.ToLower(x), strings.ToLower(y)) })
+	return names
+}
+
 // GetPeerCount returns the number of active peers
 func (a *App) GetPeerCount() int {
 	if a.chat == nil {
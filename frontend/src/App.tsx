@@ -1,16 +1,67 @@
 import { useState, useEffect, useRef } from 'react';
 
 // Wails bindings
-import { SendMessage, GetUsername, GetPeerCount, SetUsername } from '../wailsjs/go/main/App';
-import { EventsOn, EventsOff } from '../wailsjs/runtime/runtime';
-import MarkdownMessage from './components/MarkdownMessage';
+import { SendMessage, GetUsername, GetPeerCount, SetUsername, SendFile, SendFileData, AcceptFile, SaveAttachment, VerifyPeer, MutePeer, UnmutePeer, BlockPeer, UnblockPeer, ListBlocked, CreateInvite, JoinInvite, GetRoomState, Moderate, SetTopic, CreateRoom, GetKeyEpoch, GetTheme, GetPeerNames, GetPeerID } from '../wailsjs/go/main/App';
+import { main } from '../wailsjs/go/models';
+import { EventsOn, EventsOff, OnFileDrop, OnFileDropOff } from '../wailsjs/runtime/runtime';
+import MarkdownMessage, { Attachment } from './components/MarkdownMessage';
+
+interface HLC {
+    wall: number;
+    logical: number;
+}
+
+interface FileProgress {
+    hash: string;
+    name: string;
+    received: number;
+    size: number;
+    done: boolean;
+    path?: string;
+    error?: string;
+}
 
 interface ChatMessage {
+    id?: string;
     sender: string;
     content: string;
     timestamp: number;
+    hlc?: HLC;
+    skewed?: boolean;
+    pending?: boolean;
+    hidden?: number; // placeholder for messages dropped from a flooding peer
+    attachment?: Attachment;
+    from?: string;
+    mentions?: { peer: string; name: string }[];
 }
 
+// Ordering key in milliseconds, falling back to the legacy seconds field
+const stampOf = (m: ChatMessage): HLC =>
+    m.hlc && m.hlc.wall ? m.hlc : { wall: m.timestamp * 1000, logical: 0 };
+
+const isBefore = (a: ChatMessage, b: ChatMessage) => {
+    const sa = stampOf(a), sb = stampOf(b);
+    if (sa.wall !== sb.wall) return sa.wall < sb.wall;
+    if (sa.logical !== sb.logical) return sa.logical < sb.logical;
+    return (a.id || '') < (b.id || '');
+};
+
+// Insert a message at its causal position. A known ID only replaces our
+// own queued entry once it has been delivered, or a flood placeholder
+// whose count has grown; any other repeat is dropped, so a peer can't
+// overwrite a message by reusing its ID.
+const insertMessage = (prev: ChatMessage[], msg: ChatMessage): ChatMessage[] => {
+    const known = msg.id ? prev.find((m) => m.id === msg.id) : undefined;
+    if (known) {
+        if (!known.from || known.from !== msg.from) return prev;
+        if (msg.hidden ? !known.hidden : !known.pending) return prev;
+        return prev.map((m) => (m === known ? msg : m));
+    }
+    let i = prev.length;
+    while (i > 0 && isBefore(msg, prev[i - 1])) i--;
+    return [...prev.slice(0, i), msg, ...prev.slice(i)];
+};
+
 // ──────────────────────────────────────────────────
 //  ASCII Art (large "HUSH" banner)
 // ──────────────────────────────────────────────────
@@ -26,8 +77,10 @@ const HUSH_ASCII = `
 // ──────────────────────────────────────────────────
 //  Welcome Screen
 // ──────────────────────────────────────────────────
-function WelcomeScreen({ onEnter }: { onEnter: (name: string) => void }) {
+function WelcomeScreen({ onEnter }: { onEnter: (name: string, notice?: string) => void }) {
     const [name, setName] = useState('');
+    const [code, setCode] = useState('');
+    const [error, setError] = useState('');
     const inputRef = useRef<HTMLInputElement>(null);
 
     useEffect(() => {
@@ -41,7 +94,14 @@ function WelcomeScreen({ onEnter }: { onEnter: (name: string) => void }) {
             const randomId = Math.floor(Math.random() * 900) + 100;
             trimmed = `Ghost-${randomId}`;
         }
-        onEnter(trimmed);
+        // An invite code, if pasted, is applied before entering
+        if (!code.trim()) {
+            onEnter(trimmed);
+            return;
+        }
+        JoinInvite(code)
+            .then((notice) => onEnter(trimmed, notice))
+            .catch((err) => setError(`⚠ ${err}`));
     };
 
     const handleKeyDown = (e: React.KeyboardEvent) => {
@@ -132,16 +192,55 @@ function WelcomeScreen({ onEnter }: { onEnter: (name: string) => void }) {
                 />
             </div>
 
-            {/* Hint */}
+            {/* Invite code paste box */}
             <div
                 style={{
-                    color: 'var(--dim-gray)',
+                    border: '1px solid var(--dim-gray)',
+                    borderRadius: '6px',
+                    padding: '6px 12px',
+                    display: 'flex',
+                    alignItems: 'center',
+                    width: '280px',
+                    marginTop: '8px',
+                    WebkitAppRegion: 'no-drag',
+                } as any}
+            >
+                <span style={{ color: 'var(--dim-gray)', marginRight: '8px', userSelect: 'none' }}>{'#'}</span>
+                <input
+                    type="text"
+                    value={code}
+                    onChange={(e) => {
+                        setCode(e.target.value);
+                        setError('');
+                    }}
+                    onKeyDown={handleKeyDown}
+                    placeholder="invite code (optional)"
+                    spellCheck={false}
+                    style={{
+                        width: '100%',
+                        background: 'transparent',
+                        border: 'none',
+                        outline: 'none',
+                        color: 'var(--warm-white)',
+                        fontFamily: "'Menlo', 'Monaco', 'Courier New', monospace",
+                        fontSize: '14px',
+                        caretColor: 'var(--warm-white)',
+                    }}
+                />
+            </div>
+
+            {/* Hint, or why the invite didn't work */}
+            <div
+                style={{
+                    color: error ? 'var(--warning-red)' : 'var(--dim-gray)',
                     fontSize: '11px',
                     marginTop: '12px',
                     userSelect: 'none',
+                    maxWidth: '306px',
+                    textAlign: 'center',
                 }}
             >
-                press enter to join
+                {error || 'press enter to join'}
             </div>
         </div>
     );
@@ -150,15 +249,90 @@ function WelcomeScreen({ onEnter }: { onEnter: (name: string) => void }) {
 // ──────────────────────────────────────────────────
 //  Message Item Component
 // ──────────────────────────────────────────────────
-function MessageItem({ msg, username, formatTime, isSelected, isExpanded, onToggle }: {
+// ──────────────────────────────────────────────────
+//  Attachment status (download link / progress)
+// ──────────────────────────────────────────────────
+function AttachmentStatus({ attachment, isMe, progress, onError }: {
+    attachment: Attachment,
+    isMe: boolean,
+    progress?: FileProgress,
+    onError: (err: unknown) => void,
+}) {
+    const dim = { color: 'var(--dim-gray)', marginLeft: '8px', whiteSpace: 'nowrap' as const };
+    const action = { ...dim, color: 'var(--ghost-purple)', cursor: 'pointer' };
+
+    // Files we hold can be copied anywhere through the native save dialog
+    const saveAs = (
+        <span
+            style={action}
+            onClick={(e) => {
+                e.stopPropagation();
+                SaveAttachment(attachment.hash).catch(onError);
+            }}
+        >
+            [save as…]
+        </span>
+    );
+
+    if (isMe) return <span style={dim}>· shared {saveAs}</span>;
+    if (progress?.done && progress.error) {
+        return <span style={{ ...dim, color: 'var(--warning-red)' }}>· ✗ {progress.error}</span>;
+    }
+    if (progress?.done) return <span style={dim}>· ✓ saved to {progress.path} {saveAs}</span>;
+    if (progress) {
+        const pct = progress.size > 0 ? Math.floor((progress.received * 100) / progress.size) : 0;
+        return <span style={dim}>· ⇣ {pct}%</span>;
+    }
+    return (
+        <span
+            style={action}
+            onClick={(e) => {
+                e.stopPropagation();
+                AcceptFile(attachment.hash);
+            }}
+        >
+            · [download]
+        </span>
+    );
+}
+
+function MessageItem({ msg, self, badge, formatTime, isSelected, isMention, isExpanded, onToggle, progress, onError }: {
     msg: ChatMessage,
-    username: string,
-    formatTime: (ts: number) => string,
+    self: string, // our peer ID
+    badge?: string, // ~ for the room's owner, @ for moderators
+    formatTime: (msg: ChatMessage) => string,
     isSelected: boolean,
+    isMention: boolean, // mentions us
     isExpanded: boolean,
-    onToggle: () => void
+    onToggle: () => void,
+    progress?: FileProgress,
+    onError: (err: unknown) => void,
 }) {
-    const isMe = msg.sender === username;
+    // Only our peer ID counts, since anyone can pick our name
+    const isMe = !!msg.from && msg.from === self;
+    const attachment = msg.attachment && (
+        <AttachmentStatus attachment={msg.attachment} isMe={isMe} progress={progress} onError={onError} />
+    );
+    const role = badge && <span style={{ color: 'var(--ghost-purple)', fontWeight: 'bold' }}>{badge}</span>;
+
+    // A flooding peer's messages collapse into one dim line, never markdown
+    if (msg.hidden) {
+        return (
+            <div
+                style={{
+                    display: 'flex',
+                    justifyContent: 'space-between',
+                    padding: '2px 8px 2px 20px',
+                    color: 'var(--dim-gray)',
+                    fontStyle: 'italic',
+                    whiteSpace: 'nowrap',
+                }}
+            >
+                <span style={{ overflow: 'hidden', textOverflow: 'ellipsis' }}>⋯ {msg.content}</span>
+                <span style={{ marginLeft: '16px' }}>{formatTime(msg)}</span>
+            </div>
+        );
+    }
 
     return (
         <div
@@ -170,18 +344,18 @@ function MessageItem({ msg, username, formatTime, isSelected, isExpanded, onTogg
                 position: 'relative',
             }}
         >
-            {/* Selection Indicator */}
-            {isSelected && (
+            {/* Selection Indicator, or @ for messages that mention us */}
+            {(isSelected || isMention) && (
                 <div style={{
                     position: 'absolute',
                     left: '0',
                     top: '2px', // Align with first line
-                    color: 'var(--ghost-pink)',
+                    color: isSelected ? 'var(--ghost-pink)' : 'var(--warning-red)',
                     fontWeight: 'bold',
                     fontSize: '14px',
                     lineHeight: '1.4',
                 }}>
-                    {'>'}
+                    {isSelected ? '>' : '@'}
                 </div>
             )}
 
@@ -195,7 +369,7 @@ function MessageItem({ msg, username, formatTime, isSelected, isExpanded, onTogg
                                 fontWeight: 'bold',
                                 whiteSpace: 'nowrap',
                             }}>
-                                {isMe ? 'you' : msg.sender}
+                                {role}{isMe ? 'you' : msg.sender}
                             </span>
                             <span style={{ color: 'var(--warm-white)' }}>: </span>
                             <div style={{
@@ -208,6 +382,7 @@ function MessageItem({ msg, username, formatTime, isSelected, isExpanded, onTogg
                             }}>
                                 <MarkdownMessage content={msg.content} compact />
                             </div>
+                            {attachment}
                             {/* Manual ellipsis - highlighted when arrowed/selected */}
                             <span style={{
                                 color: isSelected ? 'var(--ghost-pink)' : 'var(--dim-gray)',
@@ -217,7 +392,7 @@ function MessageItem({ msg, username, formatTime, isSelected, isExpanded, onTogg
                             }}>(...)</span>
                         </div>
                         <span style={{ color: 'var(--dim-gray)', flexShrink: 0, marginLeft: '16px' }}>
-                            {formatTime(msg.timestamp)}
+                            {formatTime(msg)}
                         </span>
                     </div>
                 ) : (
@@ -235,7 +410,7 @@ function MessageItem({ msg, username, formatTime, isSelected, isExpanded, onTogg
                             whiteSpace: 'nowrap',
                             lineHeight: '1.4',
                         }}>
-                            {isMe ? 'you' : msg.sender}:
+                            {role}{isMe ? 'you' : msg.sender}:
                         </div>
 
                         {/* Content Block */}
@@ -257,9 +432,9 @@ function MessageItem({ msg, username, formatTime, isSelected, isExpanded, onTogg
                                 fontSize: '14px', // Match main message font size
                                 userSelect: 'none',
                             }}>
-                                {formatTime(msg.timestamp)}
+                                {formatTime(msg)}
                             </span>
-                            <MarkdownMessage content={msg.content} />
+                            <MarkdownMessage content={msg.content} attachment={msg.attachment} actions={attachment} />
                         </div>
                     </div>
                 )}
@@ -271,32 +446,80 @@ function MessageItem({ msg, username, formatTime, isSelected, isExpanded, onTogg
 // ──────────────────────────────────────────────────
 //  Chat Screen (exact TUI replica)
 // ──────────────────────────────────────────────────
-function ChatScreen({ username }: { username: string }) {
+function ChatScreen({ username, notice }: { username: string, notice?: string }) {
     const [messages, setMessages] = useState<ChatMessage[]>([]);
+    const [transfers, setTransfers] = useState<Record<string, FileProgress>>({});
     const [selectedMsg, setSelectedMsg] = useState(-1);
     const [expanded, setExpanded] = useState<Record<number, boolean>>({});
     const [inputText, setInputText] = useState('');
     const [peerCount, setPeerCount] = useState(0);
-    const [showWarning, setShowWarning] = useState(false);
+    const [keyEpoch, setKeyEpoch] = useState(0); // 0 unless the room is encrypted
+    const [showWarning, setShowWarning] = useState(!!notice);
+    const [warningMsg, setWarningMsg] = useState(notice || '');
     const [lastSent, setLastSent] = useState(0);
+    const [trustAlert, setTrustAlert] = useState<string | null>(null);
+    const [panel, setPanel] = useState<string | null>(null);
+    const [invite, setInvite] = useState<main.InviteCode | null>(null);
+    const [room, setRoom] = useState<main.RoomState | null>(null);
+    const [mentioned, setMentioned] = useState<Record<string, boolean>>({}); // message IDs
+    const [self, setSelf] = useState('');
+    const completion = useRef<{ base: string, names: string[], next: number } | null>(null);
     const viewportRef = useRef<HTMLDivElement>(null);
     const inputRef = useRef<HTMLInputElement>(null);
 
     useEffect(() => {
+        GetPeerID().then(setSelf);
         GetPeerCount().then(setPeerCount);
+        GetKeyEpoch().then(setKeyEpoch);
 
         const interval = setInterval(() => {
+            GetPeerID().then(setSelf); // empty until we are connected
             GetPeerCount().then(setPeerCount);
+            GetKeyEpoch().then(setKeyEpoch);
         }, 1000);
 
         EventsOn('new_message', (msg: ChatMessage) => {
-            setMessages((prev) => [...prev, msg]);
+            setMessages((prev) => insertMessage(prev, msg));
+        });
+
+        // Messages that @mention us are marked, and said so above the input
+        EventsOn('mention', (msg: ChatMessage) => {
+            if (msg.id) setMentioned((prev) => ({ ...prev, [msg.id as string]: true }));
+            setWarningMsg(`@ ${msg.sender} mentioned you`);
+            setShowWarning(true);
+        });
+
+        EventsOn('file_progress', (p: FileProgress) => {
+            setTransfers((prev) => ({ ...prev, [p.hash]: p }));
         });
 
+        // A known name showing up with a new key stays in the status bar
+        // until it is verified
+        EventsOn('trust_alert', (text: string) => setTrustAlert(text));
+
+        // Moderators, bans and the topic of an owned room. What kicked
+        // and banned peers already said is dropped.
+        GetRoomState().then(setRoom);
+        EventsOn('room_state', (st: main.RoomState) => {
+            setRoom(st);
+            setMessages((prev) => prev.filter((m) => !m.from || !st.banned.includes(m.from)));
+            setSelectedMsg(-1);
+        });
+
+        // Files dropped anywhere on the window are offered to the room
+        OnFileDrop((_x, _y, paths) => {
+            paths.forEach((path) => SendFile(path).catch(showError));
+        }, false);
+
         inputRef.current?.focus();
         return () => {
             clearInterval(interval);
             EventsOff('new_message');
+            EventsOff('mention');
+            EventsOff('file_progress');
+            EventsOff('trust_alert');
+            EventsOff('room_state');
+            OnFileDropOff();
         };
     }, []);
 
@@ -307,9 +530,50 @@ function ChatScreen({ username }: { username: string }) {
         }
     }, [messages]);
 
-    const formatTime = (ts: number) => {
-        const d = new Date(ts * 1000);
-        return `${d.getHours().toString().padStart(2, '0')}:${d.getMinutes().toString().padStart(2, '0')}:${d.getSeconds().toString().padStart(2, '0')}`;
+    const formatTime = (msg: ChatMessage) => {
+        const d = new Date(stampOf(msg).wall);
+        const hms = `${d.getHours().toString().padStart(2, '0')}:${d.getMinutes().toString().padStart(2, '0')}:${d.getSeconds().toString().padStart(2, '0')}`;
+        // Flag peers whose clocks are far off so odd ordering makes sense,
+        // and our own messages still queued until someone joins
+        const skew = msg.skewed ? '⏱ ' : '';
+        const pending = msg.pending ? '◌ pending ' : '';
+        return `${pending}${skew}${hms}`;
+    };
+
+    const roleBadge = (msg: ChatMessage) => {
+        if (!room?.owned || !msg.from) return '';
+        if (msg.from === room.owner) return '~';
+        return room.moderators.includes(msg.from) ? '@' : '';
+    };
+
+    // The name a peer last used in this session, or the tail of its ID
+    const nameOf = (id: string) => {
+        const seen = [...messages].reverse().find((m) => m.from === id);
+        return seen ? seen.sender : `…${id.slice(-8)}`;
+    };
+
+    const showError = (err: unknown) => {
+        setWarningMsg(`⚠ ${err}`);
+        setShowWarning(true);
+    };
+
+    // Images pasted from the clipboard are sent as attachments rather
+    // than pasted as text
+    const handlePaste = (e: React.ClipboardEvent) => {
+        const images = Array.from(e.clipboardData.files).filter((f) => f.type.startsWith('image/'));
+        if (images.length === 0) return;
+        e.preventDefault();
+
+        images.forEach((file) => {
+            const reader = new FileReader();
+            reader.onload = () => {
+                const dataURL = reader.result as string;
+                const ext = file.type.split('/')[1] || 'png';
+                const name = file.name && file.name !== 'image.png' ? file.name : `pasted-${Date.now()}.${ext}`;
+                SendFileData(name, dataURL.slice(dataURL.indexOf(',') + 1)).catch(showError);
+            };
+            reader.readAsDataURL(file);
+        });
     };
 
     const handleSend = () => {
@@ -317,12 +581,147 @@ function ChatScreen({ username }: { username: string }) {
         if (!content) return;
 
         if (Date.now() - lastSent < 1500) {
+            setWarningMsg('⚡ Slow down!');
             setShowWarning(true);
             return;
         }
 
         setShowWarning(false);
-        SendMessage(content);
+
+        // "/verify <name> [confirm <key>]" compares safety numbers, as in the terminal UI
+        if (content.startsWith('/verify ')) {
+            const arg = content.slice('/verify '.length) + ' ';
+            const at = arg.indexOf(' confirm ');
+            const confirm = at >= 0;
+            const name = (confirm ? arg.slice(0, at) : arg).trim();
+            const key = confirm ? arg.slice(at + ' confirm '.length).trim() : '';
+            if (confirm && !key) {
+                setWarningMsg(`Run /verify ${name} first and confirm with the key it shows`);
+                setShowWarning(true);
+                return;
+            }
+            VerifyPeer(name, key).then((text) => {
+                if (confirm) {
+                    setTrustAlert(null);
+                    setWarningMsg(text);
+                    setShowWarning(true);
+                } else {
+                    setPanel(text);
+                }
+            }).catch(showError);
+            setInputText('');
+            return;
+        }
+
+        // Mute and block commands, as in the terminal UI
+        const [cmd, ...rest] = content.slice(1).split(' ');
+        const who = rest.join(' ').trim();
+        const peerActions: Record<string, (name: string) => Promise<string>> = {
+            mute: MutePeer, unmute: UnmutePeer, block: BlockPeer, unblock: UnblockPeer,
+        };
+        if (content.startsWith('/') && peerActions[cmd] && who) {
+            peerActions[cmd](who).then((id) => {
+                if (cmd === 'mute' || cmd === 'block') {
+                    // Hide what they already said, too
+                    setMessages((prev) => prev.filter((m) => m.from !== id));
+                    setSelectedMsg(-1);
+                }
+                setWarningMsg(`✓ ${cmd.replace(/e$/, '')}ed ${who}`);
+                setShowWarning(true);
+            }).catch(showError);
+            setInputText('');
+            return;
+        }
+        if (content === '/blocked') {
+            ListBlocked().then((entries) => {
+                setPanel(entries.length === 0
+                    ? 'nobody is muted or blocked'
+                    : entries.map((e) => `${e.blocked ? 'blocked' : 'muted  '}  ${e.name || '(unnamed)'}  …${e.id.slice(-8)}  ${e.blocked ? '/unblock' : '/unmute'} ${e.name}`).join('\n'));
+            }).catch(showError);
+            setInputText('');
+            return;
+        }
+
+        // "/invite [once] [<duration>|never]" shows a code for this room;
+        // "/join <code>" applies one
+        if (content.startsWith('/') && cmd === 'invite') {
+            CreateInvite(rest.includes('once'), rest.find((w) => w && w !== 'once') || '')
+                .then((inv) => {
+                    setPanel(null);
+                    setInvite(inv);
+                })
+                .catch(showError);
+            setInputText('');
+            return;
+        }
+        if (content.startsWith('/') && cmd === 'join' && who) {
+            JoinInvite(who).then((text) => {
+                setWarningMsg(text);
+                setShowWarning(true);
+            }).catch(showError);
+            setInputText('');
+            return;
+        }
+
+        // Moderation of owned rooms, as in the terminal UI; "/newroom
+        // <name>" creates one
+        if (content.startsWith('/') && ['kick', 'ban', 'unban', 'op', 'deop', 'admit', 'remove'].includes(cmd) && who) {
+            // "/kick <name> [<duration>]"
+            const last = rest[rest.length - 1];
+            const timed = cmd === 'kick' && rest.length > 1 && /^[0-9][0-9.]*(ms|s|m|h)/.test(last);
+            const name = timed ? rest.slice(0, -1).join(' ').trim() : who;
+            Moderate(cmd, name, timed ? last : '').then((text) => {
+                setWarningMsg(text);
+                setShowWarning(true);
+            }).catch(showError);
+            setInputText('');
+            return;
+        }
+        if (content.startsWith('/') && cmd === 'topic') {
+            SetTopic(who).then(() => {
+                setWarningMsg(who ? '✓ set the topic' : '✓ cleared the topic');
+                setShowWarning(true);
+            }).catch(showError);
+            setInputText('');
+            return;
+        }
+        if (content === '/mods') {
+            if (!room?.owned) {
+                showError("this room has no owner, so it can't be moderated");
+            } else {
+                setPanel([
+                    ...(room.topic ? [room.topic, ''] : []),
+                    `~ ${nameOf(room.owner)}  …${room.owner.slice(-8)}  owner`,
+                    ...room.moderators.map((id) => `@ ${nameOf(id)}  …${id.slice(-8)}  moderator · /deop to remove`),
+                    ...room.members.map((id) => `  ${nameOf(id)}  …${id.slice(-8)}  member · /remove to remove`),
+                    ...room.banned.map((id) => `✗ ${nameOf(id)}  …${id.slice(-8)}  kicked or banned · /unban to lift`),
+                ].join('\n'));
+            }
+            setInputText('');
+            return;
+        }
+        if (content.startsWith('/') && cmd === 'newroom' && who) {
+            CreateRoom(who).then((text) => {
+                setWarningMsg(text);
+                setShowWarning(true);
+            }).catch(showError);
+            setInputText('');
+            return;
+        }
+
+        // "/send <path>" offers a file, same as in the terminal UI
+        if (content.startsWith('/send ')) {
+            SendFile(content.slice('/send '.length).trim()).catch(showError);
+            setInputText('');
+            return;
+        }
+
+        SendMessage(content).catch((err) => {
+            // e.g. message too large: put the text back so nothing is lost
+            setWarningMsg(`⚠ ${err}`);
+            setShowWarning(true);
+            setInputText(content);
+        });
         setInputText('');
         setLastSent(Date.now());
     };
@@ -359,8 +758,36 @@ function ChatScreen({ username }: { username: string }) {
         setExpanded(prev => ({ ...prev, [idx]: !prev[idx] }));
     };
 
-    const handleSendKey = (e: React.KeyboardEvent) => {
-        if (e.key === 'ArrowUp') {
+    // Tab completes the @name at the end of the input from who is in
+    // the room; pressing it again moves on to the next match
+    const completeMention = (e: React.KeyboardEvent<HTMLTextAreaElement>) => {
+        const el = e.currentTarget;
+        if (el.selectionStart !== inputText.length) return;
+        const c = completion.current;
+        const current = c && `${c.base}@${c.names[(c.next + c.names.length - 1) % c.names.length]} `;
+        if (c && inputText === current) {
+            e.preventDefault();
+            setInputText(`${c.base}@${c.names[c.next % c.names.length]} `);
+            c.next++;
+            return;
+        }
+        const match = inputText.match(/@([^\s@]*)$/);
+        if (!match) return;
+        e.preventDefault();
+        const base = inputText.slice(0, match.index);
+        const prefix = match[1].toLowerCase();
+        GetPeerNames().then((names) => {
+            const matches = names.filter((n) => n.toLowerCase().startsWith(prefix));
+            if (matches.length === 0) return;
+            completion.current = { base, names: matches, next: 1 };
+            setInputText(`${base}@${matches[0]} `);
+        });
+    };
+
+    const handleSendKey = (e: React.KeyboardEvent<HTMLTextAreaElement>) => {
+        if (e.key === 'Tab' && selectedMsg === -1) {
+            completeMention(e);
+        } else if (e.key === 'ArrowUp') {
             // Navigate Up
             if (selectedMsg === -1 && messages.length > 0) {
                 e.preventDefault();
@@ -391,9 +818,14 @@ function ChatScreen({ username }: { username: string }) {
                 setRows(1);
             }
         } else if (e.key === 'Escape') {
-            // Deselect
+            // Close any panel, then deselect
             e.preventDefault();
-            setSelectedMsg(-1);
+            if (panel !== null || invite !== null) {
+                setPanel(null);
+                setInvite(null);
+            } else {
+                setSelectedMsg(-1);
+            }
         }
     };
 
@@ -426,10 +858,18 @@ function ChatScreen({ username }: { username: string }) {
                 </span>
             </div>
 
-            {/* Status */}
-            <div style={{ padding: '0 8px', color: 'var(--dim-gray)', fontStyle: 'italic' }}>
-                {'  '}online as {username}{'  '}({peerCount} active ghosts)
-            </div>
+            {/* Status, replaced by any unresolved identity warning */}
+            {trustAlert ? (
+                <div style={{ padding: '0 8px', color: 'var(--warning-red)', fontWeight: 'bold' }}>
+                    {'  '}⚠ {trustAlert}
+                </div>
+            ) : (
+                <div style={{ padding: '0 8px', color: 'var(--dim-gray)', fontStyle: 'italic' }}>
+                    {'  '}{room?.owned && `#${room.room}  `}online as {username}{'  '}({peerCount} active ghosts)
+                    {room?.topic && `  · ${room.topic}`}
+                    {keyEpoch > 0 && `  · 🔒 key epoch ${keyEpoch}`}
+                </div>
+            )}
 
             {/* Divider */}
             <div style={{ padding: '2px 0', color: 'var(--dim-gray)', overflow: 'hidden', whiteSpace: 'nowrap' }}>
@@ -446,23 +886,46 @@ function ChatScreen({ username }: { username: string }) {
                     minHeight: 0,
                 }}
             >
-                {messages.length === 0 ? (
+                {invite !== null ? (
+                    <div style={{ padding: '4px 16px' }}>
+                        <div style={{ color: 'var(--dim-gray)', fontStyle: 'italic', marginBottom: '8px' }}>
+                            esc to close
+                        </div>
+                        <img src={`data:image/png;base64,${invite.qr}`} alt="invite QR code" width={192} height={192} />
+                        <div style={{ color: 'var(--dim-gray)', margin: '8px 0' }}>{invite.summary}</div>
+                        <div style={{ wordBreak: 'break-all', userSelect: 'text' }}>{invite.code}</div>
+                        <div style={{ color: 'var(--dim-gray)', marginTop: '8px' }}>
+                            paste it into the invite box, or run: hush join &lt;code&gt;
+                        </div>
+                    </div>
+                ) : panel !== null ? (
+                    <div style={{ padding: '4px 16px' }}>
+                        <div style={{ color: 'var(--dim-gray)', fontStyle: 'italic', marginBottom: '8px' }}>
+                            esc to close
+                        </div>
+                        <pre style={{ margin: 0, whiteSpace: 'pre-wrap', fontFamily: 'inherit' }}>{panel}</pre>
+                    </div>
+                ) : messages.length === 0 ? (
                     <div style={{ color: 'var(--dim-gray)', fontStyle: 'italic', padding: '4px 8px' }}>
                         {'  '}waiting for ghosts to appear... 👻
                     </div>
                 ) : (
                     messages.map((msg, i) => (
                         <MessageItem
-                            key={`${msg.timestamp}-${i}`}
+                            key={msg.id || `${msg.timestamp}-${i}`}
                             msg={msg}
-                            username={username}
+                            self={self}
+                            badge={roleBadge(msg)}
                             formatTime={formatTime}
                             isSelected={selectedMsg === i}
+                            isMention={!!msg.id && !!mentioned[msg.id]}
                             isExpanded={expanded[i] || false}
                             onToggle={() => {
                                 setSelectedMsg(i);
                                 toggleExpansion(i);
                             }}
+                            progress={msg.attachment && transfers[msg.attachment.hash]}
+                            onError={showError}
                         />
                     ))
                 )}
@@ -477,7 +940,7 @@ function ChatScreen({ username }: { username: string }) {
             <div style={{ height: '20px', padding: '0 8px' }}>
                 {showWarning && (
                     <span style={{ color: 'var(--warning-red)', fontWeight: 'bold' }}>
-                        {'  '}⚡ Slow down!
+                        {'  '}{warningMsg}
                     </span>
                 )}
             </div>
@@ -502,6 +965,7 @@ function ChatScreen({ username }: { username: string }) {
                         onChange={handleInputChange}
                         onFocus={() => setSelectedMsg(-1)}
                         onKeyDown={handleSendKey} // Updated handler name
+                        onPaste={handlePaste}
                         placeholder={placeholderShown ? "type a message..." : ""}
                         spellCheck={false}
                         autoFocus
@@ -534,9 +998,23 @@ function App() {
     const [screen, setScreen] = useState<'welcome' | 'chat'>('welcome');
     const [username, setUsernameState] = useState('');
 
-    const handleEnter = (name: string) => {
+    const [notice, setNotice] = useState<string | undefined>();
+
+    // Colors come from the same theme files as the TUI's
+    useEffect(() => {
+        GetTheme()
+            .then((theme) => {
+                for (const [name, value] of Object.entries(theme.vars)) {
+                    document.documentElement.style.setProperty(name, value);
+                }
+            })
+            .catch(() => {}); // keep the defaults in index.css
+    }, []);
+
+    const handleEnter = (name: string, joined?: string) => {
         setUsernameState(name);
         SetUsername(name);
+        setNotice(joined);
         setScreen('chat');
     };
 
@@ -544,7 +1022,7 @@ function App() {
         return <WelcomeScreen onEnter={handleEnter} />;
     }
 
-    return <ChatScreen username={username} />;
+    return <ChatScreen username={username} notice={notice} />;
 }
 
 export default App;
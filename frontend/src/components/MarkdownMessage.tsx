@@ -8,12 +8,23 @@ import './MarkdownStyles.css';
 // Try to use wails runtime if available, otherwise just window.open
 import { BrowserOpenURL } from '../../wailsjs/runtime/runtime';
 
+export interface Attachment {
+    hash: string;
+    name: string;
+    size: number;
+    mime?: string;
+    thumbnail?: string; // base64 JPEG preview for images
+}
+
 interface MarkdownMessageProps {
     content: string;
     compact?: boolean;
+    attachment?: Attachment;
+    // Download/save controls shown under an inline attachment
+    actions?: React.ReactNode;
 }
 
-const MarkdownMessage: React.FC<MarkdownMessageProps> = ({ content, compact }) => {
+const MarkdownMessage: React.FC<MarkdownMessageProps> = ({ content, compact, attachment, actions }) => {
     // In compact mode, we want a single line preview.
     // We disallow block elements which forces react-markdown to either skip them or unwrap them.
     // unwrapDisallowed=true means <p>text</p> becomes "text".
@@ -80,6 +91,16 @@ const MarkdownMessage: React.FC<MarkdownMessageProps> = ({ content, compact }) =
             >
                 {content}
             </ReactMarkdown>
+            {!compact && attachment?.thumbnail && (
+                <div className="attachment-preview">
+                    <img
+                        src={`data:image/jpeg;base64,${attachment.thumbnail}`}
+                        alt={attachment.name}
+                        title={attachment.name}
+                    />
+                </div>
+            )}
+            {actions}
         </div>
     );
 };
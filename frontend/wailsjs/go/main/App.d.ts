@@ -1,10 +1,52 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {block} from '../models';
+import {main} from '../models';
+
+export function AcceptFile(arg1:string):Promise<void>;
+
+export function BlockPeer(arg1:string):Promise<string>;
+
+export function CreateInvite(arg1:boolean,arg2:string):Promise<main.InviteCode>;
+
+export function CreateRoom(arg1:string):Promise<string>;
+
+export function GetKeyEpoch():Promise<number>;
 
 export function GetPeerCount():Promise<number>;
 
+export function GetPeerID():Promise<string>;
+
+export function GetPeerNames():Promise<Array<string>>;
+
+export function GetRoomState():Promise<main.RoomState>;
+
+export function GetTheme():Promise<main.ThemeColors>;
+
 export function GetUsername():Promise<string>;
 
+export function JoinInvite(arg1:string):Promise<string>;
+
+export function ListBlocked():Promise<Array<block.Entry>>;
+
+export function Moderate(arg1:string,arg2:string,arg3:string):Promise<string>;
+
+export function MutePeer(arg1:string):Promise<string>;
+
+export function SaveAttachment(arg1:string):Promise<string>;
+
+export function SendFile(arg1:string):Promise<void>;
+
+export function SendFileData(arg1:string,arg2:string):Promise<void>;
+
 export function SendMessage(arg1:string):Promise<void>;
 
+export function SetTopic(arg1:string):Promise<void>;
+
 export function SetUsername(arg1:string):Promise<void>;
+
+export function UnblockPeer(arg1:string):Promise<string>;
+
+export function UnmutePeer(arg1:string):Promise<string>;
+
+export function VerifyPeer(arg1:string,arg2:string):Promise<string>;
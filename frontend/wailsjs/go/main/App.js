@@ -2,18 +2,98 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AcceptFile(arg1) {
+  return window['go']['main']['App']['AcceptFile'](arg1);
+}
+
+export function BlockPeer(arg1) {
+  return window['go']['main']['App']['BlockPeer'](arg1);
+}
+
+export function CreateInvite(arg1,arg2) {
+  return window['go']['main']['App']['CreateInvite'](arg1,arg2);
+}
+
+export function CreateRoom(arg1) {
+  return window['go']['main']['App']['CreateRoom'](arg1);
+}
+
+export function GetKeyEpoch() {
+  return window['go']['main']['App']['GetKeyEpoch']();
+}
+
 export function GetPeerCount() {
   return window['go']['main']['App']['GetPeerCount']();
 }
 
+export function GetPeerID() {
+  return window['go']['main']['App']['GetPeerID']();
+}
+
+export function GetPeerNames() {
+  return window['go']['main']['App']['GetPeerNames']();
+}
+
+export function GetRoomState() {
+  return window['go']['main']['App']['GetRoomState']();
+}
+
+export function GetTheme() {
+  return window['go']['main']['App']['GetTheme']();
+}
+
 export function GetUsername() {
   return window['go']['main']['App']['GetUsername']();
 }
 
+export function JoinInvite(arg1) {
+  return window['go']['main']['App']['JoinInvite'](arg1);
+}
+
+export function ListBlocked() {
+  return window['go']['main']['App']['ListBlocked']();
+}
+
+export function Moderate(arg1,arg2,arg3) {
+  return window['go']['main']['App']['Moderate'](arg1,arg2,arg3);
+}
+
+export function MutePeer(arg1) {
+  return window['go']['main']['App']['MutePeer'](arg1);
+}
+
+export function SaveAttachment(arg1) {
+  return window['go']['main']['App']['SaveAttachment'](arg1);
+}
+
+export function SendFile(arg1) {
+  return window['go']['main']['App']['SendFile'](arg1);
+}
+
+export function SendFileData(arg1,arg2) {
+  return window['go']['main']['App']['SendFileData'](arg1,arg2);
+}
+
 export function SendMessage(arg1) {
   return window['go']['main']['App']['SendMessage'](arg1);
 }
 
+export function SetTopic(arg1) {
+  return window['go']['main']['App']['SetTopic'](arg1);
+}
+
 export function SetUsername(arg1) {
   return window['go']['main']['App']['SetUsername'](arg1);
 }
+
+export function UnblockPeer(arg1) {
+  return window['go']['main']['App']['UnblockPeer'](arg1);
+}
+
+export function UnmutePeer(arg1) {
+  return window['go']['main']['App']['UnmutePeer'](arg1);
+}
+
+export function VerifyPeer(arg1,arg2) {
+  return window['go']['main']['App']['VerifyPeer'](arg1,arg2);
+}
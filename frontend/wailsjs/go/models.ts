@@ -0,0 +1,80 @@
+export namespace block {
+	
+	export class Entry {
+	    id: string;
+	    name: string;
+	    blocked: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Entry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.blocked = source["blocked"];
+	    }
+	}
+
+}
+
+export namespace main {
+	
+	export class InviteCode {
+	    code: string;
+	    summary: string;
+	    qr: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new InviteCode(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.summary = source["summary"];
+	        this.qr = source["qr"];
+	    }
+	}
+	export class ThemeColors {
+	    name: string;
+	    vars: Record<string, string>;
+	
+	    static createFrom(source: any = {}) {
+	        return new ThemeColors(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.vars = source["vars"];
+	    }
+	}
+	export class RoomState {
+	    room: string;
+	    topic: string;
+	    owned: boolean;
+	    owner: string;
+	    moderators: string[];
+	    members: string[];
+	    banned: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new RoomState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.room = source["room"];
+	        this.topic = source["topic"];
+	        this.owned = source["owned"];
+	        this.owner = source["owner"];
+	        this.moderators = source["moderators"];
+	        this.members = source["members"];
+	        this.banned = source["banned"];
+	    }
+	}
+
+}
+
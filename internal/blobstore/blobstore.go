@@ -0,0 +1,279 @@
+// Package blobstore is a local content-addressed cache of attachments,
+// keyed by the hex BLAKE3 hash of their content. It is capped in size
+// and evicts the least recently used blobs first.
+package blobstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBytes is the default cache size cap.
+const DefaultMaxBytes = 512 << 20
+
+// ErrNotFound means the blob isn't in the store.
+var ErrNotFound = errors.New("blob not in cache")
+
+// Entry describes one cached blob.
+type Entry struct {
+	Hash     string    `json:"hash"`
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Store is a size-capped LRU of blobs on disk.
+type Store struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	total   int64
+}
+
+// DefaultDir returns the cache location under the user cache directory.
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "hush", "blobs")
+}
+
+// Open loads (or creates) a store in dir holding at most maxBytes.
+func Open(dir string, maxBytes int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*Entry),
+	}
+	if err := s.loadIndex(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Has reports whether the blob is cached.
+func (s *Store) Has(hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.entries[hash]
+	return ok
+}
+
+// Open returns a reader for the blob and marks it recently used.
+func (s *Store) Open(hash string) (*os.File, error) {
+	s.mu.Lock()
+	e, ok := s.entries[hash]
+	if ok {
+		e.LastUsed = time.Now()
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	f, err := os.Open(s.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		s.forget(hash)
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Import moves an already verified file at src into the store under
+// hash, then evicts older blobs if the store is over its cap. src must
+// be on the same filesystem or it is copied.
+func (s *Store) Import(src, hash, name string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	dst := s.path(hash)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+		os.Remove(src)
+	}
+
+	s.mu.Lock()
+	if old, ok := s.entries[hash]; ok {
+		s.total -= old.Size
+	}
+	s.entries[hash] = &Entry{Hash: hash, Name: name, Size: info.Size(), LastUsed: time.Now()}
+	s.total += info.Size()
+	s.evictLocked(hash)
+	err = s.saveIndexLocked()
+	s.mu.Unlock()
+	return err
+}
+
+// Export copies the blob to dst, e.g. into the user's downloads.
+func (s *Store) Export(hash, dst string) error {
+	f, err := s.Open(hash)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Copy rather than hard link: edits to the user's copy must never
+	// corrupt the cached blob we serve to others.
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// PartialPath returns where an in-progress download of hash should be
+// written, inside the store so Import is a cheap rename.
+func (s *Store) PartialPath(hash string) string {
+	dir := filepath.Join(s.dir, "partial")
+	_ = os.MkdirAll(dir, 0o755)
+	return filepath.Join(dir, filepath.Base(hash))
+}
+
+// List returns cached blobs, most recently used first.
+func (s *Store) List() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastUsed.After(out[j].LastUsed) })
+	return out
+}
+
+// Size returns the total bytes cached and the cap.
+func (s *Store) Size() (used, max int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.total, s.maxBytes
+}
+
+// evictLocked drops least recently used blobs until under the cap,
+// never evicting keep (the blob just added).
+func (s *Store) evictLocked(keep string) {
+	if s.total <= s.maxBytes {
+		return
+	}
+	lru := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if e.Hash != keep {
+			lru = append(lru, e)
+		}
+	}
+	sort.Slice(lru, func(i, j int) bool { return lru[i].LastUsed.Before(lru[j].LastUsed) })
+
+	for _, e := range lru {
+		if s.total <= s.maxBytes {
+			break
+		}
+		os.Remove(s.path(e.Hash))
+		delete(s.entries, e.Hash)
+		s.total -= e.Size
+	}
+}
+
+func (s *Store) forget(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[hash]; ok {
+		s.total -= e.Size
+		delete(s.entries, hash)
+		_ = s.saveIndexLocked()
+	}
+}
+
+// path shards blobs by the first two hex digits to keep directories small.
+func (s *Store) path(hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(s.dir, "_", hash)
+	}
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, "index.json")
+}
+
+func (s *Store) loadIndex() error {
+	data, err := os.ReadFile(s.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil // a corrupt index just means a cold cache
+	}
+	for _, e := range entries {
+		if _, err := os.Stat(s.path(e.Hash)); err != nil {
+			continue
+		}
+		s.entries[e.Hash] = &e
+		s.total += e.Size
+	}
+	return nil
+}
+
+func (s *Store) saveIndexLocked() error {
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, *e)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.indexPath())
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,220 @@
+// Package block keeps the user's mute and block lists. Muting hides a
+// peer's messages locally; blocking also drops them at the gossip layer
+// (List is a pubsub.Blacklist) and refuses their connections (List is a
+// connection gater). Both lists persist in the user's config.
+package block
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+
+	"github.com/ekrishgupta/Hush/internal/config"
+)
+
+// Entry is one muted or blocked peer.
+type Entry struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Blocked bool   `json:"blocked"` // false means only muted
+}
+
+// List is the set of muted and blocked peers.
+type List struct {
+	cfg *config.Config
+	net network.Network
+
+	mu      sync.RWMutex
+	muted   map[peer.ID]string
+	blocked map[peer.ID]string
+}
+
+// New loads the lists from cfg. Changes are saved back to it.
+func New(cfg *config.Config) *List {
+	l := &List{
+		cfg:     cfg,
+		muted:   make(map[peer.ID]string),
+		blocked: make(map[peer.ID]string),
+	}
+	for _, p := range cfg.Muted {
+		l.muted[p.ID] = p.Name
+	}
+	for _, p := range cfg.Blocked {
+		l.blocked[p.ID] = p.Name
+	}
+	return l
+}
+
+// Mute hides id's messages.
+func (l *List) Mute(id peer.ID, name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.muted[id] = name
+	return l.saveLocked()
+}
+
+// Unmute shows id's messages again.
+func (l *List) Unmute(id peer.ID) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.muted, id)
+	return l.saveLocked()
+}
+
+// SetNetwork lets Block hang up on peers that are already connected.
+// The host needs the list as its gater first, hence the separate step.
+func (l *List) SetNetwork(n network.Network) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.net = n
+}
+
+// Block drops id's traffic and connections, hanging up on them if
+// they're connected.
+func (l *List) Block(id peer.ID, name string) error {
+	l.mu.Lock()
+	l.blocked[id] = name
+	err := l.saveLocked()
+	n := l.net
+	l.mu.Unlock()
+
+	if n != nil {
+		_ = n.ClosePeer(id)
+	}
+	return err
+}
+
+// Unblock lets id reconnect.
+func (l *List) Unblock(id peer.ID) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.blocked, id)
+	return l.saveLocked()
+}
+
+// Muted reports whether id's messages should be hidden. Blocked peers
+// count as muted, in case anything of theirs slips through.
+func (l *List) Muted(id peer.ID) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, muted := l.muted[id]
+	_, blocked := l.blocked[id]
+	return muted || blocked
+}
+
+// Entries returns every muted or blocked peer, blocked first, by name.
+func (l *List) Entries() []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var out []Entry
+	for id, name := range l.blocked {
+		out = append(out, Entry{ID: id.String(), Name: name, Blocked: true})
+	}
+	for id, name := range l.muted {
+		if _, ok := l.blocked[id]; !ok {
+			out = append(out, Entry{ID: id.String(), Name: name})
+		}
+	}
+	slices.SortFunc(out, func(a, b Entry) int {
+		if a.Blocked != b.Blocked {
+			if a.Blocked {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return out
+}
+
+// Find looks up a muted or blocked peer by name or by the tail of its
+// ID.
+func (l *List) Find(who string) (peer.ID, string, bool) {
+	for _, e := range l.Entries() {
+		if strings.EqualFold(e.Name, who) || strings.HasSuffix(e.ID, who) {
+			id, err := peer.Decode(e.ID)
+			return id, e.Name, err == nil
+		}
+	}
+	return "", "", false
+}
+
+func (l *List) saveLocked() error {
+	return l.cfg.Update(func(c *config.Config) {
+		c.Muted = peers(l.muted)
+		c.Blocked = peers(l.blocked)
+	})
+}
+
+func peers(m map[peer.ID]string) []config.Peer {
+	out := make([]config.Peer, 0, len(m))
+	for id, name := range m {
+		out = append(out, config.Peer{ID: id, Name: name})
+	}
+	slices.SortFunc(out, func(a, b config.Peer) int { return cmp.Compare(a.ID, b.ID) })
+	return out
+}
+
+// ── pubsub.Blacklist ────────────────────────────────
+
+// Add blocks id. GossipSub calls this when it blacklists a peer itself.
+func (l *List) Add(id peer.ID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.blocked[id]; !ok {
+		l.blocked[id] = ""
+		_ = l.saveLocked()
+	}
+	return true
+}
+
+// Contains reports whether id is blocked.
+func (l *List) Contains(id peer.ID) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.blocked[id]
+	return ok
+}
+
+// ── connmgr.ConnectionGater ─────────────────────────
+
+// InterceptPeerDial refuses to dial blocked peers.
+func (l *List) InterceptPeerDial(id peer.ID) bool {
+	return !l.Contains(id)
+}
+
+// InterceptAddrDial refuses to dial blocked peers.
+func (l *List) InterceptAddrDial(id peer.ID, _ ma.Multiaddr) bool {
+	return !l.Contains(id)
+}
+
+// InterceptAccept allows every inbound connection; we don't know who it
+// is until the handshake.
+func (l *List) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+// InterceptSecured drops connections from blocked peers once the
+// handshake reveals who they are.
+func (l *List) InterceptSecured(_ network.Direction, id peer.ID, _ network.ConnMultiaddrs) bool {
+	return !l.Contains(id)
+}
+
+// InterceptUpgraded allows every connection that got this far.
+func (l *List) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
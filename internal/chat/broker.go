@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// Event is something that happened on a room: a chat message arriving
+// (or one of ours being delivered from the outbox), a presence
+// announcement, and so on. Kind says which fields are set.
+type Event struct {
+	Kind wire.Kind
+	Room string
+	From peer.ID
+
+	Message ChatMessage  // KindChat
+	Name    string       // KindPresence
+	Hashes  []string     // KindFile: blobs the peer can serve
+	Control wire.Control // KindControl: signed moderation actions
+}
+
+// Filter selects which events a subscriber receives. Zero fields match
+// everything.
+type Filter struct {
+	Room   string
+	Kinds  []wire.Kind
+	Sender peer.ID
+}
+
+func (f Filter) match(ev Event) bool {
+	if f.Room != "" && f.Room != ev.Room {
+		return false
+	}
+	if len(f.Kinds) > 0 && !slices.Contains(f.Kinds, ev.Kind) {
+		return false
+	}
+	if f.Sender != "" && f.Sender != ev.From {
+		return false
+	}
+	return true
+}
+
+// Policy decides what happens when a subscriber's buffer is full.
+type Policy int
+
+const (
+	// DropOldest discards the oldest buffered event to make room, so a
+	// slow subscriber never holds up gossip consumption.
+	DropOldest Policy = iota
+	// Block waits for the subscriber to catch up.
+	Block
+)
+
+// DefaultBuffer is the per-subscriber buffer used when none is given.
+const DefaultBuffer = 64
+
+// SubscribeOptions configures a broker subscription.
+type SubscribeOptions struct {
+	Filter Filter
+	Buffer int
+	Policy Policy
+}
+
+// Subscription is one consumer of broker events.
+type Subscription struct {
+	broker  *Broker
+	ch      chan Event
+	done    chan struct{}
+	once    sync.Once
+	filter  Filter
+	policy  Policy
+	dropped atomic.Uint64
+}
+
+// C returns the channel events are delivered on. It is closed when the
+// subscription is closed.
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns how many events this subscriber lost to a full buffer.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops delivery and closes the channel.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done) // release any blocked Publish first
+		s.broker.remove(s)
+	})
+}
+
+// Broker fans events out to any number of filtered subscribers.
+type Broker struct {
+	mu      sync.RWMutex
+	subs    map[*Subscription]struct{}
+	dropped atomic.Uint64
+}
+
+// NewBroker returns a broker with no subscribers.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a new subscriber.
+func (b *Broker) Subscribe(opts SubscribeOptions) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultBuffer
+	}
+	s := &Subscription{
+		broker: b,
+		ch:     make(chan Event, opts.Buffer),
+		done:   make(chan struct{}),
+		filter: opts.Filter,
+		policy: opts.Policy,
+	}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Dropped returns the total number of deliveries lost across all
+// subscribers, including ones since closed.
+func (b *Broker) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+func (b *Broker) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subs, s)
+	close(s.ch)
+}
+
+// Publish delivers ev to every matching subscriber. It only blocks on
+// subscribers with the Block policy, and gives up when ctx is done.
+func (b *Broker) Publish(ctx context.Context, ev Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for s := range b.subs {
+		if !s.filter.match(ev) {
+			continue
+		}
+		if s.policy == Block {
+			select {
+			case s.ch <- ev:
+			case <-s.done:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		b.deliverDropOldest(s, ev)
+	}
+}
+
+func (b *Broker) deliverDropOldest(s *Subscription, ev Event) {
+	for {
+		select {
+		case s.ch <- ev:
+			return
+		default:
+		}
+
+		// Full: discard the oldest event and try again.
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+			b.dropped.Add(1)
+		default:
+		}
+	}
+}
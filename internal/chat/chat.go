@@ -2,75 +2,337 @@ package chat
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sync"
 
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
 )
 
 // Chat manages publishing and subscribing to the local-gc topic.
 type Chat struct {
-	topic *pubsub.Topic
-	sub   *pubsub.Subscription
-	self  peer.ID
+	topic  *pubsub.Topic
+	sub    *pubsub.Subscription
+	self   peer.ID
+	clock  *Clock
+	outbox outbox
+	flush  chan struct{} // nudges watchPeers to flush the outbox
+	errs   chan error
+	broker *Broker
+
+	maxSize int
+	reasm   *reassembler
+	limiter *Limiter
+	sealer  Sealer
+
+	mu     sync.Mutex
+	name   string
+	caps   map[peer.ID][]wire.Kind // kinds each peer announced it understands
+	names  map[peer.ID]string      // last display name each peer used
+	floods map[peer.ID]*flood      // peers we are dropping traffic from
 }
 
 // NewChat wraps the topic and subscription.
-func NewChat(topic *pubsub.Topic, sub *pubsub.Subscription, selfID peer.ID) *Chat {
-	return &Chat{
-		topic: topic,
-		sub:   sub,
-		self:  selfID,
+func NewChat(topic *pubsub.Topic, sub *pubsub.Subscription, selfID peer.ID, opts ...Option) *Chat {
+	c := &Chat{
+		topic:   topic,
+		sub:     sub,
+		self:    selfID,
+		clock:   NewClock(),
+		flush:   make(chan struct{}, 1),
+		errs:    make(chan error, 16),
+		broker:  NewBroker(),
+		caps:    make(map[peer.ID][]wire.Kind),
+		names:   make(map[peer.ID]string),
+		floods:  make(map[peer.ID]*flood),
+		maxSize: DefaultMaxMessageSize,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.limiter == nil {
+		c.limiter = NewLimiter(DefaultReceiveRate, DefaultReceiveBurst)
+	}
+	c.reasm = newReassembler(c.maxSize)
+	return c
 }
 
-// Publish serializes and sends a ChatMessage to the topic.
-func (c *Chat) Publish(sender, content string) error {
-	msg := NewChatMessage(sender, content)
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("marshaling message: %w", err)
+// MaxMessageSize returns the largest content, in bytes, Publish accepts.
+func (c *Chat) MaxMessageSize() int {
+	return c.maxSize
+}
+
+// SetName sets the display name announced to peers and announces it.
+func (c *Chat) SetName(name string) {
+	c.mu.Lock()
+	c.name = name
+	c.mu.Unlock()
+
+	c.announce(context.Background())
+}
+
+// Errors returns a channel of problems with incoming traffic, such as
+// messages that failed to decode. Errors are dropped if nobody reads.
+func (c *Chat) Errors() <-chan error {
+	return c.errs
+}
+
+// PeerSupports reports whether a peer has announced it understands kind.
+// Peers we haven't heard a presence announcement from are assumed to
+// understand only chat messages.
+func (c *Chat) PeerSupports(id peer.ID, kind wire.Kind) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kinds, ok := c.caps[id]
+	if !ok {
+		return kind == wire.KindChat
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// allSupport reports whether every peer in the topic understands kind.
+func (c *Chat) allSupport(kind wire.Kind) bool {
+	for _, id := range c.Peers() {
+		if !c.PeerSupports(id, kind) {
+			return false
+		}
+	}
+	return true
+}
+
+// anySupports reports whether some peer in the topic understands kind.
+func (c *Chat) anySupports(kind wire.Kind) bool {
+	for _, id := range c.Peers() {
+		if c.PeerSupports(id, kind) {
+			return true
+		}
 	}
+	return false
+}
+
+// Publish stamps, serializes and sends a ChatMessage to the topic. It
+// returns the message as sent so callers can show it in their own timeline.
+//
+// If nobody is in the topic the message is queued instead and returned
+// with Pending set; it is rebroadcast when a peer joins and then shows up
+// again for subscribers with Pending cleared.
+//
+// @name mentions of anyone in the room are resolved to their peer IDs.
+//
+// Content over MaxMessageSize is rejected with ErrMessageTooLarge. Long
+// content within the limit is compressed and chunked transparently,
+// unless a peer in the room hasn't announced it understands chunks; then
+// content that fits a single frame is sent whole.
+func (c *Chat) Publish(sender, content string) (ChatMessage, error) {
+	msg := NewChatMessage(sender, content, c.clock.Now())
+	c.mu.Lock()
+	msg.Mentions = ParseMentions(content, c.names)
+	c.mu.Unlock()
+	return c.publish(msg)
+}
+
+// PublishAttachment offers a file to the room. Peers download it from
+// us with the transfer service; the content line is what clients that
+// don't understand attachments will show.
+func (c *Chat) PublishAttachment(sender string, att Attachment) (ChatMessage, error) {
+	content := fmt.Sprintf("📎 %s (%s)", att.Name, HumanSize(att.Size))
+	msg := NewChatMessage(sender, content, c.clock.Now())
+	msg.Attachment = &att
+	return c.publish(msg)
+}
+
+// AnnounceHave tells the room we can serve these blobs to anyone who
+// wants them.
+func (c *Chat) AnnounceHave(hashes ...string) error {
+	if !c.anySupports(wire.KindFile) {
+		return nil // nobody here would fetch from us
+	}
+	data := wire.New(wire.KindFile, wire.FileHave{Hashes: hashes}.Marshal()).Marshal()
+	return c.publishFrames(context.Background(), [][]byte{data})
+}
+
+// PublishControl sends moderation actions to the room. Control messages
+// aren't queued: the log is republished whenever a peer turns up. ctl
+// must encode to at most MaxControlSize bytes.
+func (c *Chat) PublishControl(ctl wire.Control) error {
+	payload := ctl.Marshal()
+	if len(payload) > MaxControlSize {
+		return fmt.Errorf("%w: %d byte control message, limit is %d", ErrMessageTooLarge, len(payload), MaxControlSize)
+	}
+	data := wire.New(wire.KindControl, payload).Marshal()
 	return c.topic.Publish(context.Background(), data)
 }
 
-// ListenForMessages reads from the subscription in a goroutine and
-// sends decoded messages to the returned channel, filtering out
-// messages from self.
-func (c *Chat) ListenForMessages(ctx context.Context) <-chan ChatMessage {
-	ch := make(chan ChatMessage, 32)
+func (c *Chat) publish(msg ChatMessage) (ChatMessage, error) {
+	msg.From = c.self
+	if len(msg.Content) > c.maxSize {
+		return msg, fmt.Errorf("%w: %d bytes, limit is %d", ErrMessageTooLarge, len(msg.Content), c.maxSize)
+	}
+	// Queued messages go to whoever turns up, so they assume chunking
+	frames, err := encodeMessage(msg, c.PeerCount() == 0 || c.allSupport(wire.KindChunk))
+	if err != nil {
+		return msg, err
+	}
+
+	if c.PeerCount() == 0 {
+		if err := c.outbox.add(msg, frames); err != nil {
+			return msg, err
+		}
+		msg.Pending = true
 
-	go func() {
-		defer close(ch)
-		for {
-			msg, err := c.sub.Next(ctx)
+		// A peer may have joined between the check and the enqueue.
+		if c.PeerCount() > 0 {
+			c.kickOutbox()
+		}
+		return msg, nil
+	}
+	return msg, c.publishFrames(context.Background(), frames)
+}
+
+func (c *Chat) publishFrames(ctx context.Context, frames [][]byte) error {
+	for _, f := range frames {
+		// Never sent in the clear for peers that don't understand sealed
+		// frames: they can't have the room's keys either
+		if c.sealer != nil {
+			payload, err := c.sealer.Seal(f)
 			if err != nil {
-				return // context cancelled or subscription closed
+				return fmt.Errorf("encrypting message: %w", err)
 			}
+			f = wire.New(wire.KindSealed, payload).Marshal()
+		}
+		if err := c.topic.Publish(ctx, f); err != nil {
+			return fmt.Errorf("publishing message: %w", err)
+		}
+	}
+	return nil
+}
 
-			// skip messages from ourselves
-			if msg.ReceivedFrom == c.self {
-				continue
-			}
+// PendingCount returns the number of messages waiting for a peer.
+func (c *Chat) PendingCount() int {
+	return c.outbox.len()
+}
 
-			var cm ChatMessage
-			if err := json.Unmarshal(msg.Data, &cm); err != nil {
-				continue // skip malformed messages
-			}
+// Start begins consuming the subscription and watching topic peers,
+// feeding everything to the broker until ctx is done. Call it once,
+// after the first Subscribe so early messages aren't missed.
+func (c *Chat) Start(ctx context.Context) {
+	go c.readLoop(ctx)
+	go c.watchPeers(ctx)
+	go c.watchFloods(ctx)
+}
 
-			select {
-			case ch <- cm:
-			case <-ctx.Done():
+// Subscribe registers a consumer of chat events. Messages from self are
+// never delivered, except our own queued messages, which are sent again
+// once delivered from the outbox with Pending cleared.
+func (c *Chat) Subscribe(opts SubscribeOptions) *Subscription {
+	return c.broker.Subscribe(opts)
+}
+
+// Dropped returns how many event deliveries were lost to slow subscribers.
+func (c *Chat) Dropped() uint64 {
+	return c.broker.Dropped()
+}
+
+// Self returns our own peer ID.
+func (c *Chat) Self() peer.ID {
+	return c.self
+}
+
+// Room returns the name of the room (topic) this chat is on.
+func (c *Chat) Room() string {
+	return c.topic.String()
+}
+
+// watchPeers flushes the outbox whenever a peer joins the topic.
+func (c *Chat) watchPeers(ctx context.Context) {
+	events, err := c.topic.EventHandler()
+	if err != nil {
+		return
+	}
+	defer events.Cancel()
+
+	go func() {
+		for {
+			ev, err := events.NextPeerEvent(ctx)
+			if err != nil {
 				return
 			}
+			switch ev.Type {
+			case pubsub.PeerJoin:
+				c.announce(ctx)
+				c.kickOutbox()
+			case pubsub.PeerLeave:
+				c.mu.Lock()
+				delete(c.caps, ev.Peer)
+				delete(c.names, ev.Peer)
+				c.mu.Unlock()
+			}
 		}
 	}()
 
-	return ch
+	for {
+		select {
+		case <-c.flush:
+		case <-ctx.Done():
+			return
+		}
+
+		for _, msg := range c.flushOutbox(ctx) {
+			c.broker.Publish(ctx, Event{
+				Kind:    wire.KindChat,
+				Room:    c.Room(),
+				From:    c.self,
+				Message: msg,
+			})
+		}
+	}
+}
+
+func (c *Chat) kickOutbox() {
+	select {
+	case c.flush <- struct{}{}:
+	default:
+	}
+}
+
+// flushOutbox publishes queued messages and returns the ones delivered.
+// Anything that fails to publish stays queued for the next peer.
+func (c *Chat) flushOutbox(ctx context.Context) []ChatMessage {
+	entries := c.outbox.take()
+	var sent []ChatMessage
+	for i, e := range entries {
+		if err := c.publishFrames(ctx, e.frames); err != nil {
+			c.outbox.requeue(entries[i:])
+			break
+		}
+		sent = append(sent, e.msg)
+	}
+	return sent
 }
 
 // PeerCount returns the number of peers currently in the topic.
 func (c *Chat) PeerCount() int {
 	return len(c.topic.ListPeers())
 }
+
+// Peers returns the peers currently in the topic.
+func (c *Chat) Peers() []peer.ID {
+	return c.topic.ListPeers()
+}
+
+// PeerName returns the display name id last used in the room, if it
+// has told us one.
+func (c *Chat) PeerName(id peer.ID) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name, ok := c.names[id]
+	return name, ok
+}
@@ -0,0 +1,186 @@
+package chat
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+const (
+	// chunkTTL is how long a partially received message is kept.
+	chunkTTL = 2 * time.Minute
+
+	// maxPartialsPerPeer bounds how many messages one peer can have
+	// half-delivered at once.
+	maxPartialsPerPeer = 4
+)
+
+// ErrMessageTooLarge is returned when content exceeds the configured
+// maximum message size, on send or after reassembly on receive.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// frames encodes a chat payload as one or more envelopes. Small payloads
+// go out as a single KindChat envelope; large ones are compressed and,
+// if still too big, split into KindChunk envelopes. Without chunk, for
+// peers that don't understand chunks, anything that fits one frame is
+// sent as is.
+func frames(id string, payload []byte, chunk bool) ([][]byte, error) {
+	if len(payload) <= compressThreshold || (!chunk && len(payload) <= maxFrameSize) {
+		return [][]byte{wire.New(wire.KindChat, payload).Marshal()}, nil
+	}
+
+	compressed, err := deflate(payload)
+	if err != nil {
+		return nil, fmt.Errorf("compressing message: %w", err)
+	}
+
+	total := (len(compressed) + maxFrameSize - 1) / maxFrameSize
+	out := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := min((i+1)*maxFrameSize, len(compressed))
+		c := wire.Chunk{
+			ID:    id,
+			Index: uint32(i),
+			Total: uint32(total),
+			Data:  compressed[i*maxFrameSize : end],
+		}
+		out = append(out, wire.New(wire.KindChunk, c.Marshal()).Marshal())
+	}
+	return out, nil
+}
+
+func deflate(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inflate decompresses b, refusing to produce more than limit bytes so
+// a small hostile chunk can't expand into gigabytes.
+func inflate(b []byte, limit int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(b))
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, ErrMessageTooLarge
+	}
+	return out, nil
+}
+
+type partialKey struct {
+	from peer.ID
+	id   string
+}
+
+type partial struct {
+	parts   [][]byte
+	got     int
+	size    int
+	started time.Time
+}
+
+// reassembler collects chunks until a message is complete.
+type reassembler struct {
+	mu       sync.Mutex
+	partials map[partialKey]*partial
+	maxSize  int
+}
+
+func newReassembler(maxSize int) *reassembler {
+	return &reassembler{
+		partials: make(map[partialKey]*partial),
+		maxSize:  maxSize,
+	}
+}
+
+// add stores a chunk and returns the decompressed payload once every
+// chunk of the message has arrived.
+func (r *reassembler) add(from peer.ID, c wire.Chunk) ([]byte, bool, error) {
+	if c.Total == 0 || c.Index >= c.Total {
+		return nil, false, fmt.Errorf("chunk %d of %d is out of range", c.Index, c.Total)
+	}
+	// Compressed data never legitimately needs more frames than the
+	// uncompressed limit would, so reject absurd totals up front.
+	if int(c.Total) > r.maxSize/maxFrameSize+1 {
+		return nil, false, fmt.Errorf("%w: %d chunks", ErrMessageTooLarge, c.Total)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire()
+
+	key := partialKey{from: from, id: c.ID}
+	p, ok := r.partials[key]
+	if !ok {
+		if r.pendingFrom(from) >= maxPartialsPerPeer {
+			return nil, false, fmt.Errorf("too many partial messages in flight")
+		}
+		p = &partial{parts: make([][]byte, c.Total), started: time.Now()}
+		r.partials[key] = p
+	}
+	if int(c.Total) != len(p.parts) {
+		delete(r.partials, key)
+		return nil, false, fmt.Errorf("chunk total changed mid-message")
+	}
+	if p.parts[c.Index] != nil {
+		return nil, false, nil // duplicate
+	}
+
+	p.parts[c.Index] = c.Data
+	p.got++
+	p.size += len(c.Data)
+	if p.size > r.maxSize {
+		delete(r.partials, key)
+		return nil, false, fmt.Errorf("%w: over %d bytes", ErrMessageTooLarge, r.maxSize)
+	}
+	if p.got < len(p.parts) {
+		return nil, false, nil
+	}
+
+	delete(r.partials, key)
+	payload, err := inflate(bytes.Join(p.parts, nil), r.maxSize+compressThreshold)
+	if err != nil {
+		return nil, false, fmt.Errorf("decompressing message: %w", err)
+	}
+	return payload, true, nil
+}
+
+func (r *reassembler) pendingFrom(from peer.ID) int {
+	n := 0
+	for k := range r.partials {
+		if k.from == from {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *reassembler) expire() {
+	for k, p := range r.partials {
+		if time.Since(p.started) > chunkTTL {
+			delete(r.partials, k)
+		}
+	}
+}
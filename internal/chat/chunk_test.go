@@ -0,0 +1,165 @@
+package chat
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	payload := make([]byte, 2*maxFrameSize+100) // random, so it won't compress to one frame
+	rand.Read(payload)
+
+	envs, err := frames("big", payload, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) < 2 {
+		t.Fatalf("%d frames, want several", len(envs))
+	}
+
+	r := newReassembler(DefaultMaxMessageSize)
+	for i := len(envs) - 1; i >= 0; i-- { // out of order
+		if len(envs[i]) > maxFrameSize+frameOverhead {
+			t.Fatalf("frame %d is %d bytes", i, len(envs[i]))
+		}
+		env, err := wire.Unmarshal(envs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := wire.UnmarshalChunk(env.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, done, err := r.add("peer", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done != (i == 0) {
+			t.Fatalf("chunk %d: done = %v", i, done)
+		}
+		if done && !bytes.Equal(got, payload) {
+			t.Fatal("reassembled payload differs")
+		}
+	}
+	if len(r.partials) != 0 {
+		t.Fatalf("%d partials left", len(r.partials))
+	}
+}
+
+func TestChunkLimits(t *testing.T) {
+	const maxSize = 4 * maxFrameSize
+	tooMany := uint32(maxSize/maxFrameSize + 2)
+
+	tests := []struct {
+		name    string
+		chunks  []wire.Chunk
+		wantErr error // from the last chunk; nil for any error
+	}{
+		{name: "no chunks", chunks: []wire.Chunk{{ID: "a", Index: 0, Total: 0}}},
+		{name: "index out of range", chunks: []wire.Chunk{{ID: "a", Index: 2, Total: 2}}},
+		{name: "absurd total", chunks: []wire.Chunk{{ID: "a", Index: 0, Total: tooMany}}, wantErr: ErrMessageTooLarge},
+		{
+			name: "total changed mid-message",
+			chunks: []wire.Chunk{
+				{ID: "a", Index: 0, Total: 2, Data: []byte("x")},
+				{ID: "a", Index: 1, Total: 3, Data: []byte("y")},
+			},
+		},
+		{
+			name: "over the size limit",
+			chunks: []wire.Chunk{
+				{ID: "a", Index: 0, Total: 5, Data: make([]byte, maxSize)},
+				{ID: "a", Index: 1, Total: 5, Data: []byte("y")},
+			},
+			wantErr: ErrMessageTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReassembler(maxSize)
+			var err error
+			for _, c := range tt.chunks {
+				_, _, err = r.add("peer", c)
+			}
+			if err == nil {
+				t.Fatal("add accepted a bad chunk")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("add = %v, want %v", err, tt.wantErr)
+			}
+			if len(r.partials) != 0 {
+				t.Fatalf("%d partials kept after a bad message", len(r.partials))
+			}
+		})
+	}
+}
+
+func TestChunkDuplicate(t *testing.T) {
+	r := newReassembler(DefaultMaxMessageSize)
+	c := wire.Chunk{ID: "a", Index: 0, Total: 2, Data: []byte("x")}
+	for range 2 {
+		if _, done, err := r.add("peer", c); done || err != nil {
+			t.Fatalf("add = %v, %v", done, err)
+		}
+	}
+	if p := r.partials[partialKey{from: "peer", id: "a"}]; p == nil || p.got != 1 {
+		t.Fatal("duplicate chunk counted twice")
+	}
+}
+
+func TestChunkPartialsPerPeer(t *testing.T) {
+	r := newReassembler(DefaultMaxMessageSize)
+	start := func(from peer.ID, id string) error {
+		_, _, err := r.add(from, wire.Chunk{ID: id, Index: 0, Total: 2, Data: []byte("x")})
+		return err
+	}
+
+	for i := range maxPartialsPerPeer {
+		if err := start("flood", string(rune('a'+i))); err != nil {
+			t.Fatalf("partial %d: %v", i, err)
+		}
+	}
+	if err := start("flood", "z"); err == nil {
+		t.Fatal("accepted more partials than maxPartialsPerPeer")
+	}
+	if err := start("other", "a"); err != nil {
+		t.Fatalf("another peer's partial refused: %v", err)
+	}
+
+	// Once they expire, the peer may start again
+	for _, p := range r.partials {
+		p.started = time.Now().Add(-chunkTTL - time.Second)
+	}
+	if err := start("flood", "z"); err != nil {
+		t.Fatalf("partial after expiry: %v", err)
+	}
+	if len(r.partials) != 1 {
+		t.Fatalf("%d partials after expiry, want 1", len(r.partials))
+	}
+}
+
+func TestInflateLimit(t *testing.T) {
+	bomb, err := deflate(make([]byte, 1<<20)) // a megabyte of zeros deflates to almost nothing
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inflate(bomb, 1<<10); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("inflate = %v, want ErrMessageTooLarge", err)
+	}
+	if out, err := inflate(bomb, 1<<20); err != nil || len(out) != 1<<20 {
+		t.Fatalf("inflate at the limit = %d bytes, %v", len(out), err)
+	}
+
+	r := newReassembler(1 << 10)
+	_, _, err = r.add("peer", wire.Chunk{ID: "a", Index: 0, Total: 1, Data: bomb})
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("add = %v, want ErrMessageTooLarge", err)
+	}
+}
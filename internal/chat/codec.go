@@ -0,0 +1,122 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// DecodeError describes an incoming message that could not be decoded.
+type DecodeError struct {
+	From peer.ID
+	Err  error
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("message from %s: %v", shortID(e.From), e.Err)
+}
+
+func (e DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// encodeMessage wraps a chat message in one or more wire envelopes.
+func encodeMessage(msg ChatMessage, chunk bool) ([][]byte, error) {
+	payload := wire.Chat{
+		ID:         msg.ID,
+		Sender:     msg.Sender,
+		Content:    msg.Content,
+		Timestamp:  msg.Timestamp,
+		HLCWall:    msg.HLC.Wall,
+		HLCLogical: msg.HLC.Logical,
+	}
+	if a := msg.Attachment; a != nil {
+		payload.Attachment = &wire.Attachment{
+			Hash:      a.Hash,
+			Name:      a.Name,
+			Size:      uint64(a.Size),
+			Mime:      a.Mime,
+			Thumbnail: a.Thumbnail,
+			Preview:   a.Preview,
+		}
+	}
+	for _, m := range msg.Mentions {
+		payload.Mentions = append(payload.Mentions, wire.Mention{Peer: []byte(m.Peer), Name: m.Name})
+	}
+	return frames(msg.ID, payload.Marshal(), chunk)
+}
+
+// decodeMessage turns a chat payload back into a ChatMessage.
+func decodeMessage(payload []byte) (ChatMessage, error) {
+	p, err := wire.UnmarshalChat(payload)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	cm := ChatMessage{
+		ID:        p.ID,
+		Sender:    p.Sender,
+		Content:   p.Content,
+		Timestamp: p.Timestamp,
+		HLC:       HLC{Wall: p.HLCWall, Logical: p.HLCLogical},
+	}
+	if a := p.Attachment; a != nil {
+		cm.Attachment = &Attachment{Hash: a.Hash, Name: a.Name, Size: int64(a.Size), Mime: a.Mime, Thumbnail: a.Thumbnail, Preview: a.Preview}
+	}
+	for _, m := range p.Mentions[:min(len(p.Mentions), MaxMentions)] {
+		id, err := peer.IDFromBytes(m.Peer)
+		if err != nil {
+			continue // not worth dropping the message for
+		}
+		cm.Mentions = append(cm.Mentions, Mention{Peer: id, Name: m.Name})
+	}
+	return cm, nil
+}
+
+// validate holds a decoded message to the limits, whichever encoding it
+// came in: content over maxSize is an error, and oversized thumbnails,
+// previews and mentions are dropped or cut rather than losing the
+// message over them.
+func validate(cm ChatMessage, maxSize int) (ChatMessage, error) {
+	if len(cm.Content) > maxSize {
+		return cm, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(cm.Content))
+	}
+	if a := cm.Attachment; a != nil {
+		v := *a
+		if len(v.Thumbnail) > MaxThumbnailSize {
+			v.Thumbnail = nil
+		}
+		v.Preview = strings.ToValidUTF8(v.Preview[:min(len(v.Preview), MaxPreviewSize)], "")
+		cm.Attachment = &v
+	}
+	mentions := cm.Mentions[:min(len(cm.Mentions), MaxMentions)]
+	cm.Mentions = nil
+	for _, m := range mentions {
+		if m.Peer == "" || len(m.Name) > maxMentionName {
+			continue
+		}
+		cm.Mentions = append(cm.Mentions, Mention{Peer: m.Peer, Name: strings.ToValidUTF8(m.Name, "")})
+	}
+	return cm, nil
+}
+
+// decodeLegacy reads the bare JSON ChatMessage sent by clients that
+// predate the envelope. Kept for a transition window.
+func decodeLegacy(data []byte) (ChatMessage, error) {
+	var cm ChatMessage
+	if err := json.Unmarshal(data, &cm); err != nil {
+		return cm, fmt.Errorf("decoding legacy message: %w", err)
+	}
+	return cm, nil
+}
+
+func shortID(id peer.ID) string {
+	s := id.String()
+	if len(s) > 8 {
+		return s[len(s)-8:]
+	}
+	return s
+}
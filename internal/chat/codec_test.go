@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestLegacyValidated(t *testing.T) {
+	legacy := func(cm ChatMessage) ChatMessage {
+		t.Helper()
+		data, err := json.Marshal(cm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cm, err = decodeLegacy(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cm
+	}
+
+	big := legacy(ChatMessage{Sender: "eve", Content: strings.Repeat("x", 101)})
+	if _, err := validate(big, 100); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("validate = %v, want ErrMessageTooLarge", err)
+	}
+
+	msg := ChatMessage{
+		Sender:  "eve",
+		Content: "hi",
+		Attachment: &Attachment{
+			Hash:      "ab12",
+			Thumbnail: make([]byte, MaxThumbnailSize+1),
+			Preview:   strings.Repeat("p", MaxPreviewSize+1),
+		},
+	}
+	for range MaxMentions + 1 {
+		id, err := test.RandPeerID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Mentions = append(msg.Mentions, Mention{Peer: id, Name: "bob"})
+	}
+	msg.Mentions[0].Name = strings.Repeat("n", maxMentionName+1)
+
+	got, err := validate(legacy(msg), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Attachment.Thumbnail != nil {
+		t.Error("oversized thumbnail kept")
+	}
+	if len(got.Attachment.Preview) != MaxPreviewSize {
+		t.Errorf("preview is %d bytes, want %d", len(got.Attachment.Preview), MaxPreviewSize)
+	}
+	if len(got.Mentions) != MaxMentions-1 {
+		t.Errorf("kept %d mentions, want %d", len(got.Mentions), MaxMentions-1)
+	}
+}
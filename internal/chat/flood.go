@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+const (
+	// floodQuiet is how long a peer has to stay within its limit before
+	// further drops start a new "hidden" line rather than adding to the
+	// last one.
+	floodQuiet = 30 * time.Second
+
+	// floodInterval is how often a growing hidden count is republished,
+	// so a flood doesn't turn into a flood of updates.
+	floodInterval = time.Second
+)
+
+// flood tracks the frames dropped from one peer in one episode.
+type flood struct {
+	id     string
+	stamp  HLC
+	hidden int
+	last   time.Time
+	dirty  bool
+}
+
+// hide counts a dropped frame from a peer. The first drop of an episode
+// is shown straight away; later ones are batched by watchFloods.
+func (c *Chat) hide(ctx context.Context, from peer.ID) {
+	now := time.Now()
+
+	c.mu.Lock()
+	f, ok := c.floods[from]
+	if !ok || now.Sub(f.last) > floodQuiet {
+		f = &flood{id: "hidden-" + rand.Text(), stamp: c.clock.Now()}
+		c.floods[from] = f
+	}
+	f.hidden++
+	f.last = now
+	first := f.hidden == 1
+	f.dirty = !first
+	msg := c.floodMessage(from, f)
+	c.mu.Unlock()
+
+	if first {
+		c.publishFlood(ctx, msg)
+	}
+}
+
+// watchFloods republishes hidden counts that have grown and forgets
+// peers that have calmed down.
+func (c *Chat) watchFloods(ctx context.Context) {
+	ticker := time.NewTicker(floodInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		now := time.Now()
+		var updates []ChatMessage
+		c.mu.Lock()
+		for id, f := range c.floods {
+			if f.dirty {
+				f.dirty = false
+				updates = append(updates, c.floodMessage(id, f))
+			} else if now.Sub(f.last) > floodQuiet {
+				delete(c.floods, id)
+			}
+		}
+		c.mu.Unlock()
+
+		for _, msg := range updates {
+			c.publishFlood(ctx, msg)
+		}
+		c.limiter.prune()
+	}
+}
+
+// floodMessage builds the placeholder line standing in for the frames
+// hidden from a peer. The ID stays the same for the whole episode, so
+// subscribers replace the line in place as the count grows. c.mu must
+// be held.
+func (c *Chat) floodMessage(from peer.ID, f *flood) ChatMessage {
+	name, ok := c.names[from]
+	if !ok {
+		name = shortID(from)
+	}
+	noun := "messages"
+	if f.hidden == 1 {
+		noun = "message"
+	}
+
+	msg := NewChatMessage(name, fmt.Sprintf("%d %s hidden from %s", f.hidden, noun, name), f.stamp)
+	msg.ID = f.id
+	msg.From = from
+	msg.Hidden = f.hidden
+	return msg
+}
+
+func (c *Chat) publishFlood(ctx context.Context, msg ChatMessage) {
+	c.broker.Publish(ctx, Event{
+		Kind:    wire.KindChat,
+		Room:    c.Room(),
+		From:    msg.From,
+		Message: msg,
+	})
+}
@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// MaxClockSkew is how far a peer's wall clock may drift from ours before
+// its messages are flagged as skewed. Stamps further ahead than this are
+// not adopted by our clock, so one bad laptop can't drag everyone forward.
+const MaxClockSkew = 2 * time.Minute
+
+// HLC is a hybrid logical clock stamp: wall-clock milliseconds plus a
+// logical counter that orders events sharing the same millisecond.
+type HLC struct {
+	Wall    int64  `json:"wall"`
+	Logical uint32 `json:"logical"`
+}
+
+// IsZero reports whether the stamp is unset (e.g. from a legacy client).
+func (h HLC) IsZero() bool {
+	return h.Wall == 0 && h.Logical == 0
+}
+
+// Compare returns -1, 0 or +1 depending on whether h is before, equal to
+// or after o.
+func (h HLC) Compare(o HLC) int {
+	switch {
+	case h.Wall < o.Wall:
+		return -1
+	case h.Wall > o.Wall:
+		return 1
+	case h.Logical < o.Logical:
+		return -1
+	case h.Logical > o.Logical:
+		return 1
+	}
+	return 0
+}
+
+// Time returns the wall-clock component as a time.Time.
+func (h HLC) Time() time.Time {
+	return time.UnixMilli(h.Wall)
+}
+
+// Clock issues HLC stamps for local events and merges stamps seen on
+// incoming messages so that causally later messages always sort later.
+type Clock struct {
+	mu      sync.Mutex
+	last    HLC
+	physNow func() time.Time
+}
+
+// NewClock returns a clock driven by the system wall clock.
+func NewClock() *Clock {
+	return &Clock{physNow: time.Now}
+}
+
+// Now returns a stamp for a local event, strictly after every stamp
+// previously issued or observed.
+func (c *Clock) Now() HLC {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pt := c.physNow().UnixMilli()
+	if pt > c.last.Wall {
+		c.last = HLC{Wall: pt}
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Update merges a remote stamp into the clock and returns how far the
+// remote wall clock is ahead of ours (negative if behind). Remote stamps
+// more than MaxClockSkew in the future are not adopted.
+func (c *Clock) Update(remote HLC) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pt := c.physNow().UnixMilli()
+	skew := time.Duration(remote.Wall-pt) * time.Millisecond
+	if remote.IsZero() {
+		return 0
+	}
+	if skew > MaxClockSkew {
+		remote = HLC{Wall: pt}
+	}
+
+	switch {
+	case pt > c.last.Wall && pt > remote.Wall:
+		c.last = HLC{Wall: pt}
+	case remote.Wall > c.last.Wall:
+		c.last = HLC{Wall: remote.Wall, Logical: remote.Logical + 1}
+	case c.last.Wall > remote.Wall:
+		c.last.Logical++
+	default:
+		if remote.Logical > c.last.Logical {
+			c.last.Logical = remote.Logical
+		}
+		c.last.Logical++
+	}
+	return skew
+}
@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+// fixedClock returns a clock whose physical time is whatever *now holds,
+// in milliseconds.
+func fixedClock(now *int64) *Clock {
+	return &Clock{physNow: func() time.Time { return time.UnixMilli(*now) }}
+}
+
+func TestClockNow(t *testing.T) {
+	var now int64
+	c := fixedClock(&now)
+
+	steps := []struct {
+		phys int64
+		want HLC
+	}{
+		{phys: 1000, want: HLC{Wall: 1000}},
+		{phys: 1000, want: HLC{Wall: 1000, Logical: 1}}, // same millisecond
+		{phys: 999, want: HLC{Wall: 1000, Logical: 2}},  // wall clock stepped back
+		{phys: 1001, want: HLC{Wall: 1001}},
+	}
+	var prev HLC
+	for i, s := range steps {
+		now = s.phys
+		got := c.Now()
+		if got != s.want {
+			t.Fatalf("step %d: Now() = %+v, want %+v", i, got, s.want)
+		}
+		if got.Compare(prev) <= 0 {
+			t.Fatalf("step %d: %+v is not after %+v", i, got, prev)
+		}
+		prev = got
+	}
+}
+
+func TestClockUpdate(t *testing.T) {
+	tooFar := 1000 + (MaxClockSkew + time.Minute).Milliseconds()
+
+	tests := []struct {
+		name     string
+		last     HLC
+		phys     int64
+		remote   HLC
+		want     HLC
+		wantSkew time.Duration
+	}{
+		{
+			name: "our wall clock is ahead of both",
+			last: HLC{Wall: 1000, Logical: 3}, phys: 2000, remote: HLC{Wall: 1500},
+			want: HLC{Wall: 2000}, wantSkew: -500 * time.Millisecond,
+		},
+		{
+			name: "remote is ahead",
+			last: HLC{Wall: 1000}, phys: 1000, remote: HLC{Wall: 1500, Logical: 4},
+			want: HLC{Wall: 1500, Logical: 5}, wantSkew: 500 * time.Millisecond,
+		},
+		{
+			name: "our last stamp is ahead",
+			last: HLC{Wall: 2000, Logical: 2}, phys: 1000, remote: HLC{Wall: 1500, Logical: 9},
+			want: HLC{Wall: 2000, Logical: 3}, wantSkew: 500 * time.Millisecond,
+		},
+		{
+			name: "same wall, remote counter higher",
+			last: HLC{Wall: 1500, Logical: 2}, phys: 1000, remote: HLC{Wall: 1500, Logical: 7},
+			want: HLC{Wall: 1500, Logical: 8}, wantSkew: 500 * time.Millisecond,
+		},
+		{
+			name: "same wall, our counter higher",
+			last: HLC{Wall: 1500, Logical: 9}, phys: 1000, remote: HLC{Wall: 1500, Logical: 2},
+			want: HLC{Wall: 1500, Logical: 10}, wantSkew: 500 * time.Millisecond,
+		},
+		{
+			name: "too far ahead to adopt",
+			last: HLC{Wall: 1000}, phys: 1000, remote: HLC{Wall: tooFar},
+			want: HLC{Wall: 1000, Logical: 1}, wantSkew: MaxClockSkew + time.Minute,
+		},
+		{
+			name: "legacy stamp",
+			last: HLC{Wall: 1000, Logical: 1}, phys: 5000, remote: HLC{},
+			want: HLC{Wall: 1000, Logical: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.phys
+			c := fixedClock(&now)
+			c.last = tt.last
+			if skew := c.Update(tt.remote); skew != tt.wantSkew {
+				t.Errorf("skew = %v, want %v", skew, tt.wantSkew)
+			}
+			if c.last != tt.want {
+				t.Errorf("clock = %+v, want %+v", c.last, tt.want)
+			}
+			if next := c.Now(); next.Compare(tt.want) <= 0 {
+				t.Errorf("Now() = %+v after Update, not after %+v", next, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeClock(t *testing.T) {
+	const phys = 10_000_000
+	far := (MaxClockSkew + time.Minute).Milliseconds()
+
+	tests := []struct {
+		name       string
+		stamp      HLC
+		wantSkewed bool
+		wantStamp  HLC
+		restamped  bool
+	}{
+		{name: "in step", stamp: HLC{Wall: phys - 50, Logical: 1}, wantStamp: HLC{Wall: phys - 50, Logical: 1}},
+		{name: "far behind", stamp: HLC{Wall: phys - far}, wantSkewed: true, wantStamp: HLC{Wall: phys - far}},
+		{name: "far ahead", stamp: HLC{Wall: phys + far}, wantSkewed: true, restamped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := int64(phys)
+			c := &Chat{clock: fixedClock(&now)}
+			msg := NewChatMessage("ann", "hi", tt.stamp)
+			c.mergeClock(&msg)
+
+			if msg.Skewed != tt.wantSkewed {
+				t.Errorf("Skewed = %v, want %v", msg.Skewed, tt.wantSkewed)
+			}
+			if tt.restamped {
+				// Ordered by when it arrived, after anything stamped before
+				if msg.HLC.Wall != phys || msg.Timestamp != phys/1000 {
+					t.Errorf("restamped to %+v (%d), want wall %d", msg.HLC, msg.Timestamp, phys)
+				}
+				if c.clock.last.Wall != phys {
+					t.Errorf("clock moved to %+v", c.clock.last)
+				}
+				return
+			}
+			if msg.HLC != tt.wantStamp {
+				t.Errorf("stamp = %+v, want %+v", msg.HLC, tt.wantStamp)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// MaxMentions bounds the mentions kept from a message; the rest are
+// dropped on receipt.
+const MaxMentions = 32
+
+// maxMentionName bounds the name a received mention can carry.
+const maxMentionName = 256
+
+// Mention is someone a message names as @name.
+type Mention struct {
+	Peer peer.ID `json:"peer"`
+	Name string  `json:"name"` // as written after the @
+}
+
+// Mentioned reports whether msg mentions id. The mention only counts if
+// its @name is in the content, so a sender can't notify someone without
+// it showing.
+func (m ChatMessage) Mentioned(id peer.ID) bool {
+	return slices.ContainsFunc(m.Mentions, func(mention Mention) bool {
+		return mention.Peer == id && written(m.Content, mention.Name)
+	})
+}
+
+// written reports whether content has @name in it, as ParseMentions
+// would find it.
+func written(content, name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '@' && mentionAt(content, i, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionAt reports whether the @ at content[i] starts a mention of
+// name: not part of an address, and not the start of a longer word.
+func mentionAt(content string, i int, name string) bool {
+	if r, _ := utf8.DecodeLastRuneInString(content[:i]); i > 0 && isNameRune(r) {
+		return false // an address like ann@example.com
+	}
+	rest := content[i+1:]
+	if len(name) > len(rest) || !strings.EqualFold(rest[:len(name)], name) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(rest[len(name):])
+	return !isNameRune(r)
+}
+
+// ParseMentions finds @name mentions in content of the peers in names,
+// which maps each to its display name. Names match case-insensitively
+// and the longest wins, so "@Ann Lee" isn't read as "@Ann". Peers that
+// share a name are all mentioned; each peer is mentioned once.
+func ParseMentions(content string, names map[peer.ID]string) []Mention {
+	var mentions []Mention
+	seen := make(map[peer.ID]bool)
+	for i := 0; i < len(content) && len(mentions) < MaxMentions; i++ {
+		if content[i] != '@' {
+			continue
+		}
+
+		rest := content[i+1:]
+		var best string
+		var ids []peer.ID
+		for id, name := range names {
+			if name == "" || len(name) < len(best) || !mentionAt(content, i, name) {
+				continue
+			}
+			if len(name) > len(best) {
+				best, ids = name, nil
+			}
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				mentions = append(mentions, Mention{Peer: id, Name: rest[:len(best)]})
+			}
+		}
+		i += len(best)
+	}
+	return mentions[:min(len(mentions), MaxMentions)]
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
@@ -1,24 +1,108 @@
 package chat
 
-import "time"
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
 
 // ChatMessage is the JSON structure sent over the wire.
 type ChatMessage struct {
+	ID        string `json:"id,omitempty"`
 	Sender    string `json:"sender"`
 	Content   string `json:"content"`
-	Timestamp int64  `json:"timestamp"`
+	Timestamp int64  `json:"timestamp"` // unix seconds, kept for older clients
+	HLC       HLC    `json:"hlc"`
+
+	// Attachment is set when the message offers a file.
+	Attachment *Attachment `json:"attachment,omitempty"`
+
+	// Mentions lists who the content names as @name.
+	Mentions []Mention `json:"mentions,omitempty"`
+
+	// From is the peer that authored the message, filled in on receipt
+	// from the signed pubsub envelope rather than trusted from the payload.
+	From peer.ID `json:"from,omitempty"`
+
+	// Skewed is set on receipt when the sender's clock is off by more
+	// than MaxClockSkew. It is never trusted from the wire. Messages from
+	// clocks that far ahead are restamped with when they arrived.
+	Skewed bool `json:"skewed,omitempty"`
+
+	// Pending marks our own messages that are queued in the outbox
+	// because nobody was connected when they were sent.
+	Pending bool `json:"pending,omitempty"`
+
+	// Hidden is set on the placeholder standing in for messages dropped
+	// from a peer that is flooding the room, and counts them. It is never
+	// trusted from the wire.
+	Hidden int `json:"hidden,omitempty"`
 }
 
-// NewChatMessage creates a new message with the current timestamp.
-func NewChatMessage(sender, content string) ChatMessage {
+// NewChatMessage creates a new message stamped with the given clock value.
+func NewChatMessage(sender, content string, stamp HLC) ChatMessage {
 	return ChatMessage{
+		ID:        rand.Text(),
 		Sender:    sender,
 		Content:   content,
-		Timestamp: time.Now().Unix(),
+		Timestamp: stamp.Wall / 1000,
+		HLC:       stamp,
 	}
 }
 
 // Time returns the message timestamp as a time.Time.
 func (m ChatMessage) Time() time.Time {
-	return time.Unix(m.Timestamp, 0)
+	if m.HLC.IsZero() {
+		return time.Unix(m.Timestamp, 0)
+	}
+	return m.HLC.Time()
+}
+
+// stamp returns the ordering key, falling back to the legacy seconds
+// field for messages from clients that predate HLC stamps.
+func (m ChatMessage) stamp() HLC {
+	if m.HLC.IsZero() {
+		return HLC{Wall: m.Timestamp * 1000}
+	}
+	return m.HLC
+}
+
+// Attachment describes a file offered in a message. Hash is the hex
+// BLAKE3-256 of the content and doubles as the file's ID.
+type Attachment struct {
+	Hash string `json:"hash"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Mime string `json:"mime,omitempty"`
+
+	// Thumbnail is a small JPEG preview sent with image offers.
+	Thumbnail []byte `json:"thumbnail,omitempty"`
+	// Preview is the first few lines of a text file, such as a long
+	// paste that was turned into an attachment.
+	Preview string `json:"preview,omitempty"`
+}
+
+const (
+	// MaxThumbnailSize bounds the preview carried inline with an offer.
+	// Larger thumbnails from peers are dropped rather than rendered.
+	MaxThumbnailSize = 32 << 10
+
+	// MaxPreviewSize bounds a text preview; longer ones are cut.
+	MaxPreviewSize = 2 << 10
+)
+
+// HumanSize formats a byte count for display, e.g. "1.2 MB".
+func HumanSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
 }
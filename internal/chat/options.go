@@ -0,0 +1,54 @@
+package chat
+
+// Default protocol limits. GossipSub itself refuses anything over 1 MiB,
+// so we stay well clear of that and chunk instead.
+const (
+	// DefaultMaxMessageSize caps the content of a single chat message.
+	DefaultMaxMessageSize = 256 << 10
+
+	// maxFrameSize caps a single published envelope; larger payloads are
+	// compressed and split into chunks that each fit.
+	maxFrameSize = 48 << 10
+
+	// frameOverhead allows for envelope and chunk headers around a
+	// maxFrameSize slice of data.
+	frameOverhead = 1 << 10
+
+	// MaxControlSize caps the encoded wire.Control in one control
+	// message. Anything bigger has to be split across several.
+	MaxControlSize = maxFrameSize
+
+	// compressThreshold is the payload size above which we compress.
+	compressThreshold = 4 << 10
+)
+
+// Option configures a Chat.
+type Option func(*Chat)
+
+// WithMaxMessageSize sets the largest message content, in bytes, that
+// Publish accepts and that we are willing to reassemble from peers.
+func WithMaxMessageSize(n int) Option {
+	return func(c *Chat) {
+		if n > 0 {
+			c.maxSize = n
+		}
+	}
+}
+
+// WithLimiter sets the per-peer receive limiter, e.g. one shared with
+// the GossipSub peer score. Without it a Chat uses its own limiter with
+// the default rate.
+func WithLimiter(l *Limiter) Option {
+	return func(c *Chat) {
+		c.limiter = l
+	}
+}
+
+// WithSealer encrypts the room's chat, chunk and file frames with s, and
+// requires peers' to be encrypted too. Presence and control messages
+// stay in the clear: they are needed before keys are exchanged.
+func WithSealer(s Sealer) Option {
+	return func(c *Chat) {
+		c.sealer = s
+	}
+}
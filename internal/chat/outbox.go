@@ -0,0 +1,61 @@
+package chat
+
+import (
+	"errors"
+	"sync"
+)
+
+// outboxLimit caps how many undelivered messages we hold on to.
+const outboxLimit = 256
+
+// ErrOutboxFull is returned by Publish when nobody is connected and the
+// outbox already holds outboxLimit undelivered messages.
+var ErrOutboxFull = errors.New("no peers connected and outbox is full")
+
+type outboxEntry struct {
+	msg    ChatMessage
+	frames [][]byte
+}
+
+// outbox queues messages published while the topic has no peers, so
+// they can be rebroadcast once someone joins.
+type outbox struct {
+	mu      sync.Mutex
+	entries []outboxEntry
+}
+
+func (o *outbox) add(msg ChatMessage, frames [][]byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.entries) >= outboxLimit {
+		return ErrOutboxFull
+	}
+	o.entries = append(o.entries, outboxEntry{msg: msg, frames: frames})
+	return nil
+}
+
+// take removes and returns everything queued.
+func (o *outbox) take() []outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := o.entries
+	o.entries = nil
+	return entries
+}
+
+// requeue puts entries that failed to send back at the front.
+func (o *outbox) requeue(entries []outboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.entries = append(entries, o.entries...)
+}
+
+func (o *outbox) len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.entries)
+}
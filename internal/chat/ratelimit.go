@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Default receive limits. A person typing, or pasting a long message
+// that arrives as a burst of chunks, stays well inside these.
+const (
+	DefaultReceiveRate  = 5  // frames per second, sustained
+	DefaultReceiveBurst = 40 // frames accepted back to back
+
+	// penaltyHalfLife is how quickly a peer's flood penalty is forgiven.
+	penaltyHalfLife = time.Minute
+
+	// idleBucket is how long a quiet peer's bucket is kept around.
+	idleBucket = 10 * time.Minute
+)
+
+// Limiter rate-limits incoming frames per peer with a token bucket and
+// remembers who has been dropped recently, so GossipSub can score them
+// down and eventually stop relaying their traffic to us.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu    sync.Mutex
+	peers map[peer.ID]*bucket
+}
+
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	penalty float64 // dropped frames, decaying with penaltyHalfLife
+	decayed time.Time
+}
+
+// NewLimiter returns a limiter allowing rate frames per second from each
+// peer, with bursts of up to burst frames.
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:  rate,
+		burst: float64(burst),
+		now:   time.Now,
+		peers: make(map[peer.ID]*bucket),
+	}
+}
+
+// Allow reports whether another frame from id may be processed now,
+// recording a penalty against the peer if not.
+func (l *Limiter) Allow(id peer.ID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.peers[id]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now, decayed: now}
+		l.peers[id] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	b.decay(now)
+	b.penalty++
+	return false
+}
+
+// Score is the application-specific GossipSub score for id: zero for
+// well-behaved peers, increasingly negative the more of their traffic
+// we have dropped recently.
+func (l *Limiter) Score(id peer.ID) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.peers[id]
+	if !ok {
+		return 0
+	}
+	b.decay(l.now())
+	return -b.penalty
+}
+
+// prune forgets peers that have been quiet long enough for their bucket
+// to refill and their penalty to fade.
+func (l *Limiter) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for id, b := range l.peers {
+		if now.Sub(b.last) > idleBucket {
+			delete(l.peers, id)
+		}
+	}
+}
+
+func (b *bucket) decay(now time.Time) {
+	if b.penalty > 0 {
+		halves := now.Sub(b.decayed).Seconds() / penaltyHalfLife.Seconds()
+		b.penalty *= math.Exp2(-halves)
+		if b.penalty < 0.01 {
+			b.penalty = 0
+		}
+	}
+	b.decayed = now
+}
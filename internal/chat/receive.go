@@ -0,0 +1,192 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// readLoop drains the subscription, decoding each message and handing
+// the resulting events to the broker.
+func (c *Chat) readLoop(ctx context.Context) {
+	for {
+		msg, err := c.sub.Next(ctx)
+		if err != nil {
+			return // context cancelled or subscription closed
+		}
+
+		// skip messages from ourselves
+		if msg.ReceivedFrom == c.self {
+			continue
+		}
+
+		// Collapse floods before paying for decoding and rendering them
+		from := msg.GetFrom()
+		if !c.limiter.Allow(from) {
+			c.hide(ctx, from)
+			continue
+		}
+
+		ev, ok := c.decode(msg)
+		if !ok {
+			continue
+		}
+		ev.Room = c.Room()
+		ev.From = from
+
+		switch ev.Kind {
+		case wire.KindPresence:
+			c.rememberName(from, ev.Name)
+		case wire.KindChat:
+			c.rememberName(from, ev.Message.Sender)
+			ev.Message.From = ev.From
+			ev.Message.Pending = false
+			ev.Message.Hidden = 0
+			c.mergeClock(&ev.Message)
+		}
+
+		c.broker.Publish(ctx, ev)
+	}
+}
+
+// mergeClock merges the sender's clock into ours and flags wild skew. A
+// stamp too far ahead would keep the message below everything sent
+// after it, so it is ordered by when it arrived instead.
+func (c *Chat) mergeClock(msg *ChatMessage) {
+	skew := c.clock.Update(msg.stamp())
+	msg.Skewed = skew > MaxClockSkew || skew < -MaxClockSkew
+	if skew > MaxClockSkew {
+		msg.HLC = c.clock.Now()
+		msg.Timestamp = msg.HLC.Wall / 1000
+	}
+}
+
+// decode unwraps an incoming pubsub message into an event. It returns
+// false for anything that isn't (yet) something to show: undecodable
+// data, partial chunks and kinds we don't understand.
+func (c *Chat) decode(msg *pubsub.Message) (Event, bool) {
+	from := msg.GetFrom()
+
+	if len(msg.Data) > maxFrameSize+frameOverhead {
+		c.reportError(DecodeError{From: from, Err: fmt.Errorf("%w: %d byte frame", ErrMessageTooLarge, len(msg.Data))})
+		return Event{}, false
+	}
+
+	env, err := wire.Unmarshal(msg.Data)
+	if c.sealer != nil {
+		env, err = c.open(from, env, err)
+	}
+	if errors.Is(err, wire.ErrLegacyJSON) {
+		cm, err := decodeLegacy(msg.Data)
+		if err == nil {
+			cm, err = validate(cm, c.maxSize)
+		}
+		if err != nil {
+			c.reportError(DecodeError{From: from, Err: err})
+			return Event{}, false
+		}
+		return Event{Kind: wire.KindChat, Message: cm}, true
+	}
+	if err != nil {
+		c.reportError(DecodeError{From: from, Err: err})
+		return Event{}, false
+	}
+
+	switch env.Kind {
+	case wire.KindChat:
+		return c.decodeChat(from, env.Payload)
+
+	case wire.KindChunk:
+		chunk, err := wire.UnmarshalChunk(env.Payload)
+		if err != nil {
+			c.reportError(DecodeError{From: from, Err: err})
+			return Event{}, false
+		}
+		payload, done, err := c.reasm.add(from, chunk)
+		if err != nil {
+			c.reportError(DecodeError{From: from, Err: err})
+			return Event{}, false
+		}
+		if !done {
+			return Event{}, false
+		}
+		return c.decodeChat(from, payload)
+
+	case wire.KindPresence:
+		p, err := wire.UnmarshalPresence(env.Payload)
+		if err != nil {
+			c.reportError(DecodeError{From: from, Err: err})
+			return Event{}, false
+		}
+		c.mu.Lock()
+		c.caps[from] = p.Kinds
+		c.mu.Unlock()
+		return Event{Kind: wire.KindPresence, Name: p.Name}, true
+
+	case wire.KindControl:
+		ctl, err := wire.UnmarshalControl(env.Payload)
+		if err != nil {
+			c.reportError(DecodeError{From: from, Err: err})
+			return Event{}, false
+		}
+		return Event{Kind: wire.KindControl, Control: ctl}, true
+
+	case wire.KindFile:
+		have, err := wire.UnmarshalFileHave(env.Payload)
+		if err != nil {
+			c.reportError(DecodeError{From: from, Err: err})
+			return Event{}, false
+		}
+		return Event{Kind: wire.KindFile, Hashes: have.Hashes}, true
+	}
+
+	// Kinds we don't understand are skipped quietly; the sender
+	// shouldn't have sent them to us if it honours our presence.
+	return Event{}, false
+}
+
+// decodeChat decodes a chat payload and enforces the limits.
+func (c *Chat) decodeChat(from peer.ID, payload []byte) (Event, bool) {
+	cm, err := decodeMessage(payload)
+	if err == nil {
+		cm, err = validate(cm, c.maxSize)
+	}
+	if err != nil {
+		c.reportError(DecodeError{From: from, Err: err})
+		return Event{}, false
+	}
+	return Event{Kind: wire.KindChat, Message: cm}, true
+}
+
+// rememberName records the display name a peer uses, for labelling
+// anything we hide from it.
+func (c *Chat) rememberName(id peer.ID, name string) {
+	if name == "" {
+		return
+	}
+	c.mu.Lock()
+	c.names[id] = name
+	c.mu.Unlock()
+}
+
+func (c *Chat) reportError(err error) {
+	select {
+	case c.errs <- err:
+	default:
+	}
+}
+
+// announce publishes our presence: display name and understood kinds.
+func (c *Chat) announce(ctx context.Context) {
+	c.mu.Lock()
+	p := wire.Presence{Name: c.name, Kinds: wire.Supported}
+	c.mu.Unlock()
+
+	data := wire.New(wire.KindPresence, p.Marshal()).Marshal()
+	_ = c.topic.Publish(ctx, data)
+}
@@ -0,0 +1,55 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// ErrNotSealed is reported for content sent in the clear to an
+// encrypted room.
+var ErrNotSealed = errors.New("unencrypted message in an encrypted room")
+
+// Sealer encrypts frames for an encrypted room. Seal returns the payload
+// of a KindSealed envelope wrapping frame; Open reverses it for a frame
+// from the given peer.
+type Sealer interface {
+	Seal(frame []byte) ([]byte, error)
+	Open(from peer.ID, payload []byte) ([]byte, error)
+}
+
+// open decrypts a sealed frame in an encrypted room, returning the
+// envelope inside. Content sent in the clear is refused, so peers
+// without the room's keys can't post to it.
+func (c *Chat) open(from peer.ID, env wire.Envelope, err error) (wire.Envelope, error) {
+	if errors.Is(err, wire.ErrLegacyJSON) {
+		return env, ErrNotSealed
+	}
+	if err != nil {
+		return env, err
+	}
+
+	switch env.Kind {
+	case wire.KindSealed:
+	case wire.KindChat, wire.KindChunk, wire.KindFile:
+		return env, ErrNotSealed
+	default:
+		return env, nil
+	}
+
+	inner, err := c.sealer.Open(from, env.Payload)
+	if err != nil {
+		return env, err
+	}
+	env, err = wire.Unmarshal(inner)
+	if err != nil {
+		return env, err
+	}
+	if env.Kind != wire.KindChat && env.Kind != wire.KindChunk && env.Kind != wire.KindFile {
+		return env, fmt.Errorf("%s frame sealed in an encrypted one", env.Kind)
+	}
+	return env, nil
+}
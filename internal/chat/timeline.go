@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Timeline holds messages in causal (HLC) order regardless of the order
+// they arrived in, and drops duplicates by message ID.
+type Timeline struct {
+	msgs []ChatMessage
+	seen map[string]struct{}
+}
+
+// NewTimeline returns an empty timeline.
+func NewTimeline() *Timeline {
+	return &Timeline{seen: make(map[string]struct{})}
+}
+
+// Insert places msg at its causal position and returns that index.
+// It returns false if a message with the same ID is already present.
+func (t *Timeline) Insert(msg ChatMessage) (int, bool) {
+	if msg.ID != "" {
+		if _, ok := t.seen[msg.ID]; ok {
+			return -1, false
+		}
+		t.seen[msg.ID] = struct{}{}
+	}
+
+	// Fast path: most messages arrive in order.
+	n := len(t.msgs)
+	if n == 0 || !before(msg, t.msgs[n-1]) {
+		t.msgs = append(t.msgs, msg)
+		return n, true
+	}
+
+	i := sort.Search(n, func(i int) bool { return before(msg, t.msgs[i]) })
+	t.msgs = append(t.msgs, ChatMessage{})
+	copy(t.msgs[i+1:], t.msgs[i:])
+	t.msgs[i] = msg
+	return i, true
+}
+
+// Replace swaps in msg for the stored message with the same ID and
+// reports whether there was one to swap. Only two kinds of message are
+// ever replaced: our own queued message once self has delivered it, and
+// a flood placeholder whose count has grown. Hidden is never trusted
+// from the wire, so a peer can't overwrite a message by reusing its ID;
+// Insert drops such repeats.
+func (t *Timeline) Replace(msg ChatMessage, self peer.ID) bool {
+	if _, ok := t.seen[msg.ID]; !ok || msg.ID == "" || msg.From == "" {
+		return false
+	}
+	for i := len(t.msgs) - 1; i >= 0; i-- {
+		if t.msgs[i].ID == msg.ID {
+			if !replaces(t.msgs[i], msg, self) {
+				return false
+			}
+			t.msgs[i] = msg
+			return true
+		}
+	}
+	return false
+}
+
+// replaces reports whether msg may take the place of old, which has the
+// same ID.
+func replaces(old, msg ChatMessage, self peer.ID) bool {
+	if old.From != msg.From {
+		return false
+	}
+	if msg.Hidden > 0 {
+		return old.Hidden > 0
+	}
+	return self != "" && msg.From == self && old.Pending
+}
+
+// RemoveFunc drops every message for which del returns true and
+// reports how many went. Their IDs stay known, so gossip repeats of them
+// are still ignored.
+func (t *Timeline) RemoveFunc(del func(ChatMessage) bool) int {
+	n := len(t.msgs)
+	t.msgs = slices.DeleteFunc(t.msgs, del)
+	return n - len(t.msgs)
+}
+
+// Len returns the number of messages in the timeline.
+func (t *Timeline) Len() int {
+	return len(t.msgs)
+}
+
+// At returns the message at index i.
+func (t *Timeline) At(i int) ChatMessage {
+	return t.msgs[i]
+}
+
+// Messages returns the ordered messages. The slice must not be modified.
+func (t *Timeline) Messages() []ChatMessage {
+	return t.msgs
+}
+
+// before orders by HLC stamp, breaking ties by message ID so every peer
+// settles on the same order.
+func before(a, b ChatMessage) bool {
+	if c := a.stamp().Compare(b.stamp()); c != 0 {
+		return c < 0
+	}
+	return strings.Compare(a.ID, b.ID) < 0
+}
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestTimelineFloodCountGrows(t *testing.T) {
+	const self, flooder = peer.ID("me"), peer.ID("flooder")
+	c := &Chat{names: map[peer.ID]string{flooder: "eve"}}
+	f := &flood{id: "hidden-1", stamp: HLC{Wall: 1000}}
+
+	tl := NewTimeline()
+	f.hidden = 1
+	if _, ok := tl.Insert(c.floodMessage(flooder, f)); !ok {
+		t.Fatal("first placeholder not inserted")
+	}
+
+	f.hidden = 7
+	update := c.floodMessage(flooder, f)
+	if _, ok := tl.Insert(update); ok {
+		t.Fatal("Insert accepted a repeated ID")
+	}
+	if !tl.Replace(update, self) {
+		t.Fatal("Replace refused a grown count")
+	}
+	if tl.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", tl.Len())
+	}
+	if got := tl.At(0); got.Hidden != 7 || got.Content != "7 messages hidden from eve" {
+		t.Fatalf("placeholder = %d %q, want 7 %q", got.Hidden, got.Content, "7 messages hidden from eve")
+	}
+}
+
+func TestTimelineReplaceRefusesOthers(t *testing.T) {
+	const self, alice, eve = peer.ID("me"), peer.ID("alice"), peer.ID("eve")
+
+	delivered := func(m ChatMessage) ChatMessage { m.Pending = false; return m }
+	stored := func(from peer.ID, pending bool, hidden int) ChatMessage {
+		m := NewChatMessage("x", "original", HLC{Wall: 1000})
+		m.ID, m.From, m.Pending, m.Hidden = "id", from, pending, hidden
+		return m
+	}
+
+	tests := []struct {
+		name   string
+		stored ChatMessage
+		msg    ChatMessage
+		want   bool
+	}{
+		{name: "own queued message delivered", stored: stored(self, true, 0), msg: delivered(stored(self, true, 0)), want: true},
+		{name: "own message already delivered", stored: stored(self, false, 0), msg: stored(self, false, 0)},
+		{name: "peer reuses our queued ID", stored: stored(self, true, 0), msg: stored(eve, false, 0)},
+		{name: "peer repeats its own message", stored: stored(alice, false, 0), msg: stored(alice, false, 0)},
+		{name: "placeholder for another peer", stored: stored(alice, false, 1), msg: stored(eve, false, 2)},
+		{name: "placeholder over a message", stored: stored(alice, false, 0), msg: stored(alice, false, 2)},
+		{name: "message over a placeholder", stored: stored(alice, false, 1), msg: stored(alice, false, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl := NewTimeline()
+			tl.Insert(tt.stored)
+			if got := tl.Replace(tt.msg, self); got != tt.want {
+				t.Fatalf("Replace = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimelineCausalOrder(t *testing.T) {
+	msg := func(id string, stamp HLC) ChatMessage {
+		m := NewChatMessage("ann", id, stamp)
+		m.ID = id
+		return m
+	}
+	legacy := func(id string, secs int64) ChatMessage {
+		m := msg(id, HLC{})
+		m.Timestamp = secs
+		return m
+	}
+
+	// Arrival order, with the index each should land at
+	arrivals := []struct {
+		msg  ChatMessage
+		want int
+	}{
+		{msg: msg("c", HLC{Wall: 3000}), want: 0},
+		{msg: msg("e", HLC{Wall: 5000}), want: 1},
+		{msg: msg("a", HLC{Wall: 1000}), want: 0},
+		{msg: msg("c2", HLC{Wall: 3000, Logical: 1}), want: 2}, // logical counter breaks the tie
+		{msg: msg("b", HLC{Wall: 3000}), want: 1},              // same stamp: ID breaks the tie
+		{msg: legacy("d", 4), want: 4},                         // seconds only, from an old client
+		{msg: msg("f", HLC{Wall: 6000}), want: 6},              // in order: appended
+	}
+
+	tl := NewTimeline()
+	for _, a := range arrivals {
+		i, ok := tl.Insert(a.msg)
+		if !ok || i != a.want {
+			t.Fatalf("Insert(%s) = %d, %v, want %d", a.msg.ID, i, ok, a.want)
+		}
+	}
+	if _, ok := tl.Insert(msg("c", HLC{Wall: 9000})); ok {
+		t.Fatal("Insert accepted a repeated ID")
+	}
+
+	var got []string
+	for _, m := range tl.Messages() {
+		got = append(got, m.ID)
+	}
+	want := []string{"a", "b", "c", "c2", "d", "e", "f"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+// Package config locates Hush's per-user state on disk and loads the
+// user's settings.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Dir returns the directory Hush keeps its state in, creating it if
+// needed. HUSH_HOME overrides the default, which is useful for running
+// several instances on one machine.
+func Dir() (string, error) {
+	dir := os.Getenv("HUSH_HOME")
+	if dir == "" {
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(base, "hush")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Path returns the location of a named file in Dir.
+func Path(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Peer names a peer in a settings list. The name is only a reminder for
+// the user; the ID is what counts.
+type Peer struct {
+	ID   peer.ID `json:"id"`
+	Name string  `json:"name"`
+}
+
+// Config is the user's persisted settings, kept as JSON in Dir.
+type Config struct {
+	Muted   []Peer `json:"muted,omitempty"`
+	Blocked []Peer `json:"blocked,omitempty"`
+
+	// Room is the room to show first; empty means the default one.
+	Room string `json:"room,omitempty"`
+	// Rooms lists every room to join, in the order they were joined.
+	Rooms []string `json:"rooms,omitempty"`
+	// Bootstrap lists /p2p multiaddrs to dial on start, for peers that
+	// mDNS can't find, e.g. on another subnet.
+	Bootstrap []string `json:"bootstrap,omitempty"`
+	// Theme names the color theme, see package theme; empty picks dark
+	// or light to suit the terminal.
+	Theme string `json:"theme,omitempty"`
+	// Keys rebinds the terminal UI's keys, from a binding's name to the
+	// keys that trigger it, e.g. "quit": ["ctrl+q"]. See ui.NewKeyMap.
+	Keys map[string][]string `json:"keys,omitempty"`
+	// TimeFormat is the Go layout message times are shown in, e.g.
+	// "15:04:05" or "3:04pm"; empty shows "2m ago" for the last hour and
+	// 15:04 before that.
+	TimeFormat string `json:"time_format,omitempty"`
+	// TimeZone is the IANA zone times are shown in, e.g. "Europe/Berlin";
+	// empty means the local one.
+	TimeZone string `json:"time_zone,omitempty"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// Load reads the settings file, returning defaults if there isn't one.
+func Load() (*Config, error) {
+	path, err := Path("config.json")
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the settings back to disk.
+func (c *Config) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saveLocked()
+}
+
+// Update changes the settings with fn and saves them, so changes made
+// from different goroutines don't interleave.
+func (c *Config) Update(fn func(*Config)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(c)
+	return c.saveLocked()
+}
+
+func (c *Config) saveLocked() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,475 @@
+// Package groupkey encrypts the traffic of owned rooms with sender
+// keys. Every member has its own hash ratchet: each frame is sealed with
+// a fresh message key and the chain moves on, so a key that leaks can't
+// decrypt what came before it. Chains are handed to the other members
+// over the /hush/keys/1.0.0 stream protocol, whose secure channel proves
+// who they came from.
+//
+// Who is a member is decided by the room's moderation log, not by who
+// is subscribed to its topic: anyone on the LAN can subscribe. When a
+// member leaves the topic or is removed, kicked or banned, everyone
+// starts a new chain, the next epoch, and gives it only to the members
+// still there. Someone who left and keeps listening sees only
+// ciphertext from then on.
+package groupkey
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// ProtocolID is the stream protocol sender keys are delivered over.
+const ProtocolID = "/hush/keys/1.0.0"
+
+const (
+	// keySize is the size of chain and message keys.
+	keySize = 32
+
+	// sendTimeout bounds handing our chain to one peer.
+	sendTimeout = 10 * time.Second
+
+	// reconcileInterval is how often membership is checked against who
+	// has our chain, besides whenever someone joins or leaves the topic.
+	reconcileInterval = time.Second
+
+	// retireAfter is how long a sender's previous chains are kept once
+	// it starts a new one, for frames that were already in flight.
+	retireAfter = time.Minute
+
+	// maxSkip bounds how far ahead of our position a frame may be.
+	maxSkip = 2000
+
+	// maxSkipped bounds the message keys kept for frames that arrive
+	// out of order.
+	maxSkipped = 256
+)
+
+var (
+	// ErrNoKey means we haven't been given the sender's chain (yet).
+	ErrNoKey = errors.New("no key from this sender yet")
+	// ErrStale means the frame's message key was used or dropped.
+	ErrStale = errors.New("message key already used")
+)
+
+// chain is one hash ratchet: key is the chain key at index.
+type chain struct {
+	key     []byte
+	index   uint32
+	skipped map[uint32][]byte // message keys passed over, by index
+	retire  time.Time         // when a superseded chain is dropped
+}
+
+func newChain(key []byte, index uint32) *chain {
+	return &chain{key: key, index: index, skipped: make(map[uint32][]byte)}
+}
+
+// step returns the message key at the chain's position and advances it.
+func (ch *chain) step() []byte {
+	mk := kdf(ch.key, 1)
+	ch.key = kdf(ch.key, 2)
+	ch.index++
+	return mk
+}
+
+// keyAt returns the message key for index, advancing past it. Keys for
+// indexes skipped on the way are kept for late frames.
+func (ch *chain) keyAt(index uint32) ([]byte, error) {
+	if index < ch.index {
+		mk, ok := ch.skipped[index]
+		if !ok {
+			return nil, ErrStale
+		}
+		delete(ch.skipped, index)
+		return mk, nil
+	}
+	if index-ch.index > maxSkip {
+		return nil, fmt.Errorf("frame is %d ahead of its sender's chain", index-ch.index)
+	}
+	for ch.index < index {
+		i := ch.index // step moves it on
+		ch.skipped[i] = ch.step()
+	}
+	for len(ch.skipped) > maxSkipped {
+		delete(ch.skipped, slices.Min(slices.Collect(maps.Keys(ch.skipped))))
+	}
+	return ch.step(), nil
+}
+
+// kdf derives the next chain key (label 2) or a message key (label 1).
+func kdf(key []byte, label byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte{label})
+	return m.Sum(nil)
+}
+
+// Exchange hands out and takes in sender keys for every encrypted room
+// on a host, over one stream handler.
+type Exchange struct {
+	h host.Host
+
+	mu    sync.Mutex
+	rooms map[string]*Keys
+}
+
+// NewExchange registers the key stream handler on h.
+func NewExchange(h host.Host) *Exchange {
+	x := &Exchange{h: h, rooms: make(map[string]*Keys)}
+	h.SetStreamHandler(ProtocolID, x.handleStream)
+	return x
+}
+
+// Join sets up encryption for room. Keys are only given to, and taken
+// from, peers that member reports as members of the room.
+func (x *Exchange) Join(room string, member func(peer.ID) bool) *Keys {
+	k := &Keys{
+		h:          x.h,
+		room:       room,
+		member:     member,
+		epoch:      1,
+		own:        newChain(randomKey(), 0),
+		recipients: make(map[peer.ID]bool),
+		peers:      make(map[peer.ID]map[uint64]*chain),
+		nudge:      make(chan struct{}, 1),
+	}
+	x.mu.Lock()
+	x.rooms[room] = k
+	x.mu.Unlock()
+	return k
+}
+
+// Leave forgets room's keys; chains peers send for it are refused.
+func (x *Exchange) Leave(room string) {
+	x.mu.Lock()
+	delete(x.rooms, room)
+	x.mu.Unlock()
+}
+
+// handleStream stores a chain a peer has given us for one of our rooms.
+func (x *Exchange) handleStream(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(sendTimeout))
+
+	from := s.Conn().RemotePeer()
+	data, err := wire.ReadDelimited(bufio.NewReader(s))
+	if err != nil {
+		s.Reset()
+		return
+	}
+	msg, err := wire.UnmarshalSenderKey(data)
+	if err != nil {
+		s.Reset()
+		return
+	}
+	x.mu.Lock()
+	k := x.rooms[msg.Room]
+	x.mu.Unlock()
+	if k == nil || !k.receive(from, msg) {
+		s.Reset()
+	}
+}
+
+// Keys seals and opens frames for one room. It implements chat.Sealer.
+type Keys struct {
+	h      host.Host
+	room   string
+	member func(peer.ID) bool
+
+	mu         sync.Mutex
+	epoch      uint64
+	own        *chain
+	recipients map[peer.ID]bool // members given our current chain
+	peers      map[peer.ID]map[uint64]*chain
+	nudge      chan struct{}
+}
+
+// Epoch returns the number of our current chain. It goes up by one
+// each time we rotate.
+func (k *Keys) Epoch() uint64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.epoch
+}
+
+// Seal encrypts frame with the next key in our chain.
+func (k *Keys) Seal(frame []byte) ([]byte, error) {
+	k.mu.Lock()
+	epoch, index := k.epoch, k.own.index
+	mk := k.own.step()
+	k.mu.Unlock()
+
+	aead, err := chacha20poly1305.New(mk)
+	if err != nil {
+		return nil, err
+	}
+	// Each message key is used once, so a fixed nonce is safe
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	ct := aead.Seal(nil, nonce, frame, k.ad(k.h.ID(), epoch, index))
+	return wire.Sealed{Epoch: epoch, Index: index, Ciphertext: ct}.Marshal(), nil
+}
+
+// Open decrypts a sealed frame from a peer.
+func (k *Keys) Open(from peer.ID, payload []byte) ([]byte, error) {
+	s, err := wire.UnmarshalSealed(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	ch := k.peers[from][s.Epoch]
+	if ch == nil {
+		k.mu.Unlock()
+		return nil, ErrNoKey
+	}
+	mk, err := ch.keyAt(s.Index)
+	k.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.New(mk)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	frame, err := aead.Open(nil, nonce, s.Ciphertext, k.ad(from, s.Epoch, s.Index))
+	if err != nil {
+		return nil, errors.New("message failed to decrypt")
+	}
+	return frame, nil
+}
+
+// ad binds a sealed frame to the room, its sender and its position.
+func (k *Keys) ad(from peer.ID, epoch uint64, index uint32) []byte {
+	b := append([]byte(k.room), 0)
+	b = append(b, from...)
+	b = binary.BigEndian.AppendUint64(b, epoch)
+	return binary.BigEndian.AppendUint32(b, index)
+}
+
+// Watch keeps our chain with exactly the room's current members until
+// ctx is done: members are given it when they turn up in the topic, and
+// when anyone who has it leaves the topic or the room we rotate to a
+// new one.
+func (k *Keys) Watch(ctx context.Context, topic *pubsub.Topic) {
+	events, err := topic.EventHandler()
+	if err == nil {
+		go func() {
+			defer events.Cancel()
+			for {
+				if _, err := events.NextPeerEvent(ctx); err != nil {
+					return
+				}
+				select {
+				case k.nudge <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-k.nudge:
+			case <-ctx.Done():
+				return
+			}
+			k.reconcile(ctx, topic.ListPeers())
+		}
+	}()
+}
+
+// reconcile compares who has our chain with the members in the topic
+// now.
+func (k *Keys) reconcile(ctx context.Context, inTopic []peer.ID) {
+	members := make(map[peer.ID]bool, len(inTopic))
+	for _, id := range inTopic {
+		if k.member(id) {
+			members[id] = true
+		}
+	}
+
+	k.mu.Lock()
+	now := time.Now()
+	for id, chains := range k.peers {
+		if !k.member(id) {
+			delete(k.peers, id)
+			continue
+		}
+		for epoch, ch := range chains {
+			if !ch.retire.IsZero() && now.After(ch.retire) {
+				delete(chains, epoch)
+			}
+		}
+	}
+	// Anyone who had our chain and is no longer a member in the topic,
+	// whether removed or just gone, takes it with them. A member who
+	// comes back is given whichever chain is current then.
+	departed := false
+	for id := range k.recipients {
+		if !members[id] {
+			departed = true
+		}
+	}
+	if departed {
+		// Start a new chain for the rest and seal with it straight
+		// away, so whoever left can't read on while it is handed out.
+		k.own, k.epoch = newChain(randomKey(), 0), k.epoch+1
+		k.recipients = make(map[peer.ID]bool)
+	}
+	msg := wire.SenderKey{Room: k.room, Epoch: k.epoch, Index: k.own.index, ChainKey: k.own.key}
+	var to []peer.ID
+	for id := range members {
+		if !k.recipients[id] {
+			to = append(to, id)
+		}
+	}
+	k.mu.Unlock()
+
+	if len(to) == 0 {
+		return
+	}
+	got := k.send(ctx, to, msg)
+	if !departed {
+		k.delivered(msg.Epoch, got)
+		return
+	}
+
+	// Members the new chain missed can't open anything we send until
+	// they have it, so try them again now rather than on the next tick.
+	missed := slices.DeleteFunc(to, func(id peer.ID) bool { return slices.Contains(got, id) })
+	k.delivered(msg.Epoch, got)
+	if len(missed) > 0 {
+		k.mu.Lock()
+		msg = wire.SenderKey{Room: k.room, Epoch: k.epoch, Index: k.own.index, ChainKey: k.own.key}
+		k.mu.Unlock()
+		k.delivered(msg.Epoch, k.send(ctx, missed, msg))
+	}
+}
+
+// delivered records that got were given our chain for epoch, unless we
+// have moved on from it since.
+func (k *Keys) delivered(epoch uint64, got []peer.ID) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if epoch != k.epoch {
+		return
+	}
+	for _, id := range got {
+		k.recipients[id] = true
+	}
+}
+
+// send hands msg to each peer in parallel, returning who got it. The
+// rest are tried again on the next reconcile.
+func (k *Keys) send(ctx context.Context, to []peer.ID, msg wire.SenderKey) []peer.ID {
+	data := msg.Marshal()
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		got []peer.ID
+	)
+	for _, id := range to {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := k.sendTo(ctx, id, data); err == nil {
+				mu.Lock()
+				got = append(got, id)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return got
+}
+
+func (k *Keys) sendTo(ctx context.Context, id peer.ID, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	s, err := k.h.NewStream(ctx, id, ProtocolID)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(sendTimeout))
+	if err := wire.WriteDelimited(s, data); err != nil {
+		s.Reset()
+		return err
+	}
+	// Wait for the peer to close its side, so we know it was stored
+	_, err = bufio.NewReader(s).ReadByte()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// receive stores a chain from a peer, reporting whether it was taken.
+func (k *Keys) receive(from peer.ID, msg wire.SenderKey) bool {
+	if len(msg.ChainKey) != keySize || !k.member(from) {
+		return false
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	chains := k.peers[from]
+	if chains == nil {
+		chains = make(map[uint64]*chain)
+		k.peers[from] = chains
+	}
+	if cur := chains[msg.Epoch]; cur != nil && cur.same(msg.ChainKey, msg.Index) {
+		return true // a resend of what we have, possibly further along
+	}
+	chains[msg.Epoch] = newChain(msg.ChainKey, msg.Index)
+	for epoch, ch := range chains {
+		if epoch < msg.Epoch && ch.retire.IsZero() {
+			ch.retire = time.Now().Add(retireAfter)
+		}
+	}
+	return true
+}
+
+// same reports whether key at index is this chain, further along. A
+// peer that restarted begins a fresh chain at its first epoch again,
+// which must replace the one we had rather than be mistaken for it.
+func (ch *chain) same(key []byte, index uint32) bool {
+	if index < ch.index || index-ch.index > maxSkip {
+		return false
+	}
+	k := ch.key
+	for i := ch.index; i < index; i++ {
+		k = kdf(k, 2)
+	}
+	return hmac.Equal(k, key)
+}
+
+func randomKey() []byte {
+	key := make([]byte, keySize)
+	rand.Read(key)
+	return key
+}
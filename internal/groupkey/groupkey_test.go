@@ -0,0 +1,225 @@
+package groupkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// steps returns the first n message keys of the chain starting at key.
+func steps(key []byte, n int) [][]byte {
+	ch := newChain(key, 0)
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = ch.step()
+	}
+	return keys
+}
+
+func TestChainKeyAt(t *testing.T) {
+	key := randomKey()
+	want := steps(key, 6)
+	ch := newChain(key, 0)
+
+	for _, tt := range []struct {
+		index uint32
+		err   error
+	}{
+		{index: 3},                // skips 0 to 2
+		{index: 1},                // late, from the skipped keys
+		{index: 1, err: ErrStale}, // replayed
+		{index: 3, err: ErrStale}, // replayed
+		{index: 0},
+		{index: 2},
+		{index: 5},
+		{index: 4},
+	} {
+		mk, err := ch.keyAt(tt.index)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("keyAt(%d) = %v, want %v", tt.index, err, tt.err)
+		}
+		if err == nil && !bytes.Equal(mk, want[tt.index]) {
+			t.Fatalf("keyAt(%d) returned the wrong key", tt.index)
+		}
+	}
+	if len(ch.skipped) != 0 {
+		t.Fatalf("%d skipped keys left over", len(ch.skipped))
+	}
+}
+
+func TestChainKeyAtBounds(t *testing.T) {
+	ch := newChain(randomKey(), 0)
+	if _, err := ch.keyAt(maxSkip + 1); err == nil {
+		t.Fatal("keyAt accepted a frame further ahead than maxSkip")
+	}
+	if ch.index != 0 {
+		t.Fatalf("refused frame moved the chain to %d", ch.index)
+	}
+
+	const ahead = maxSkipped + 10
+	if _, err := ch.keyAt(ahead); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch.skipped) != maxSkipped {
+		t.Fatalf("kept %d skipped keys, want %d", len(ch.skipped), maxSkipped)
+	}
+	// The oldest go first
+	if _, err := ch.keyAt(9); !errors.Is(err, ErrStale) {
+		t.Fatalf("keyAt(9) = %v, want ErrStale", err)
+	}
+	if _, err := ch.keyAt(10); err != nil {
+		t.Fatalf("keyAt(10) = %v", err)
+	}
+}
+
+func TestChainSame(t *testing.T) {
+	key := randomKey()
+	ch := newChain(key, 0)
+	ahead := newChain(key, 0)
+	for range 5 {
+		ahead.step()
+	}
+
+	tests := []struct {
+		name  string
+		key   []byte
+		index uint32
+		want  bool
+	}{
+		{name: "resend", key: key, index: 0, want: true},
+		{name: "further along", key: ahead.key, index: 5, want: true},
+		{name: "restarted with a fresh chain", key: randomKey(), index: 0},
+		{name: "further along but not ours", key: randomKey(), index: 5},
+		{name: "too far ahead to tell", key: ahead.key, index: maxSkip + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ch.same(tt.key, tt.index); got != tt.want {
+				t.Fatalf("same = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	behind := newChain(ahead.key, 5)
+	if behind.same(key, 0) {
+		t.Fatal("same accepted a chain from before ours")
+	}
+}
+
+func TestRetireOldEpochs(t *testing.T) {
+	mn, err := mocknet.WithNPeers(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	k := NewExchange(hosts[0]).Join("room", func(peer.ID) bool { return true })
+	from := hosts[1].ID()
+
+	for epoch := uint64(1); epoch <= 2; epoch++ {
+		if !k.receive(from, wire.SenderKey{Room: "room", Epoch: epoch, ChainKey: randomKey()}) {
+			t.Fatalf("epoch %d refused", epoch)
+		}
+	}
+	old := k.peers[from][1]
+	if old.retire.IsZero() || !k.peers[from][2].retire.IsZero() {
+		t.Fatal("only the superseded epoch should be retiring")
+	}
+
+	old.retire = time.Now().Add(-time.Second)
+	k.reconcile(context.Background(), nil)
+	if _, ok := k.peers[from][1]; ok {
+		t.Fatal("retired epoch kept")
+	}
+	if _, ok := k.peers[from][2]; !ok {
+		t.Fatal("current epoch dropped")
+	}
+}
+
+func TestRemovedMemberCantOpen(t *testing.T) {
+	mn, err := mocknet.FullMeshConnected(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	sender, stays, removed := hosts[0].ID(), hosts[1].ID(), hosts[2].ID()
+
+	var mu sync.Mutex
+	members := map[peer.ID]bool{sender: true, stays: true, removed: true}
+	member := func(id peer.ID) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return members[id]
+	}
+	keys := make([]*Keys, len(hosts))
+	for i, h := range hosts {
+		keys[i] = NewExchange(h).Join("room", member)
+	}
+	ctx := context.Background()
+
+	keys[0].reconcile(ctx, []peer.ID{stays, removed})
+	frame, err := keys[0].Seal([]byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys[1:] {
+		if got, err := k.Open(sender, frame); err != nil || string(got) != "before" {
+			t.Fatalf("Open before removal = %q, %v", got, err)
+		}
+	}
+
+	mu.Lock()
+	delete(members, removed)
+	mu.Unlock()
+	// Still subscribed, but no longer a member
+	keys[0].reconcile(ctx, []peer.ID{stays, removed})
+	if keys[0].Epoch() != 2 {
+		t.Fatalf("epoch = %d after removal, want 2", keys[0].Epoch())
+	}
+
+	frame, err = keys[0].Seal([]byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := keys[1].Open(sender, frame); err != nil || string(got) != "after" {
+		t.Fatalf("member's Open after removal = %q, %v", got, err)
+	}
+	if _, err := keys[2].Open(sender, frame); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("removed member's Open = %v, want ErrNoKey", err)
+	}
+}
+
+func TestLeavingTopicRotates(t *testing.T) {
+	mn, err := mocknet.FullMeshConnected(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	keys := make([]*Keys, len(hosts))
+	for i, h := range hosts {
+		keys[i] = NewExchange(h).Join("room", func(peer.ID) bool { return true })
+	}
+	ctx := context.Background()
+	stays, leaves := hosts[1].ID(), hosts[2].ID()
+
+	keys[0].reconcile(ctx, []peer.ID{stays, leaves})
+	keys[0].reconcile(ctx, []peer.ID{stays})
+	if keys[0].Epoch() != 2 {
+		t.Fatalf("epoch = %d after a member left, want 2", keys[0].Epoch())
+	}
+
+	frame, err := keys[0].Seal([]byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys[2].Open(hosts[0].ID(), frame); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("Open by the member who left = %v, want ErrNoKey", err)
+	}
+}
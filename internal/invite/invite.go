@@ -0,0 +1,272 @@
+// Package invite creates and redeems invite codes: signed, compact
+// strings that tell a new member which room to join and which peers to
+// bootstrap from, so nobody has to read settings out over voice.
+//
+// Codes can expire and can be single-use. A code for an owned room can
+// also admit whoever uses it as a member, who is then given the room's
+// keys. Single-use and admitting codes are redeemed with their issuer
+// over the /hush/invite/1.0.0 stream protocol, so they only work while
+// the issuer is online.
+package invite
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/ekrishgupta/Hush/internal/config"
+	"github.com/ekrishgupta/Hush/internal/moderation"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+const (
+	// prefix starts every code. With upper-case base32 after it the
+	// whole code is in a QR code's compact alphanumeric alphabet.
+	prefix = "HUSH:"
+
+	// signContext is prepended to the invite before signing, so the
+	// signature can't be replayed as anything else made with our key.
+	signContext = "hush-invite:"
+
+	// maxAddrs bounds the addresses in a code to keep it short.
+	maxAddrs = 3
+
+	// MaxRoomName bounds the length of a room name, including the owner
+	// suffix of an owned room.
+	MaxRoomName = 128
+
+	// maxBootstrap bounds the peers remembered from applied invites.
+	maxBootstrap = 16
+)
+
+var (
+	// ErrMalformed means the text isn't an invite code.
+	ErrMalformed = errors.New("not a valid invite code")
+	// ErrBadSignature means the code was altered or forged.
+	ErrBadSignature = errors.New("invite signature does not match its issuer")
+	// ErrExpired means the code is past its expiry time.
+	ErrExpired = errors.New("invite has expired")
+	// ErrRedeemed means a single-use code was already used.
+	ErrRedeemed = errors.New("invite has already been used")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Invite is a decoded, verified invite code.
+type Invite struct {
+	Room    string
+	Issuer  peer.ID
+	Addrs   []ma.Multiaddr
+	Expires time.Time // zero if it never expires
+	Once    bool
+	Admit   bool // redeeming it makes us a member of the owned room
+
+	nonce  []byte
+	signed []byte // the SignedInvite, sent to the issuer to redeem it
+}
+
+// Options controls the invites Create makes.
+type Options struct {
+	// TTL is how long the code is valid for; zero means forever.
+	TTL time.Duration
+	// Once makes the code single-use.
+	Once bool
+	// Admit makes whoever redeems the code a member of the room, which
+	// must be owned, with the issuer's authority as owner or moderator.
+	Admit bool
+}
+
+// Create makes an invite code for room, signed with priv and pointing
+// at addrs. Loopback addresses are left out, as are any beyond the
+// first few.
+func Create(priv crypto.PrivKey, room string, addrs []ma.Multiaddr, opts Options) (string, error) {
+	if err := validRoom(room); err != nil {
+		return "", err
+	}
+	if _, _, owned := moderation.ParseRoom(room); opts.Admit && !owned {
+		return "", moderation.ErrNotOwned
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+
+	inv := wire.Invite{
+		Room:   room,
+		Issuer: []byte(id),
+		Nonce:  make([]byte, 8),
+		Once:   opts.Once,
+		Admit:  opts.Admit,
+	}
+	rand.Read(inv.Nonce)
+	if opts.TTL > 0 {
+		inv.Expires = uint64(time.Now().Add(opts.TTL).Unix())
+	}
+	for _, a := range addrs {
+		if len(inv.Addrs) == maxAddrs {
+			break
+		}
+		if manet.IsIPLoopback(a) {
+			continue
+		}
+		inv.Addrs = append(inv.Addrs, a.Bytes())
+	}
+
+	body := inv.Marshal()
+	sig, err := priv.Sign(append([]byte(signContext), body...))
+	if err != nil {
+		return "", fmt.Errorf("signing invite: %w", err)
+	}
+	signed := wire.SignedInvite{Invite: body, Signature: sig}.Marshal()
+	return prefix + encoding.EncodeToString(signed), nil
+}
+
+// Parse decodes a code and checks its signature and expiry. Whitespace
+// and case are ignored, since codes get wrapped and retyped.
+func Parse(code string) (Invite, error) {
+	code = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, code)
+	rest, ok := strings.CutPrefix(code, prefix)
+	if !ok {
+		return Invite{}, ErrMalformed
+	}
+	raw, err := encoding.DecodeString(rest)
+	if err != nil {
+		return Invite{}, ErrMalformed
+	}
+	return parseSigned(raw)
+}
+
+func parseSigned(raw []byte) (Invite, error) {
+	signed, err := wire.UnmarshalSignedInvite(raw)
+	if err != nil {
+		return Invite{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	w, err := wire.UnmarshalInvite(signed.Invite)
+	if err != nil {
+		return Invite{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	issuer, err := peer.IDFromBytes(w.Issuer)
+	if err != nil {
+		return Invite{}, fmt.Errorf("%w: bad issuer", ErrMalformed)
+	}
+	pub, err := issuer.ExtractPublicKey()
+	if err != nil {
+		return Invite{}, fmt.Errorf("%w: issuer has no embedded key", ErrMalformed)
+	}
+	ok, err := pub.Verify(append([]byte(signContext), signed.Invite...), signed.Signature)
+	if err != nil || !ok {
+		return Invite{}, ErrBadSignature
+	}
+	if err := validRoom(w.Room); err != nil {
+		return Invite{}, err
+	}
+
+	inv := Invite{
+		Room:   w.Room,
+		Issuer: issuer,
+		Once:   w.Once,
+		Admit:  w.Admit,
+		nonce:  w.Nonce,
+		signed: raw,
+	}
+	if w.Expires != 0 {
+		inv.Expires = time.Unix(int64(w.Expires), 0)
+		if time.Now().After(inv.Expires) {
+			return inv, ErrExpired
+		}
+	}
+	for _, b := range w.Addrs {
+		a, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			continue // skip what we can't dial; the rest may do
+		}
+		inv.Addrs = append(inv.Addrs, a)
+	}
+	return inv, nil
+}
+
+// AddrInfo returns the issuer and its addresses, ready to dial.
+func (inv Invite) AddrInfo() peer.AddrInfo {
+	return peer.AddrInfo{ID: inv.Issuer, Addrs: inv.Addrs}
+}
+
+// Apply makes the invite's room the one we join, and remembers the
+// issuer's addresses to bootstrap from on every start. Pass it to
+// config.Config.Update to save the change.
+func (inv Invite) Apply(cfg *config.Config) {
+	cfg.Room = inv.Room
+
+	p2p, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: inv.Issuer, Addrs: inv.Addrs})
+	if err != nil {
+		return
+	}
+	for _, a := range p2p {
+		s := a.String()
+		cfg.Bootstrap = append(slices.DeleteFunc(cfg.Bootstrap, func(v string) bool { return v == s }), s)
+	}
+	if n := len(cfg.Bootstrap); n > maxBootstrap {
+		cfg.Bootstrap = cfg.Bootstrap[n-maxBootstrap:]
+	}
+}
+
+// Describe summarises the invite for display, e.g.
+// "#design · expires Jan 2 15:04 · single use · admits a member".
+func (inv Invite) Describe() string {
+	parts := []string{"#" + moderation.DisplayName(inv.Room)}
+	if inv.Expires.IsZero() {
+		parts = append(parts, "never expires")
+	} else {
+		parts = append(parts, "expires "+inv.Expires.Format("Jan 2 15:04"))
+	}
+	if inv.Once {
+		parts = append(parts, "single use")
+	}
+	if inv.Admit {
+		parts = append(parts, "admits a member")
+	}
+	return strings.Join(parts, " · ")
+}
+
+// QR renders code as a QR code in half-block characters, light modules
+// drawn, for a terminal or monospace panel with a dark background.
+func QR(code string) (string, error) {
+	q, err := qrcode.New(code, qrcode.Low)
+	if err != nil {
+		return "", err
+	}
+	return q.ToSmallString(false), nil
+}
+
+// QRImage renders code as a size×size PNG QR code.
+func QRImage(code string, size int) ([]byte, error) {
+	return qrcode.Encode(code, qrcode.Low, size)
+}
+
+func validRoom(room string) error {
+	if room == "" || len(room) > MaxRoomName {
+		return fmt.Errorf("room name must be 1 to %d bytes", MaxRoomName)
+	}
+	for _, r := range room {
+		if unicode.IsControl(r) || unicode.IsSpace(r) {
+			return fmt.Errorf("room name %q has spaces or control characters", room)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package invite
+
+import (
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+
+	"github.com/ekrishgupta/Hush/internal/moderation"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	priv, id := newIdentity(t)
+	code, err := Create(priv, "design", nil, Options{TTL: time.Hour, Once: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Codes get wrapped and retyped
+	retyped := strings.ToLower(code[:10]) + "\n  " + code[10:]
+	inv, err := Parse(retyped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Room != "design" || inv.Issuer != id || !inv.Once || inv.Admit || inv.Expires.IsZero() {
+		t.Fatalf("Parse = %+v", inv)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	priv, id := newIdentity(t)
+	other, _ := newIdentity(t)
+	good := wire.Invite{Room: "design", Issuer: []byte(id), Nonce: []byte("12345678")}
+
+	tests := []struct {
+		name string
+		code string
+		want error
+	}{
+		{name: "not a code", code: "hello", want: ErrMalformed},
+		{name: "bad base32", code: prefix + "!!!", want: ErrMalformed},
+		{
+			name: "room changed after signing",
+			code: tamper(t, sign(t, priv, good), func(s *wire.SignedInvite) {
+				inv := good
+				inv.Room = "secret"
+				s.Invite = inv.Marshal()
+			}),
+			want: ErrBadSignature,
+		},
+		{
+			name: "admit added after signing",
+			code: tamper(t, sign(t, priv, good), func(s *wire.SignedInvite) {
+				inv := good
+				inv.Admit = true
+				s.Invite = inv.Marshal()
+			}),
+			want: ErrBadSignature,
+		},
+		{
+			name: "signature altered",
+			code: tamper(t, sign(t, priv, good), func(s *wire.SignedInvite) { s.Signature[0] ^= 1 }),
+			want: ErrBadSignature,
+		},
+		{name: "signed by someone else", code: sign(t, other, good), want: ErrBadSignature},
+		{
+			name: "expired",
+			code: sign(t, priv, func() wire.Invite {
+				inv := good
+				inv.Expires = uint64(time.Now().Add(-time.Minute).Unix())
+				return inv
+			}()),
+			want: ErrExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.code); !errors.Is(err, tt.want) {
+				t.Fatalf("Parse = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedeemOnce(t *testing.T) {
+	s, path := newService(t)
+	_, from := newIdentity(t)
+
+	once := redeemable(t, s, "design", Options{Once: true})
+	if err := s.redeem(once, from); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.redeem(once, from); !errors.Is(err, ErrRedeemed) {
+		t.Fatalf("second redeem = %v, want ErrRedeemed", err)
+	}
+
+	// The record survives a restart
+	again, err := NewService(s.h, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := again.redeem(once, from); !errors.Is(err, ErrRedeemed) {
+		t.Fatalf("redeem after restart = %v, want ErrRedeemed", err)
+	}
+
+	reusable := redeemable(t, s, "design", Options{})
+	for range 2 {
+		if err := s.redeem(reusable, from); err != nil {
+			t.Fatalf("reusable invite: %v", err)
+		}
+	}
+}
+
+func TestRedeemRefuses(t *testing.T) {
+	s, _ := newService(t)
+	_, from := newIdentity(t)
+
+	// Someone else's invite can't be redeemed with us
+	otherKey, _ := newIdentity(t)
+	code, err := Create(otherKey, "design", nil, Options{Once: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.redeem(inv.signed, from); err == nil {
+		t.Fatal("redeemed an invite issued by someone else")
+	}
+
+	// An admitting invite waits for SetAdmit, and isn't used up by failing
+	room, err := moderation.OwnedRoom("design", s.h.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	admitting := redeemable(t, s, room, Options{Once: true, Admit: true})
+	if err := s.redeem(admitting, from); err == nil {
+		t.Fatal("admitted without an admit func")
+	}
+	var admitted []peer.ID
+	s.SetAdmit(func(r string, id peer.ID) error {
+		if r != room {
+			t.Errorf("admitted to %q, want %q", r, room)
+		}
+		admitted = append(admitted, id)
+		return nil
+	})
+	if err := s.redeem(admitting, from); err != nil {
+		t.Fatal(err)
+	}
+	if len(admitted) != 1 || admitted[0] != from {
+		t.Fatalf("admitted %v, want %v", admitted, from)
+	}
+	if err := s.redeem(admitting, from); !errors.Is(err, ErrRedeemed) {
+		t.Fatalf("second redeem = %v, want ErrRedeemed", err)
+	}
+}
+
+func newIdentity(t *testing.T) (crypto.PrivKey, peer.ID) {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, id
+}
+
+func newService(t *testing.T) (*Service, string) {
+	t.Helper()
+	// Invites name their issuer by a key embedded in the ID, so the host
+	// needs an Ed25519 identity rather than mocknet's default
+	priv, _ := newIdentity(t)
+	h, err := mocknet.New().AddPeer(priv, ma.StringCast("/ip4/127.0.0.1/tcp/4001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "invites.json")
+	s, err := NewService(h, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+// redeemable creates an invite with s and returns what a joiner sends
+// to redeem it.
+func redeemable(t *testing.T, s *Service, room string, opts Options) []byte {
+	t.Helper()
+	code, err := s.Create(room, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv.signed
+}
+
+// sign encodes inv as a code signed with priv, whoever it names as issuer.
+func sign(t *testing.T, priv crypto.PrivKey, inv wire.Invite) string {
+	t.Helper()
+	body := inv.Marshal()
+	sig, err := priv.Sign(append([]byte(signContext), body...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefix + encoding.EncodeToString(wire.SignedInvite{Invite: body, Signature: sig}.Marshal())
+}
+
+// tamper decodes code, changes it with fn and encodes it again.
+func tamper(t *testing.T, code string, fn func(*wire.SignedInvite)) string {
+	t.Helper()
+	raw, err := encoding.DecodeString(strings.TrimPrefix(code, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := wire.UnmarshalSignedInvite(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn(&s)
+	return prefix + encoding.EncodeToString(s.Marshal())
+}
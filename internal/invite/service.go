@@ -0,0 +1,204 @@
+package invite
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/ekrishgupta/Hush/internal/config"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// ProtocolID is the libp2p stream protocol for redeeming invites.
+const ProtocolID protocol.ID = "/hush/invite/1.0.0"
+
+// redeemTimeout bounds dialling the issuer and redeeming with it.
+const redeemTimeout = 15 * time.Second
+
+// Service issues invites for a host and redeems the single-use and
+// admitting ones it issued, remembering which have been used in a JSON
+// file.
+type Service struct {
+	h    host.Host
+	path string
+
+	mu       sync.Mutex
+	redeemed map[string]int64 // nonce (hex) -> expiry, unix seconds; 0 for never
+	admit    func(room string, id peer.ID) error
+}
+
+// DefaultPath returns where used invites are recorded.
+func DefaultPath() (string, error) {
+	return config.Path("invites.json")
+}
+
+// NewService loads the record at path and registers the stream handler
+// on h.
+func NewService(h host.Host, path string) (*Service, error) {
+	s := &Service{h: h, path: path, redeemed: make(map[string]int64)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.redeemed); err != nil {
+			return nil, fmt.Errorf("reading used invites %s: %w", path, err)
+		}
+	}
+
+	h.SetStreamHandler(ProtocolID, s.handleStream)
+	return s, nil
+}
+
+// SetAdmit sets how a member is admitted to an owned room when they
+// redeem an admitting invite with us. Until it is set, such invites are
+// refused.
+func (s *Service) SetAdmit(admit func(room string, id peer.ID) error) {
+	s.mu.Lock()
+	s.admit = admit
+	s.mu.Unlock()
+}
+
+// Create makes an invite to room pointing at our own addresses.
+func (s *Service) Create(room string, opts Options) (string, error) {
+	priv := s.h.Peerstore().PrivKey(s.h.ID())
+	if priv == nil {
+		return "", errors.New("no private key for this host")
+	}
+	return Create(priv, room, s.h.Addrs(), opts)
+}
+
+// Join dials the invite's issuer and, for a single-use or admitting
+// invite, redeems it. The issuer has to be reachable for that; other
+// invites work even if it isn't, as long as someone in the room is.
+func (s *Service) Join(ctx context.Context, inv Invite) error {
+	ctx, cancel := context.WithTimeout(ctx, redeemTimeout)
+	defer cancel()
+
+	if inv.Issuer == s.h.ID() {
+		return nil // our own invite; nothing to dial
+	}
+	err := s.h.Connect(ctx, inv.AddrInfo())
+	if !inv.Once && !inv.Admit {
+		return nil // best effort; mDNS and saved peers may still find the room
+	}
+	if err != nil {
+		return fmt.Errorf("reaching the issuer to redeem the invite: %w", err)
+	}
+
+	st, err := s.h.NewStream(ctx, inv.Issuer, ProtocolID)
+	if err != nil {
+		return fmt.Errorf("redeeming invite: %w", err)
+	}
+	defer st.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		st.SetDeadline(deadline)
+	}
+
+	if err := wire.WriteDelimited(st, inv.signed); err != nil {
+		return fmt.Errorf("redeeming invite: %w", err)
+	}
+	b, err := wire.ReadDelimited(bufio.NewReader(st))
+	if err != nil {
+		return fmt.Errorf("redeeming invite: %w", err)
+	}
+	res, err := wire.UnmarshalInviteResult(b)
+	if err != nil {
+		return err
+	}
+	switch res.Error {
+	case "":
+		return nil
+	case ErrRedeemed.Error():
+		return ErrRedeemed
+	case ErrExpired.Error():
+		return ErrExpired
+	}
+	return fmt.Errorf("issuer refused invite: %s", res.Error)
+}
+
+func (s *Service) handleStream(st network.Stream) {
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(redeemTimeout))
+
+	b, err := wire.ReadDelimited(bufio.NewReader(st))
+	if err != nil {
+		st.Reset()
+		return
+	}
+	var res wire.InviteResult
+	if err := s.redeem(b, st.Conn().RemotePeer()); err != nil {
+		res.Error = err.Error()
+	}
+	_ = wire.WriteDelimited(st, res.Marshal())
+}
+
+// redeem marks a single-use invite we issued as used, failing if it was
+// used already, and admits from to the room if the invite says to.
+func (s *Service) redeem(raw []byte, from peer.ID) error {
+	inv, err := parseSigned(raw)
+	if err != nil {
+		return err
+	}
+	if inv.Issuer != s.h.ID() {
+		return errors.New("invite was issued by someone else")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hex.EncodeToString(inv.nonce)
+	if _, ok := s.redeemed[key]; ok {
+		return ErrRedeemed
+	}
+	if inv.Admit {
+		if s.admit == nil {
+			return errors.New("not admitting members yet")
+		}
+		if err := s.admit(inv.Room, from); err != nil {
+			return err
+		}
+	}
+	if !inv.Once {
+		return nil
+	}
+	var expires int64
+	if !inv.Expires.IsZero() {
+		expires = inv.Expires.Unix()
+	}
+	s.redeemed[key] = expires
+	return s.saveLocked()
+}
+
+// saveLocked writes the record, forgetting invites that have expired
+// since they can't be redeemed anyway. s.mu must be held.
+func (s *Service) saveLocked() error {
+	now := time.Now().Unix()
+	for k, exp := range s.redeemed {
+		if exp != 0 && exp < now {
+			delete(s.redeemed, k)
+		}
+	}
+
+	data, err := json.MarshalIndent(s.redeemed, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,788 @@
+// Package moderation gives owned rooms an authority: the room's owner
+// signs grants that make peers moderators, and the owner and moderators
+// sign who is a member, kicks, bans and topic changes. Actions travel
+// as KindControl messages and every client checks the signatures and
+// enforces them in its topic validator, so a banned peer's messages are
+// neither shown nor relayed. Only members are given the room's keys.
+//
+// A room is owned when its name ends in "@" and the owner's peer ID.
+// The name certifies itself: nobody else can sign for that ID, and
+// nobody has to be told separately who the owner is. Rooms without an
+// owner, like the default one, have no moderation.
+package moderation
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/config"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+const (
+	// signContext is prepended to an action before signing, so the
+	// signature can't be replayed as anything else made with the key.
+	signContext = "hush-mod:"
+
+	// DefaultKick is how long a kick lasts unless told otherwise.
+	DefaultKick = 10 * time.Minute
+
+	// MaxName bounds the human part of a room name.
+	MaxName = 64
+
+	// maxLog bounds the actions kept per room. Grants, revocations and
+	// membership are never trimmed, since only the owner and moderators
+	// can add those, so the log can outgrow one message; syncs are split
+	// across as many as it takes.
+	maxLog = 150
+
+	// syncInterval throttles republishing the log to newcomers.
+	syncInterval = 30 * time.Second
+)
+
+var (
+	// ErrNotOwned means the room has no owner, so no moderation.
+	ErrNotOwned = errors.New("this room has no owner, so it can't be moderated")
+	// ErrNotAllowed means we lack the authority for an action.
+	ErrNotAllowed = errors.New("only the room's owner or a moderator can do that")
+	// ErrOwnerOnly means only the owner may do this.
+	ErrOwnerOnly = errors.New("only the room's owner can do that")
+	// ErrTargetOwner means the action would target the owner.
+	ErrTargetOwner = errors.New("the room's owner can't be kicked, banned or removed")
+	// ErrBadSignature means an action's signature doesn't verify.
+	ErrBadSignature = errors.New("moderation action signature does not match its issuer")
+)
+
+// OwnedRoom returns the name of a room called name owned by owner.
+func OwnedRoom(name string, owner peer.ID) (string, error) {
+	if name == "" || len(name) > MaxName || strings.ContainsAny(name, "@ \t\n") {
+		return "", fmt.Errorf("room name must be 1 to %d characters without spaces or @", MaxName)
+	}
+	return name + "@" + owner.String(), nil
+}
+
+// ParseRoom splits a room name into its human part and owner. owned is
+// false for rooms without one.
+func ParseRoom(room string) (name string, owner peer.ID, owned bool) {
+	name, suffix, ok := strings.Cut(room, "@")
+	if !ok {
+		return room, "", false
+	}
+	id, err := peer.Decode(suffix)
+	if err != nil {
+		return room, "", false
+	}
+	return name, id, true
+}
+
+// DisplayName is the part of a room name worth showing.
+func DisplayName(room string) string {
+	name, _, _ := ParseRoom(room)
+	return name
+}
+
+// Role is someone's standing in a room.
+type Role int
+
+const (
+	Member Role = iota
+	Moderator
+	Owner
+)
+
+// Sanction is a kick or ban in force.
+type Sanction struct {
+	ID    peer.ID
+	Until time.Time // zero for a ban
+	By    peer.ID
+}
+
+// State is a snapshot of a room's moderation.
+type State struct {
+	Room       string
+	Topic      string
+	Owner      peer.ID // empty for rooms without one
+	Moderators []peer.ID
+	Members    []peer.ID // admitted, besides the owner and moderators
+	Sanctions  []Sanction
+}
+
+// action is a verified, decoded moderation action.
+type action struct {
+	wire.ModAction
+	signed wire.SignedModAction
+	id     string // hash of the signed action, for dedup and ordering
+	issuer peer.ID
+	target peer.ID
+}
+
+// Room tracks and enforces moderation for one room.
+type Room struct {
+	room  string
+	owner peer.ID
+	owned bool
+	self  peer.ID
+	priv  crypto.PrivKey
+	path  string
+
+	mu        sync.RWMutex
+	chat      *chat.Chat
+	log       map[string]action
+	mods      map[peer.ID]bool
+	demoted   map[peer.ID]bool // moderators since revoked or banned
+	members   map[peer.ID]bool
+	sanctions map[peer.ID]Sanction
+	topic     string
+	lastSync  time.Time
+
+	changes chan struct{}
+}
+
+// DefaultPath returns where moderation logs are kept.
+func DefaultPath() (string, error) {
+	return config.Path("moderation.json")
+}
+
+// Open loads the moderation log for room from the file at path. priv is
+// our identity key, used to sign what we issue.
+func Open(room string, priv crypto.PrivKey, path string) (*Room, error) {
+	self, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	_, owner, owned := ParseRoom(room)
+	r := &Room{
+		room:      room,
+		owner:     owner,
+		owned:     owned,
+		self:      self,
+		priv:      priv,
+		path:      path,
+		log:       make(map[string]action),
+		mods:      make(map[peer.ID]bool),
+		demoted:   make(map[peer.ID]bool),
+		members:   make(map[peer.ID]bool),
+		sanctions: make(map[peer.ID]Sanction),
+		changes:   make(chan struct{}, 1),
+	}
+	if !owned {
+		return r, nil
+	}
+
+	logs, err := readLogs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range logs[room] {
+		if a, err := r.verify(s); err == nil {
+			r.log[a.id] = a
+		}
+	}
+	r.rebuildLocked()
+	return r, nil
+}
+
+// Owned reports whether the room has an owner.
+func (r *Room) Owned() bool {
+	return r.owned
+}
+
+// Role returns id's standing in the room.
+func (r *Room) Role(id peer.ID) Role {
+	if r.owned && id == r.owner {
+		return Owner
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.mods[id] {
+		return Moderator
+	}
+	return Member
+}
+
+// CanAdmit reports whether id can make others members of the room: its
+// owner or one of its moderators. Invites they create admit whoever
+// uses them.
+func (r *Room) CanAdmit(id peer.ID) bool {
+	return r.owned && r.Role(id) != Member
+}
+
+// Member reports whether id belongs in the room right now: the owner,
+// a moderator, or someone admitted, and not kicked or banned. Only
+// members are given the room's keys.
+func (r *Room) Member(id peer.ID) bool {
+	if !r.owned {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.bannedLocked(id, time.Now()) {
+		return false
+	}
+	return id == r.owner || r.mods[id] || r.members[id]
+}
+
+// Banned reports whether id is kicked or banned right now.
+func (r *Room) Banned(id peer.ID) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bannedLocked(id, time.Now())
+}
+
+func (r *Room) bannedLocked(id peer.ID, now time.Time) bool {
+	s, ok := r.sanctions[id]
+	return ok && (s.Until.IsZero() || now.Before(s.Until))
+}
+
+// Topic returns the room topic, if one was set.
+func (r *Room) Topic() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.topic
+}
+
+// State returns a snapshot for display. Expired kicks are left out.
+func (r *Room) State() State {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	st := State{Room: r.room, Topic: r.topic, Owner: r.owner}
+	for id := range r.mods {
+		st.Moderators = append(st.Moderators, id)
+	}
+	slices.Sort(st.Moderators)
+	for id := range r.members {
+		if !r.mods[id] && id != r.owner {
+			st.Members = append(st.Members, id)
+		}
+	}
+	slices.Sort(st.Members)
+	now := time.Now()
+	for id, s := range r.sanctions {
+		if r.bannedLocked(id, now) {
+			st.Sanctions = append(st.Sanctions, s)
+		}
+	}
+	slices.SortFunc(st.Sanctions, func(a, b Sanction) int { return cmp.Compare(a.ID, b.ID) })
+	return st
+}
+
+// Changes signals whenever the moderation state changes. Signals
+// coalesce; read State for the details.
+func (r *Room) Changes() <-chan struct{} {
+	return r.changes
+}
+
+// Validate is a GossipSub validator enforcing the room's moderation:
+// messages from kicked or banned peers are dropped without being
+// relayed, and control messages with forged or misdirected actions are
+// rejected, which costs the sender peer score.
+func (r *Room) Validate(_ context.Context, _ peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+	if !r.owned || msg.GetTopic() != r.room {
+		return pubsub.ValidationAccept
+	}
+	if r.Banned(msg.GetFrom()) {
+		// Ignore rather than reject: whoever relayed it may simply not
+		// have heard about the ban yet.
+		return pubsub.ValidationIgnore
+	}
+
+	env, err := wire.Unmarshal(msg.Data)
+	if err != nil || env.Kind != wire.KindControl {
+		return pubsub.ValidationAccept // the chat layer reports bad data
+	}
+	ctl, err := wire.UnmarshalControl(env.Payload)
+	if err != nil {
+		return pubsub.ValidationReject
+	}
+	actions := make([]action, 0, len(ctl.Actions))
+	for _, s := range ctl.Actions {
+		a, err := r.verify(s)
+		if err != nil {
+			return pubsub.ValidationReject
+		}
+		actions = append(actions, a)
+	}
+
+	// Actions from anyone without authority go no further. A sync may
+	// carry the grant that gives it, so grants in the same message
+	// count; otherwise our log may just be behind, so relays aren't
+	// punished for it, but a publisher signing such actions itself is.
+	granted := make(map[peer.ID]bool)
+	for _, a := range actions {
+		if a.Kind == wire.ModGrant && a.issuer == r.owner {
+			granted[a.target] = true
+		}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range actions {
+		if r.authorizedLocked(a) || (granted[a.issuer] && a.Kind != wire.ModGrant && a.Kind != wire.ModRevoke) {
+			continue
+		}
+		if a.issuer == msg.GetFrom() {
+			return pubsub.ValidationReject
+		}
+		return pubsub.ValidationIgnore
+	}
+	return pubsub.ValidationAccept
+}
+
+// authorizedLocked reports whether a's issuer could have had the
+// authority for it: the owner, or for anything but grants and
+// revocations a moderator, including one since demoted whose earlier
+// actions a sync still carries. r.mu must be held.
+func (r *Room) authorizedLocked(a action) bool {
+	if a.issuer == r.owner {
+		return true
+	}
+	if a.Kind == wire.ModGrant || a.Kind == wire.ModRevoke {
+		return false
+	}
+	return r.mods[a.issuer] || r.demoted[a.issuer]
+}
+
+// Watch applies control messages arriving on c and republishes the log
+// when peers appear, until ctx is done. Call it before c.Start.
+func (r *Room) Watch(ctx context.Context, c *chat.Chat) {
+	r.mu.Lock()
+	r.chat = c
+	r.mu.Unlock()
+	if !r.owned {
+		return
+	}
+
+	sub := c.Subscribe(chat.SubscribeOptions{
+		Filter: chat.Filter{Kinds: []wire.Kind{wire.KindControl, wire.KindPresence}},
+		Policy: chat.Block,
+	})
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case ev, ok := <-sub.C():
+				if !ok {
+					return
+				}
+				if ev.Kind == wire.KindControl {
+					r.apply(ev.Control.Actions)
+				} else {
+					r.syncSoon(ctx)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Kick ignores id for d.
+func (r *Room) Kick(id peer.ID, d time.Duration) error {
+	return r.issue(wire.ModKick, id, "", d)
+}
+
+// Ban ignores id until unbanned.
+func (r *Room) Ban(id peer.ID) error {
+	return r.issue(wire.ModBan, id, "", 0)
+}
+
+// Unban lifts a kick or ban.
+func (r *Room) Unban(id peer.ID) error {
+	return r.issue(wire.ModUnban, id, "", 0)
+}
+
+// Grant makes id a moderator. Only the owner can.
+func (r *Room) Grant(id peer.ID) error {
+	return r.issue(wire.ModGrant, id, "", 0)
+}
+
+// Revoke stops id being a moderator. Only the owner can.
+func (r *Room) Revoke(id peer.ID) error {
+	return r.issue(wire.ModRevoke, id, "", 0)
+}
+
+// Admit makes id a member, so it is given the room's keys.
+func (r *Room) Admit(id peer.ID) error {
+	return r.issue(wire.ModAdmit, id, "", 0)
+}
+
+// Remove stops id being a member. Everyone moves to new keys that it
+// isn't given.
+func (r *Room) Remove(id peer.ID) error {
+	return r.issue(wire.ModRemove, id, "", 0)
+}
+
+// SetTopic sets the room topic.
+func (r *Room) SetTopic(topic string) error {
+	return r.issue(wire.ModTopic, "", topic, 0)
+}
+
+func (r *Room) issue(kind wire.ModKind, target peer.ID, text string, d time.Duration) error {
+	if !r.owned {
+		return ErrNotOwned
+	}
+	switch role := r.Role(r.self); {
+	case (kind == wire.ModGrant || kind == wire.ModRevoke) && role != Owner:
+		return ErrOwnerOnly
+	case role == Member:
+		return ErrNotAllowed
+	case removes(kind) && target == r.owner:
+		return ErrTargetOwner
+	case removes(kind) && role != Owner && r.Role(target) == Moderator:
+		return ErrOwnerOnly
+	}
+
+	r.mu.RLock()
+	c := r.chat
+	now := time.Now().UnixMilli()
+	for _, a := range r.log {
+		now = max(now, a.Time+1) // stay ahead of skewed clocks
+	}
+	r.mu.RUnlock()
+	if c == nil {
+		return errors.New("not connected to the room yet")
+	}
+
+	a := wire.ModAction{
+		Room:   r.room,
+		Kind:   kind,
+		Target: []byte(target),
+		Text:   text,
+		Time:   now,
+		Issuer: []byte(r.self),
+	}
+	if d > 0 {
+		a.Until = now + d.Milliseconds()
+	}
+	body := a.Marshal()
+	sig, err := r.priv.Sign(append([]byte(signContext), body...))
+	if err != nil {
+		return fmt.Errorf("signing moderation action: %w", err)
+	}
+	signed := wire.SignedModAction{Action: body, Signature: sig}
+
+	r.apply([]wire.SignedModAction{signed})
+	return c.PublishControl(wire.Control{Actions: []wire.SignedModAction{signed}})
+}
+
+// verify checks an action's signature and that it is for this room.
+func (r *Room) verify(s wire.SignedModAction) (action, error) {
+	a, err := wire.UnmarshalModAction(s.Action)
+	if err != nil {
+		return action{}, err
+	}
+	if a.Room != r.room {
+		return action{}, fmt.Errorf("moderation action is for another room")
+	}
+	issuer, err := peer.IDFromBytes(a.Issuer)
+	if err != nil {
+		return action{}, fmt.Errorf("moderation action has a bad issuer: %w", err)
+	}
+	pub, err := issuer.ExtractPublicKey()
+	if err != nil {
+		return action{}, fmt.Errorf("moderation action has a bad issuer: %w", err)
+	}
+	ok, err := pub.Verify(append([]byte(signContext), s.Action...), s.Signature)
+	if err != nil || !ok {
+		return action{}, ErrBadSignature
+	}
+
+	var target peer.ID
+	if len(a.Target) > 0 {
+		if target, err = peer.IDFromBytes(a.Target); err != nil {
+			return action{}, fmt.Errorf("moderation action has a bad target: %w", err)
+		}
+	}
+	sum := sha256.Sum256(append(s.Action, s.Signature...))
+	return action{ModAction: a, signed: s, id: string(sum[:]), issuer: issuer, target: target}, nil
+}
+
+// apply merges actions into the log, keeping what verifies, and saves
+// and signals if anything changed.
+//
+// Actions are replayed in the order of the times their issuers signed,
+// so a moderator who has been revoked could otherwise sign actions
+// dated before the revocation. Once we have seen someone lose their
+// authority, nothing more they sign is taken in until they are granted
+// it again; what they did before arrived while they still had it.
+func (r *Room) apply(signed []wire.SignedModAction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added := false
+	for _, s := range signed {
+		a, err := r.verify(s)
+		if err != nil || r.demoted[a.issuer] {
+			continue
+		}
+		if _, ok := r.log[a.id]; !ok {
+			r.log[a.id] = a
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	r.rebuildLocked()
+	_ = r.saveLocked()
+	select {
+	case r.changes <- struct{}{}:
+	default:
+	}
+}
+
+// rebuildLocked replays the log in order, working out who moderates,
+// who is sanctioned and the topic, and drops actions that had no
+// authority or have been superseded. Grants and revocations are always
+// kept, even when the log is trimmed, since other actions' authority
+// depends on them, and so is the latest admission or removal of each
+// member. r.mu must be held.
+func (r *Room) rebuildLocked() {
+	ordered := slices.SortedFunc(mapValues(r.log), byTime)
+
+	mods := make(map[peer.ID]bool)
+	demoted := make(map[peer.ID]bool)
+	members := make(map[peer.ID]bool)
+	sanctions := make(map[peer.ID]Sanction)
+	latest := make(map[peer.ID]string)     // target -> id of the sanction in force
+	membership := make(map[peer.ID]string) // target -> id of the last admit or removal
+	var topic, topicID string
+	keep := make(map[string]action)
+
+	for _, a := range ordered {
+		isOwner := a.issuer == r.owner
+		allowed := isOwner || mods[a.issuer]
+
+		switch a.Kind {
+		case wire.ModGrant, wire.ModRevoke:
+			if !isOwner || a.target == "" {
+				continue
+			}
+			if a.Kind == wire.ModGrant {
+				mods[a.target] = true
+				delete(demoted, a.target)
+			} else if mods[a.target] {
+				delete(mods, a.target)
+				demoted[a.target] = true
+			}
+			keep[a.id] = a
+
+		case wire.ModAdmit, wire.ModRemove:
+			if !allowed || a.target == "" || (a.Kind == wire.ModRemove && (a.target == r.owner || (mods[a.target] && !isOwner))) {
+				continue
+			}
+			if a.Kind == wire.ModAdmit {
+				members[a.target] = true
+			} else {
+				delete(members, a.target)
+			}
+			membership[a.target] = a.id
+
+		case wire.ModKick, wire.ModBan:
+			if !allowed || a.target == "" || a.target == r.owner || (mods[a.target] && !isOwner) {
+				continue
+			}
+			s := Sanction{ID: a.target, By: a.issuer}
+			if a.Kind == wire.ModKick {
+				s.Until = time.UnixMilli(a.Until)
+			} else if mods[a.target] {
+				delete(mods, a.target) // a banned moderator is a moderator no more
+				demoted[a.target] = true
+			}
+			sanctions[a.target] = s
+			latest[a.target] = a.id
+
+		case wire.ModUnban:
+			if !allowed || a.target == "" {
+				continue
+			}
+			delete(sanctions, a.target)
+			latest[a.target] = a.id
+
+		case wire.ModTopic:
+			if !allowed {
+				continue
+			}
+			topic, topicID = a.Text, a.id
+		}
+	}
+
+	for _, id := range latest {
+		keep[id] = r.log[id]
+	}
+	for _, id := range membership {
+		keep[id] = r.log[id]
+	}
+	if topicID != "" {
+		keep[topicID] = r.log[topicID]
+	}
+	if len(keep) > maxLog {
+		// Drop the oldest sanctions and topic, never who moderates or
+		// who is a member
+		trimmed := slices.SortedFunc(mapValues(keep), func(a, b action) int { return cmp.Compare(b.Time, a.Time) })
+		room := maxLog
+		for _, a := range trimmed {
+			if permanent(a.Kind) {
+				room--
+			}
+		}
+		for _, a := range trimmed {
+			if permanent(a.Kind) {
+				continue
+			}
+			if room > 0 {
+				room--
+			} else {
+				delete(keep, a.id)
+			}
+		}
+	}
+
+	r.log = keep
+	r.mods = mods
+	r.demoted = demoted
+	r.members = members
+	r.sanctions = sanctions
+	r.topic = topic
+}
+
+// syncSoon republishes the log after a short random delay, at most once
+// per syncInterval, so that someone who just joined learns the room's
+// moderation even if the owner is away.
+func (r *Room) syncSoon(ctx context.Context) {
+	r.mu.Lock()
+	if len(r.log) == 0 || time.Since(r.lastSync) < syncInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastSync = time.Now()
+	r.mu.Unlock()
+
+	time.AfterFunc(rand.N(2*time.Second), func() {
+		if ctx.Err() != nil {
+			return
+		}
+		r.mu.RLock()
+		c := r.chat
+		r.mu.RUnlock()
+		for _, ctl := range r.syncControls() {
+			if c.PublishControl(ctl) != nil {
+				return
+			}
+		}
+	})
+}
+
+// syncControls splits the log into control messages that each fit in
+// one frame. Actions go oldest first, so what a moderator did arrives
+// before any revocation that would make us refuse it.
+func (r *Room) syncControls() []wire.Control {
+	r.mu.RLock()
+	ordered := slices.SortedFunc(mapValues(r.log), byTime)
+	r.mu.RUnlock()
+
+	var ctls []wire.Control
+	var ctl wire.Control
+	size := 0
+	for _, a := range ordered {
+		n := len(wire.Control{Actions: []wire.SignedModAction{a.signed}}.Marshal())
+		if size+n > chat.MaxControlSize && len(ctl.Actions) > 0 {
+			ctls = append(ctls, ctl)
+			ctl, size = wire.Control{}, 0
+		}
+		ctl.Actions = append(ctl.Actions, a.signed)
+		size += n
+	}
+	if len(ctl.Actions) > 0 {
+		ctls = append(ctls, ctl)
+	}
+	return ctls
+}
+
+// readLogs loads every room's log from path.
+func readLogs(path string) (map[string][]wire.SignedModAction, error) {
+	logs := make(map[string][]wire.SignedModAction)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return logs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &logs); err != nil {
+		return nil, fmt.Errorf("reading moderation log %s: %w", path, err)
+	}
+	return logs, nil
+}
+
+// saveMu keeps rooms that share a log file from saving over each other.
+var saveMu sync.Mutex
+
+// saveLocked writes this room's log back, leaving other rooms' alone.
+// r.mu must be held.
+func (r *Room) saveLocked() error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	logs, err := readLogs(r.path)
+	if err != nil {
+		return err
+	}
+	logs[r.room] = logs[r.room][:0]
+	for _, a := range r.log {
+		logs[r.room] = append(logs[r.room], a.signed)
+	}
+
+	data, err := json.MarshalIndent(logs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// removes reports whether kind takes someone out of the room, which
+// can't be done to the owner, nor to a moderator except by the owner.
+func removes(kind wire.ModKind) bool {
+	return kind == wire.ModKick || kind == wire.ModBan || kind == wire.ModRemove
+}
+
+// permanent reports whether actions of kind are exempt from trimming.
+func permanent(kind wire.ModKind) bool {
+	return kind == wire.ModGrant || kind == wire.ModRevoke || kind == wire.ModAdmit || kind == wire.ModRemove
+}
+
+// byTime orders actions by when they were signed, breaking ties by ID
+// so every peer replays them the same way.
+func byTime(a, b action) int {
+	return cmp.Or(cmp.Compare(a.Time, b.Time), strings.Compare(a.id, b.id))
+}
+
+func mapValues(m map[string]action) func(func(action) bool) {
+	return func(yield func(action) bool) {
+		for _, a := range m {
+			if !yield(a) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package moderation
+
+import (
+	"context"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+func TestSyncLargeRoom(t *testing.T) {
+	const members = 1000
+	ownerKey, owner := newIdentity(t)
+	room, err := OwnedRoom("big", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(room, ownerKey, filepath.Join(t.TempDir(), "owner.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A moderator admits half the room and is then revoked, so the
+	// sync only works if their admissions arrive before the revocation.
+	modKey, mod := newIdentity(t)
+	actions := []wire.SignedModAction{sign(t, ownerKey, room, wire.ModGrant, mod, 1)}
+	var ids []peer.ID
+	for i := range members {
+		_, id := newIdentity(t)
+		ids = append(ids, id)
+		key := ownerKey
+		if i%2 == 1 {
+			key = modKey
+		}
+		actions = append(actions, sign(t, key, room, wire.ModAdmit, id, int64(2+i)))
+	}
+	actions = append(actions, sign(t, ownerKey, room, wire.ModRevoke, mod, members+2))
+	r.apply(actions)
+
+	ctls := r.syncControls()
+	if len(ctls) < 2 {
+		t.Fatalf("sync fits in %d message, want it split", len(ctls))
+	}
+
+	newKey, _ := newIdentity(t)
+	joined, err := Open(room, newKey, filepath.Join(t.TempDir(), "new.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ctl := range ctls {
+		if n := len(ctl.Marshal()); n > chat.MaxControlSize {
+			t.Fatalf("message %d is %d bytes, limit is %d", i, n, chat.MaxControlSize)
+		}
+		joined.apply(ctl.Actions)
+	}
+	for _, id := range ids {
+		if !joined.Member(id) {
+			t.Fatalf("%s not admitted after sync", id)
+		}
+	}
+	if joined.Role(mod) != Member {
+		t.Fatal("revoked moderator still moderates after sync")
+	}
+}
+
+func newIdentity(t *testing.T) (crypto.PrivKey, peer.ID) {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, id
+}
+
+func sign(t *testing.T, priv crypto.PrivKey, room string, kind wire.ModKind, target peer.ID, at int64) wire.SignedModAction {
+	t.Helper()
+	issuer, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := wire.ModAction{Room: room, Kind: kind, Target: []byte(target), Time: at, Issuer: []byte(issuer)}.Marshal()
+	sig, err := priv.Sign(append([]byte(signContext), body...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wire.SignedModAction{Action: body, Signature: sig}
+}
+
+func TestValidateAuthority(t *testing.T) {
+	ownerKey, owner := newIdentity(t)
+	room, err := OwnedRoom("mods", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(room, ownerKey, filepath.Join(t.TempDir(), "mod.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modKey, mod := newIdentity(t)
+	memberKey, member := newIdentity(t)
+	_, relay := newIdentity(t)
+	_, target := newIdentity(t)
+	r.apply([]wire.SignedModAction{
+		sign(t, ownerKey, room, wire.ModGrant, mod, 1),
+		sign(t, ownerKey, room, wire.ModAdmit, member, 2),
+	})
+	newModKey, newMod := newIdentity(t)
+
+	tests := []struct {
+		name    string
+		from    peer.ID
+		actions []wire.SignedModAction
+		want    pubsub.ValidationResult
+	}{
+		{name: "owner kicks", from: owner, actions: []wire.SignedModAction{sign(t, ownerKey, room, wire.ModKick, target, 3)}, want: pubsub.ValidationAccept},
+		{name: "moderator kicks", from: mod, actions: []wire.SignedModAction{sign(t, modKey, room, wire.ModKick, target, 3)}, want: pubsub.ValidationAccept},
+		{name: "relayed moderator kick", from: relay, actions: []wire.SignedModAction{sign(t, modKey, room, wire.ModKick, target, 3)}, want: pubsub.ValidationAccept},
+		{name: "member kicks", from: member, actions: []wire.SignedModAction{sign(t, memberKey, room, wire.ModKick, target, 3)}, want: pubsub.ValidationReject},
+		{name: "relayed member kick", from: relay, actions: []wire.SignedModAction{sign(t, memberKey, room, wire.ModKick, target, 3)}, want: pubsub.ValidationIgnore},
+		{name: "member sets topic", from: member, actions: []wire.SignedModAction{sign(t, memberKey, room, wire.ModTopic, "", 3)}, want: pubsub.ValidationReject},
+		{name: "moderator grants", from: mod, actions: []wire.SignedModAction{sign(t, modKey, room, wire.ModGrant, member, 3)}, want: pubsub.ValidationReject},
+		{
+			name: "sync granting in the same message",
+			from: relay,
+			actions: []wire.SignedModAction{
+				sign(t, ownerKey, room, wire.ModGrant, newMod, 3),
+				sign(t, newModKey, room, wire.ModKick, target, 4),
+			},
+			want: pubsub.ValidationAccept,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := wire.New(wire.KindControl, wire.Control{Actions: tt.actions}.Marshal()).Marshal()
+			msg := &pubsub.Message{Message: &pb.Message{Data: data, Topic: &room, From: []byte(tt.from)}}
+			if got := r.Validate(context.Background(), tt.from, msg); got != tt.want {
+				t.Fatalf("Validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanAdmit(t *testing.T) {
+	ownerKey, owner := newIdentity(t)
+	room, err := OwnedRoom("invites", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(room, ownerKey, filepath.Join(t.TempDir(), "owned.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, mod := newIdentity(t)
+	_, member := newIdentity(t)
+	r.apply([]wire.SignedModAction{
+		sign(t, ownerKey, room, wire.ModGrant, mod, 1),
+		sign(t, ownerKey, room, wire.ModAdmit, member, 2),
+	})
+	if !r.CanAdmit(owner) || !r.CanAdmit(mod) {
+		t.Fatal("owner and moderator can't admit")
+	}
+	if r.CanAdmit(member) {
+		t.Fatal("member can admit")
+	}
+
+	open, err := Open("lobby", ownerKey, filepath.Join(t.TempDir(), "open.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open.CanAdmit(owner) {
+		t.Fatal("can admit to a room without an owner")
+	}
+}
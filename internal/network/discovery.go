@@ -2,11 +2,13 @@ package network
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 )
 
 const ServiceTag = "_ghost-chat-wifi"
@@ -21,7 +23,11 @@ func (n *discoveryNotifee) HandlePeerFound(pi peer.AddrInfo) {
 	if pi.ID == n.h.ID() {
 		return // ignore self
 	}
-	if err := n.h.Connect(context.Background(), pi); err != nil {
+	err := n.h.Connect(context.Background(), pi)
+	if errors.Is(err, swarm.ErrGaterDisallowedConnection) {
+		return // blocked
+	}
+	if err != nil {
 		fmt.Printf("⚠ failed to connect to peer %s: %v\n", pi.ID.String()[:8], err)
 	} else {
 
@@ -34,3 +40,16 @@ func SetupDiscovery(h host.Host) error {
 	svc := mdns.NewMdnsService(h, ServiceTag, n)
 	return svc.Start()
 }
+
+// Bootstrap dials peers at the given /p2p multiaddrs in the background,
+// e.g. ones remembered from an invite. Peers that can't be reached are
+// skipped; mDNS may still find them or others in the room.
+func Bootstrap(ctx context.Context, h host.Host, addrs []string) {
+	for _, s := range addrs {
+		pi, err := peer.AddrInfoFromString(s)
+		if err != nil || pi.ID == h.ID() {
+			continue
+		}
+		go h.Connect(ctx, *pi)
+	}
+}
@@ -2,29 +2,80 @@ package network
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+
+	"github.com/ekrishgupta/Hush/internal/config"
 )
 
-// NewHost creates a libp2p host listening on a random TCP port.
-// No relay, no DHT — purely local networking.
-func NewHost() (host.Host, error) {
-	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+// Identity files hold our private key, so peers see the same ID (and
+// safety number) every time we start. Each front end has its own, so
+// the terminal and desktop apps on one machine are two peers that see
+// each other rather than one that ignores itself. The terminal UI keeps
+// the name the key has always had.
+const (
+	TUIIdentity     = "identity.key"
+	DesktopIdentity = "identity-desktop.key"
+)
+
+// NewHost creates a libp2p host listening on a random TCP port, with
+// the key in identity, see TUIIdentity and DesktopIdentity. No relay,
+// no DHT — purely local networking. opts are applied after the
+// defaults, e.g. to install a connection gater.
+func NewHost(identity string, opts ...libp2p.Option) (host.Host, error) {
+	priv, err := LoadIdentity(identity)
 	if err != nil {
-		return nil, fmt.Errorf("generating key: %w", err)
+		return nil, err
 	}
 
-	h, err := libp2p.New(
+	opts = append([]libp2p.Option{
 		libp2p.Identity(priv),
 		libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0", "/ip4/127.0.0.1/tcp/0"),
 		libp2p.DisableRelay(),
-	)
+	}, opts...)
+	h, err := libp2p.New(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("creating libp2p host: %w", err)
 	}
 
 	return h, nil
 }
+
+// LoadIdentity reads the persistent key in the config file called name,
+// generating and saving one on first run.
+func LoadIdentity(name string) (crypto.PrivKey, error) {
+	path, err := config.Path(name)
+	if err != nil {
+		return nil, fmt.Errorf("locating identity: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		priv, err := crypto.UnmarshalPrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("reading identity %s: %w", path, err)
+		}
+		return priv, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading identity: %w", err)
+	}
+
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	data, err = crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("encoding key: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("saving identity: %w", err)
+	}
+	return priv, nil
+}
@@ -3,29 +3,103 @@ package network
 import (
 	"context"
 	"fmt"
+	"time"
 
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
+// TopicName is the room everyone is in unless an invite says otherwise.
 const TopicName = "local-gc"
 
-// SetupPubSub creates a GossipSub router and joins the global topic.
-func SetupPubSub(ctx context.Context, h host.Host) (*pubsub.Topic, *pubsub.Subscription, error) {
-	ps, err := pubsub.NewGossipSub(ctx, h)
+// NewPubSub creates a GossipSub router with the given options. Rooms
+// are joined on it with JoinRoom.
+func NewPubSub(ctx context.Context, h host.Host, opts ...pubsub.Option) (*pubsub.PubSub, error) {
+	ps, err := pubsub.NewGossipSub(ctx, h, opts...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("creating gossipsub: %w", err)
+		return nil, fmt.Errorf("creating gossipsub: %w", err)
 	}
+	return ps, nil
+}
 
-	topic, err := ps.Join(TopicName)
+// JoinRoom joins room's topic on ps and subscribes to it. If scored is
+// set, ps must have been created with PeerScore and the topic is scored
+// with RoomScore.
+func JoinRoom(ps *pubsub.PubSub, room string, scored bool) (*pubsub.Topic, *pubsub.Subscription, error) {
+	topic, err := ps.Join(room)
 	if err != nil {
-		return nil, nil, fmt.Errorf("joining topic %q: %w", TopicName, err)
+		return nil, nil, fmt.Errorf("joining topic %q: %w", room, err)
+	}
+	if scored {
+		if err := topic.SetScoreParams(RoomScore()); err != nil {
+			topic.Close()
+			return nil, nil, fmt.Errorf("scoring topic %q: %w", room, err)
+		}
 	}
 
 	sub, err := topic.Subscribe()
 	if err != nil {
-		return nil, nil, fmt.Errorf("subscribing to topic %q: %w", TopicName, err)
+		topic.Close()
+		return nil, nil, fmt.Errorf("subscribing to topic %q: %w", room, err)
 	}
 
 	return topic, sub, nil
 }
+
+// RoomScore returns the score parameters for one room's topic.
+func RoomScore() *pubsub.TopicScoreParams {
+	return &pubsub.TopicScoreParams{
+		TopicWeight: 1,
+
+		// Reward peers for being in the mesh and for relaying
+		// messages first, a little.
+		TimeInMeshWeight:  0.01,
+		TimeInMeshQuantum: time.Second,
+		TimeInMeshCap:     300,
+
+		FirstMessageDeliveriesWeight: 0.5,
+		FirstMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(10 * time.Minute),
+		FirstMessageDeliveriesCap:    20,
+
+		// Forged or malformed messages are punished hard.
+		InvalidMessageDeliveriesWeight: -100,
+		InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+	}
+}
+
+// PeerScore enables GossipSub peer scoring tuned for chat. Each room's
+// topic is scored as it is joined, see RoomScore.
+// appScore is the application's view of each peer, e.g. how much of its
+// traffic we have had to drop; peers it pushes far enough below zero
+// stop getting gossip from us, then have their messages ignored, then
+// are graylisted altogether.
+//
+// Mesh delivery penalties are off because chat is quiet most of the time
+// and bursty the rest, and IP colocation is off because several clients
+// on one machine is normal on a LAN.
+func PeerScore(appScore func(peer.ID) float64) pubsub.Option {
+	params := &pubsub.PeerScoreParams{
+		Topics:        make(map[string]*pubsub.TopicScoreParams),
+		TopicScoreCap: 20,
+
+		AppSpecificScore:  appScore,
+		AppSpecificWeight: 1,
+
+		BehaviourPenaltyWeight:    -10,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(10 * time.Minute),
+
+		DecayInterval: time.Second,
+		DecayToZero:   0.01,
+		RetainScore:   10 * time.Minute,
+	}
+	thresholds := &pubsub.PeerScoreThresholds{
+		GossipThreshold:             -10,
+		PublishThreshold:            -50,
+		GraylistThreshold:           -80,
+		AcceptPXThreshold:           5,
+		OpportunisticGraftThreshold: 2,
+	}
+	return pubsub.WithPeerScore(params, thresholds)
+}
@@ -0,0 +1,272 @@
+// Package rooms keeps several chat rooms joined at once on one GossipSub
+// router. Each room has its own chat, moderation and, if it has an
+// owner, sender keys; file transfer and the trust store watch them all.
+package rooms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/config"
+	"github.com/ekrishgupta/Hush/internal/groupkey"
+	"github.com/ekrishgupta/Hush/internal/moderation"
+	"github.com/ekrishgupta/Hush/internal/network"
+	"github.com/ekrishgupta/Hush/internal/transfer"
+	"github.com/ekrishgupta/Hush/internal/trust"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// MaxRooms bounds how many rooms can be joined at once.
+const MaxRooms = 16
+
+var (
+	// ErrNotJoined means the room isn't one we are in.
+	ErrNotJoined = errors.New("not in that room")
+	// ErrLastRoom means leaving would leave us in no room at all.
+	ErrLastRoom = errors.New("can't leave the only room")
+	// ErrTooMany means MaxRooms are already joined.
+	ErrTooMany = fmt.Errorf("already in %d rooms", MaxRooms)
+)
+
+// Room is one joined room.
+type Room struct {
+	Name   string
+	Chat   *chat.Chat
+	Mod    *moderation.Room
+	Keys   *groupkey.Keys     // nil unless the room has an owner
+	Alerts <-chan trust.Alert // nil without a trust store
+
+	topic  *pubsub.Topic
+	sub    *pubsub.Subscription
+	events *chat.Subscription
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Events returns the room's chat messages, for the UI. It is closed
+// when the room is left or the context it was joined with ends.
+func (r *Room) Events() <-chan chat.Event {
+	return r.events.C()
+}
+
+// Done is closed when the room is left or the context it was joined
+// with ends.
+func (r *Room) Done() <-chan struct{} {
+	return r.ctx.Done()
+}
+
+// Services are what the rooms share. Files and Trust may be nil.
+type Services struct {
+	Limiter *chat.Limiter // also behind the GossipSub peer score
+	Scored  bool          // the router was created with network.PeerScore
+	Files   *transfer.Service
+	Trust   *trust.Store
+	ModPath string // moderation logs, see moderation.DefaultPath
+}
+
+// Manager joins and leaves rooms, remembering them in the config's
+// Rooms so they can be joined again on the next start.
+type Manager struct {
+	h    host.Host
+	ps   *pubsub.PubSub
+	cfg  *config.Config
+	svc  Services
+	keys *groupkey.Exchange
+
+	mu    sync.Mutex
+	name  string
+	rooms []*Room // in the order they were joined
+}
+
+// New returns a manager joining rooms on ps, which must have been
+// created on h.
+func New(h host.Host, ps *pubsub.PubSub, cfg *config.Config, svc Services) *Manager {
+	if svc.Limiter == nil {
+		svc.Limiter = chat.NewLimiter(chat.DefaultReceiveRate, chat.DefaultReceiveBurst)
+	}
+	return &Manager{
+		h:    h,
+		ps:   ps,
+		cfg:  cfg,
+		svc:  svc,
+		keys: groupkey.NewExchange(h),
+	}
+}
+
+// Rooms returns the joined rooms in the order they were joined.
+func (m *Manager) Rooms() []*Room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.rooms)
+}
+
+// Get returns the joined room called name.
+func (m *Manager) Get(name string) (*Room, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.indexLocked(name)
+	if i < 0 {
+		return nil, false
+	}
+	return m.rooms[i], true
+}
+
+// Admit makes id a member of the joined room called name, for an
+// invite that was redeemed with us.
+func (m *Manager) Admit(name string, id peer.ID) error {
+	r, ok := m.Get(name)
+	if !ok {
+		return ErrNotJoined
+	}
+	return r.Mod.Admit(id)
+}
+
+func (m *Manager) indexLocked(name string) int {
+	return slices.IndexFunc(m.rooms, func(r *Room) bool { return r.Name == name })
+}
+
+// SetName sets the display name announced in every room, including
+// those joined later.
+func (m *Manager) SetName(name string) {
+	m.mu.Lock()
+	m.name = name
+	rooms := slices.Clone(m.rooms)
+	m.mu.Unlock()
+
+	for _, r := range rooms {
+		r.Chat.SetName(name)
+	}
+}
+
+// Join joins the room called name until ctx is done or it is left. If
+// we are already in it, Join returns it as it is.
+func (m *Manager) Join(ctx context.Context, name string) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.indexLocked(name); i >= 0 {
+		return m.rooms[i], nil
+	}
+	if len(m.rooms) >= MaxRooms {
+		return nil, ErrTooMany
+	}
+
+	// Kicks and bans are enforced before messages reach the chat
+	mod, err := moderation.Open(name, m.h.Peerstore().PrivKey(m.h.ID()), m.svc.ModPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ps.RegisterTopicValidator(name, mod.Validate); err != nil {
+		return nil, fmt.Errorf("joining %q: %w", name, err)
+	}
+	topic, sub, err := network.JoinRoom(m.ps, name, m.svc.Scored)
+	if err != nil {
+		m.ps.UnregisterTopicValidator(name)
+		return nil, err
+	}
+
+	r := &Room{Name: name, Mod: mod, topic: topic, sub: sub}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+
+	// Owned rooms are encrypted, with keys rotated as members leave
+	opts := []chat.Option{chat.WithLimiter(m.svc.Limiter)}
+	if mod.Owned() {
+		r.Keys = m.keys.Join(name, mod.Member)
+		r.Keys.Watch(r.ctx, topic)
+		opts = append(opts, chat.WithSealer(r.Keys))
+	}
+	r.Chat = chat.NewChat(topic, sub, m.h.ID(), opts...)
+
+	if m.svc.Files != nil {
+		// Files offered in an encrypted room stay with its members
+		var member func(peer.ID) bool
+		if mod.Owned() {
+			member = mod.Member
+		}
+		m.svc.Files.Watch(r.ctx, r.Chat, member)
+	}
+	if m.svc.Trust != nil {
+		r.Alerts = m.svc.Trust.Watch(r.ctx, r.Chat)
+	}
+	mod.Watch(r.ctx, r.Chat)
+
+	// The UI gets its own broker subscription so a slow render never
+	// stalls gossip consumption.
+	r.events = r.Chat.Subscribe(chat.SubscribeOptions{
+		Filter: chat.Filter{Kinds: []wire.Kind{wire.KindChat}},
+		Buffer: 256,
+		Policy: chat.DropOldest,
+	})
+	r.Chat.Start(r.ctx)
+	go func() {
+		<-r.ctx.Done()
+		r.events.Close()
+	}()
+	if m.name != "" {
+		r.Chat.SetName(m.name)
+	}
+
+	m.rooms = append(m.rooms, r)
+	return r, m.cfg.Update(func(cfg *config.Config) {
+		if !slices.Contains(cfg.Rooms, name) {
+			cfg.Rooms = append(cfg.Rooms, name)
+		}
+	})
+}
+
+// Leave leaves the room called name. The last room can't be left.
+func (m *Manager) Leave(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexLocked(name)
+	if i < 0 {
+		return ErrNotJoined
+	}
+	if len(m.rooms) == 1 {
+		return ErrLastRoom
+	}
+	r := m.rooms[i]
+	m.rooms = slices.Delete(m.rooms, i, i+1)
+
+	r.cancel()
+	r.sub.Cancel()
+	m.keys.Leave(name)
+	m.ps.UnregisterTopicValidator(name)
+	go closeTopic(r.topic)
+	return m.cfg.Update(func(cfg *config.Config) {
+		cfg.Rooms = slices.DeleteFunc(cfg.Rooms, func(v string) bool { return v == name })
+	})
+}
+
+// Focus remembers name as the room to show first on the next start.
+func (m *Manager) Focus(name string) error {
+	return m.cfg.Update(func(cfg *config.Config) { cfg.Room = name })
+}
+
+// Update changes the settings with fn and saves them, e.g. to keep an
+// invite's bootstrap addresses.
+func (m *Manager) Update(fn func(*config.Config)) error {
+	return m.cfg.Update(fn)
+}
+
+// closeTopic closes a topic we left. It can't be closed while the
+// room's peer event handlers are open, and they stop on their own
+// shortly after the room's context is cancelled.
+func closeTopic(t *pubsub.Topic) {
+	for range 20 {
+		if t.Close() == nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
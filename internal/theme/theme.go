@@ -0,0 +1,203 @@
+// Package theme loads the color schemes shared by the terminal UI and
+// the GUI: a palette for lipgloss styles and CSS variables, and a
+// glamour style for markdown. dark, light and high-contrast are built
+// in; users add their own as JSON files in Dir.
+package theme
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/glamour/ansi"
+	"github.com/charmbracelet/glamour/styles"
+
+	"github.com/ekrishgupta/Hush/internal/config"
+)
+
+// Default is the theme the GUI uses when none has been chosen.
+const Default = "dark"
+
+//go:embed themes/*.json
+var builtin embed.FS
+
+var (
+	// ErrNotFound means there is no theme by that name.
+	ErrNotFound = errors.New("no such theme")
+
+	validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	validHex  = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+)
+
+// Palette is a theme's colors, as #RRGGBB or #RGB.
+type Palette struct {
+	Accent     string `json:"accent"`     // banner, borders, roles
+	Highlight  string `json:"highlight"`  // peers' names, the cursor, unread counts
+	Self       string `json:"self"`       // our own name, verified marks
+	Text       string `json:"text"`       // message text
+	Muted      string `json:"muted"`      // timestamps, dividers, hints
+	Warning    string `json:"warning"`    // warnings and errors
+	Selection  string `json:"selection"`  // behind the selected message
+	Background string `json:"background"` // the GUI's; the terminal keeps its own
+}
+
+// Theme is a palette and markdown style, as stored in a theme file:
+//
+//	{
+//	  "colors": {"accent": "#B388FF", "highlight": "#FF80AB", …},
+//	  "markdown": "dracula"
+//	}
+//
+// markdown is the name of one of glamour's styles (dark, light,
+// dracula, tokyo-night, pink, ascii, notty) or a glamour style object.
+type Theme struct {
+	Name     string          `json:"-"` // from the file name
+	Colors   Palette         `json:"colors"`
+	Markdown json.RawMessage `json:"markdown,omitempty"`
+
+	markdown ansi.StyleConfig
+}
+
+// Dir returns the directory user themes are read from, creating it if
+// needed.
+func Dir() (string, error) {
+	dir, err := config.Path("themes")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Names lists the themes that can be loaded, built-in and user ones,
+// sorted.
+func Names() ([]string, error) {
+	var names []string
+	builtins, _ := fs.Glob(builtin, "themes/*.json")
+	for _, path := range builtins {
+		names = append(names, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	users, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range users {
+		if name := strings.TrimSuffix(filepath.Base(path), ".json"); validName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// Load reads the theme called name. A user theme takes the place of a
+// built-in one with the same name.
+func Load(name string) (*Theme, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("%w %q", ErrNotFound, name)
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = builtin.ReadFile("themes/" + name + ".json")
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w %q", ErrNotFound, name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("theme %s: %w", name, err)
+	}
+	t.Name = name
+	return t, nil
+}
+
+// Parse reads a theme file. Every color but the background is needed.
+func Parse(data []byte) (*Theme, error) {
+	var t Theme
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+
+	c := t.Colors
+	for _, v := range []struct{ name, hex string }{
+		{"accent", c.Accent}, {"highlight", c.Highlight}, {"self", c.Self},
+		{"text", c.Text}, {"muted", c.Muted}, {"warning", c.Warning},
+		{"selection", c.Selection}, {"background", c.Background},
+	} {
+		if v.hex == "" && v.name == "background" {
+			continue
+		}
+		if !validHex.MatchString(v.hex) {
+			return nil, fmt.Errorf("color %s: want #RRGGBB or #RGB, got %q", v.name, v.hex)
+		}
+	}
+
+	// Resolve the markdown style now so a bad one is reported on load
+	md := bytes.TrimSpace(t.Markdown)
+	switch {
+	case len(md) == 0:
+		t.markdown = styles.DarkStyleConfig
+	case md[0] == '"':
+		var name string
+		if err := json.Unmarshal(md, &name); err != nil {
+			return nil, fmt.Errorf("markdown: %w", err)
+		}
+		style, ok := styles.DefaultStyles[name]
+		if !ok {
+			return nil, fmt.Errorf("markdown: no glamour style %q", name)
+		}
+		t.markdown = *style
+	default:
+		if err := json.Unmarshal(md, &t.markdown); err != nil {
+			return nil, fmt.Errorf("markdown: %w", err)
+		}
+	}
+	return &t, nil
+}
+
+// MarkdownStyle returns the glamour style messages are rendered with.
+func (t *Theme) MarkdownStyle() ansi.StyleConfig {
+	return t.markdown
+}
+
+// CSS returns the palette as the GUI's CSS custom properties.
+func (t *Theme) CSS() map[string]string {
+	c := t.Colors
+	vars := map[string]string{
+		"--ghost-purple": c.Accent,
+		"--ghost-pink":   c.Highlight,
+		"--soft-green":   c.Self,
+		"--warm-white":   c.Text,
+		"--dim-gray":     c.Muted,
+		"--warning-red":  c.Warning,
+		"--selection":    c.Selection,
+	}
+	if c.Background != "" {
+		vars["--bg"] = c.Background
+	}
+	return vars
+}
@@ -0,0 +1,69 @@
+// Package thumbnail makes the small previews sent inline with image
+// attachments.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"strings"
+
+	// Formats we can preview.
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxDim is the longest side of a thumbnail, in pixels.
+const MaxDim = 240
+
+// ErrTooLarge means no quality setting got the preview under the limit.
+var ErrTooLarge = errors.New("thumbnail too large")
+
+// IsImage reports whether a MIME type is worth previewing.
+func IsImage(mime string) bool {
+	return strings.HasPrefix(mime, "image/")
+}
+
+// Make decodes an image from r and returns a JPEG no larger than
+// maxBytes whose longest side is at most MaxDim.
+func Make(r io.Reader, maxBytes int) ([]byte, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return nil, errors.New("empty image")
+	}
+	if w > MaxDim || h > MaxDim {
+		if w >= h {
+			w, h = MaxDim, max(1, h*MaxDim/w)
+		} else {
+			w, h = max(1, w*MaxDim/h), MaxDim
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+	// Step the quality down until it fits; photos with lots of detail
+	// can overshoot at the first setting.
+	var buf bytes.Buffer
+	for _, q := range []int{75, 60, 45, 30} {
+		buf.Reset()
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: q}); err != nil {
+			return nil, err
+		}
+		if buf.Len() <= maxBytes {
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, ErrTooLarge
+}
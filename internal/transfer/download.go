@@ -0,0 +1,258 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"lukechampine.com/blake3"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+const (
+	// maxAttempts is how many times a download is resumed after the
+	// connection drops before giving up.
+	maxAttempts = 5
+
+	retryDelay = 2 * time.Second
+)
+
+// Download fetches an attachment in the background, from the peer that
+// offered it or any other peer that announced it has the blob cached.
+// Progress and the final result arrive on Updates. Partial data is kept
+// on disk, so calling Download again for the same file (even after a
+// restart) resumes where it stopped, whichever peer serves the rest.
+// c is the room the offer was made in, where we announce that we can
+// serve the file too.
+func (s *Service) Download(ctx context.Context, c *chat.Chat, from peer.ID, att chat.Attachment) {
+	s.mu.Lock()
+	if _, busy := s.active[att.Hash]; busy {
+		s.mu.Unlock()
+		return
+	}
+	s.active[att.Hash] = struct{}{}
+	s.offeredLocked(c.Room(), att.Hash)
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.active, att.Hash)
+			s.mu.Unlock()
+		}()
+
+		path, err := s.download(ctx, c, from, att)
+		p := Progress{Hash: att.Hash, Name: att.Name, Received: att.Size, Size: att.Size, Done: true, Path: path}
+		if err != nil {
+			p.Err = err.Error()
+			p.Path = ""
+		}
+		s.report(p)
+	}()
+}
+
+func (s *Service) download(ctx context.Context, c *chat.Chat, from peer.ID, att chat.Attachment) (string, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", err
+	}
+
+	if !s.store.Has(att.Hash) {
+		if err := s.fetchAny(ctx, from, att); err != nil {
+			return "", err
+		}
+		// Best effort: if nobody hears this they'll just ask the offerer.
+		_ = c.AnnounceHave(att.Hash)
+	}
+
+	dst := uniquePath(filepath.Join(s.dir, safeName(att.Name)))
+	if err := s.store.Export(att.Hash, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// fetchAny downloads att into the store, rotating between sources as
+// they fail.
+func (s *Service) fetchAny(ctx context.Context, from peer.ID, att chat.Attachment) error {
+	sources := s.sources(from, att.Hash)
+	part := s.store.PartialPath(att.Hash)
+
+	err := ErrNotShared
+	for attempt := 1; attempt <= maxAttempts && len(sources) > 0; attempt++ {
+		src := sources[(attempt-1)%len(sources)]
+		err = s.fetch(ctx, src, att, part)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		if errors.Is(err, ErrNotShared) {
+			// Evicted or never had it; don't count this as an attempt.
+			sources = slices.DeleteFunc(sources, func(id peer.ID) bool { return id == src })
+			attempt--
+			continue
+		}
+		select {
+		case <-time.After(retryDelay * time.Duration(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := verify(part, att.Hash); err != nil {
+		os.Remove(part)
+		return err
+	}
+	return s.store.Import(part, att.Hash, att.Name)
+}
+
+// sources lists peers to try for hash: announced holders first, to
+// spread load, then the offerer.
+func (s *Service) sources(from peer.ID, hash string) []peer.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []peer.ID
+	for id := range s.holders[hash] {
+		if id != from && id != s.h.ID() {
+			ids = append(ids, id)
+		}
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	if from != "" && from != s.h.ID() {
+		ids = append(ids, from)
+	}
+	return ids
+}
+
+// fetch appends the rest of the file to part, starting from whatever
+// is already there.
+func (s *Service) fetch(ctx context.Context, from peer.ID, att chat.Attachment, part string) error {
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > att.Size {
+		// Not the file we expected; start over.
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		offset, _ = f.Seek(0, io.SeekStart)
+	}
+	if offset == att.Size {
+		return nil
+	}
+
+	st, err := s.h.NewStream(ctx, from, ProtocolID)
+	if err != nil {
+		return fmt.Errorf("opening stream to %s: %w", from, err)
+	}
+	defer st.Close()
+
+	req := wire.FileRequest{Hash: att.Hash, Offset: uint64(offset)}
+	if err := wire.WriteDelimited(st, req.Marshal()); err != nil {
+		return err
+	}
+	if err := st.CloseWrite(); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(st)
+	b, err := wire.ReadDelimited(r)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	resp, err := wire.UnmarshalFileResponse(b)
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		if resp.Error == ErrNotShared.Error() {
+			return ErrNotShared
+		}
+		return errors.New(resp.Error)
+	}
+	if int64(resp.Size) != att.Size {
+		return fmt.Errorf("peer has %d bytes, offer said %d", resp.Size, att.Size)
+	}
+
+	buf := make([]byte, chunkSize)
+	received := offset
+	for received < att.Size {
+		n, err := io.ReadFull(r, buf[:min(int64(len(buf)), att.Size-received)])
+		if n > 0 {
+			if _, werr := f.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			received += int64(n)
+			s.report(Progress{Hash: att.Hash, Name: att.Name, Received: received, Size: att.Size})
+		}
+		if err != nil {
+			return fmt.Errorf("transfer interrupted at %d of %d bytes: %w", received, att.Size, err)
+		}
+	}
+	return nil
+}
+
+// verify checks the BLAKE3 hash of the file at path.
+func verify(path, want string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := blake3.New(32, nil)
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	wantSum, err := hex.DecodeString(want)
+	if err != nil || !bytes.Equal(h.Sum(nil), wantSum) {
+		return ErrHashMismatch
+	}
+	return nil
+}
+
+// safeName strips any directory components a peer put in the name.
+func safeName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" || strings.HasPrefix(name, ".") {
+		name = "download" + name
+	}
+	return name
+}
+
+// uniquePath appends " (n)" before the extension until path is unused.
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			return p
+		}
+	}
+}
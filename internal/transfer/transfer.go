@@ -0,0 +1,438 @@
+// Package transfer implements peer-to-peer file transfer over the
+// /hush/file/1.0.0 stream protocol. Files are offered in chat as
+// attachments keyed by their BLAKE3 hash, downloaded straight from the
+// offerer or any other peer that has cached them, resumed after
+// interruptions and verified before use.
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"lukechampine.com/blake3"
+
+	"github.com/ekrishgupta/Hush/internal/blobstore"
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/thumbnail"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// ProtocolID is the libp2p stream protocol for file transfer.
+const ProtocolID protocol.ID = "/hush/file/1.0.0"
+
+// chunkSize is how much we copy between progress updates.
+const chunkSize = 64 << 10
+
+var (
+	// ErrNotShared means the peer isn't offering the requested file.
+	ErrNotShared = errors.New("file is not shared by this peer")
+	// ErrHashMismatch means the downloaded bytes don't match the offer.
+	ErrHashMismatch = errors.New("downloaded file failed hash verification")
+)
+
+// Progress reports on a transfer. Exactly one of Err or Path is set
+// once Done is true.
+type Progress struct {
+	Hash     string `json:"hash"`
+	Name     string `json:"name"`
+	Received int64  `json:"received"`
+	Size     int64  `json:"size"`
+	Done     bool   `json:"done"`
+	Path     string `json:"path,omitempty"`
+	Err      string `json:"error,omitempty"`
+}
+
+// Service shares local files with peers and downloads theirs.
+// Everything downloaded lands in the blob store first, and we serve from
+// it too, so a popular file doesn't have to come from the offerer alone.
+//
+// A file is only served to peers who could have seen it offered: not
+// blocked, and a member of a room it was offered in if that room is
+// encrypted. Files that weren't offered in a room we are in, such as
+// ones cached before a restart, aren't served at all.
+type Service struct {
+	h       host.Host
+	store   *blobstore.Store
+	dir     string
+	blocked func(peer.ID) bool
+
+	mu      sync.Mutex
+	shared  map[string]string               // hash -> local path
+	rooms   map[string]map[string]struct{}  // hash -> rooms it was offered in
+	access  map[string]func(peer.ID) bool   // joined room -> who may fetch its files, nil for anyone
+	active  map[string]struct{}             // hashes being downloaded
+	holders map[string]map[peer.ID]struct{} // hash -> peers that announced it
+	backlog []Progress                      // final updates waiting for room in updates
+	drainer bool                            // drainBacklog is running
+
+	updates chan Progress
+}
+
+// Option configures a Service.
+type Option func(*Service)
+
+// WithBlocked refuses files to peers that blocked reports, e.g. the
+// block list.
+func WithBlocked(blocked func(peer.ID) bool) Option {
+	return func(s *Service) {
+		s.blocked = blocked
+	}
+}
+
+// NewService registers the stream handler on h. Downloads are cached
+// in store and copied into dir, which is created if needed.
+func NewService(h host.Host, store *blobstore.Store, dir string, opts ...Option) *Service {
+	s := &Service{
+		h:       h,
+		store:   store,
+		dir:     dir,
+		shared:  make(map[string]string),
+		rooms:   make(map[string]map[string]struct{}),
+		access:  make(map[string]func(peer.ID) bool),
+		active:  make(map[string]struct{}),
+		holders: make(map[string]map[peer.ID]struct{}),
+		updates: make(chan Progress, 64),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	h.SetStreamHandler(ProtocolID, s.handleStream)
+	return s
+}
+
+// Watch tracks which files are offered in c and which peers can serve
+// them, until ctx is done. Files offered in c are served to the peers
+// member allows, or to anyone if member is nil. Call it for every room,
+// before c.Start.
+func (s *Service) Watch(ctx context.Context, c *chat.Chat, member func(peer.ID) bool) {
+	room := c.Room()
+	s.mu.Lock()
+	s.access[room] = member
+	s.mu.Unlock()
+
+	sub := c.Subscribe(chat.SubscribeOptions{Filter: chat.Filter{Kinds: []wire.Kind{wire.KindFile, wire.KindChat}}})
+	go s.trackHolders(ctx, room, sub)
+}
+
+// offeredLocked records that hash was offered in room. s.mu must be held.
+func (s *Service) offeredLocked(room, hash string) {
+	if s.rooms[hash] == nil {
+		s.rooms[hash] = make(map[string]struct{})
+	}
+	s.rooms[hash][room] = struct{}{}
+}
+
+// allowed reports whether we serve hash to id.
+func (s *Service) allowed(hash string, id peer.ID) bool {
+	if s.blocked != nil && s.blocked(id) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for room := range s.rooms[hash] {
+		if member, ok := s.access[room]; ok && (member == nil || member(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store returns the attachment cache.
+func (s *Service) Store() *blobstore.Store {
+	return s.store
+}
+
+func (s *Service) trackHolders(ctx context.Context, room string, sub *chat.Subscription) {
+	defer sub.Close()
+	defer func() {
+		s.mu.Lock()
+		delete(s.access, room)
+		s.mu.Unlock()
+	}()
+	for {
+		select {
+		case ev, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			if a := ev.Message.Attachment; ev.Kind == wire.KindChat && a != nil {
+				s.offeredLocked(room, a.Hash)
+			}
+			for _, hash := range ev.Hashes {
+				if s.holders[hash] == nil {
+					s.holders[hash] = make(map[peer.ID]struct{})
+				}
+				s.holders[hash][ev.From] = struct{}{}
+			}
+			s.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// DefaultDir returns where downloads go: ~/Downloads/Hush.
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "Hush")
+	}
+	return filepath.Join(home, "Downloads", "Hush")
+}
+
+// Updates returns the channel transfer progress is reported on.
+// Intermediate updates are dropped if nobody keeps up; final ones
+// (Done) are not.
+func (s *Service) Updates() <-chan Progress {
+	return s.updates
+}
+
+// Share hashes the file at path and starts serving it to c's room. The
+// returned attachment can be published there; images come with a
+// thumbnail.
+func (s *Service) Share(c *chat.Chat, path string) (chat.Attachment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return chat.Attachment{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return chat.Attachment{}, err
+	}
+	if info.IsDir() {
+		return chat.Attachment{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	h := blake3.New(32, nil)
+	if _, err := io.Copy(h, f); err != nil {
+		return chat.Attachment{}, fmt.Errorf("hashing %s: %w", path, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return chat.Attachment{}, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	s.shared[hash] = path
+	s.offeredLocked(c.Room(), hash)
+	s.mu.Unlock()
+
+	att := chat.Attachment{Hash: hash, Name: filepath.Base(path), Size: info.Size()}
+	describe(&att, f)
+	return att, nil
+}
+
+// ShareData is Share for content that isn't a file yet, such as an
+// image pasted from the clipboard. It is written to the cache and served
+// from there.
+func (s *Service) ShareData(c *chat.Chat, name string, data []byte) (chat.Attachment, error) {
+	sum := blake3.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if !s.store.Has(hash) {
+		part := s.store.PartialPath(hash)
+		if err := os.WriteFile(part, data, 0o644); err != nil {
+			return chat.Attachment{}, err
+		}
+		if err := s.store.Import(part, hash, name); err != nil {
+			return chat.Attachment{}, err
+		}
+	}
+
+	s.mu.Lock()
+	s.offeredLocked(c.Room(), hash)
+	s.mu.Unlock()
+
+	att := chat.Attachment{Hash: hash, Name: safeName(name), Size: int64(len(data))}
+	describe(&att, bytes.NewReader(data))
+	return att, nil
+}
+
+// SaveAs copies a file we have, cached or shared by us, to dst.
+func (s *Service) SaveAs(hash, dst string) error {
+	if s.store.Has(hash) {
+		return s.store.Export(hash, dst)
+	}
+
+	f, err := s.Open(hash)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// describe fills in the MIME type from the content, a thumbnail for
+// images and the first lines of text files. A preview that can't be
+// made is simply left out.
+func describe(att *chat.Attachment, r io.ReadSeeker) {
+	head := make([]byte, chat.MaxPreviewSize)
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+	att.Mime = http.DetectContentType(head)
+
+	switch {
+	case strings.HasPrefix(att.Mime, "text/"):
+		att.Preview = textPreview(head)
+	case thumbnail.IsImage(att.Mime):
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		if thumb, err := thumbnail.Make(r, chat.MaxThumbnailSize); err == nil {
+			att.Thumbnail = thumb
+		}
+	}
+}
+
+// previewLines is how many lines of a text file go in its preview.
+const previewLines = 6
+
+func textPreview(head []byte) string {
+	lines := strings.SplitN(string(head), "\n", previewLines+1)
+	lines = lines[:min(len(lines), previewLines)]
+	return strings.ToValidUTF8(strings.Join(lines, "\n"), "")
+}
+
+// handleStream serves one FileRequest, from a file we shared or from
+// the cache. Peers who may not have the file are told we don't.
+func (s *Service) handleStream(st network.Stream) {
+	defer st.Close()
+
+	req, err := readRequest(st)
+	if err != nil {
+		_ = st.Reset()
+		return
+	}
+	if !s.allowed(req.Hash, st.Conn().RemotePeer()) {
+		_ = writeResponse(st, wire.FileResponse{Error: ErrNotShared.Error()})
+		return
+	}
+
+	f, err := s.Open(req.Hash)
+	if err != nil {
+		msg := "file is no longer available"
+		if errors.Is(err, ErrNotShared) {
+			msg = ErrNotShared.Error()
+		}
+		_ = writeResponse(st, wire.FileResponse{Error: msg})
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || uint64(info.Size()) < req.Offset {
+		_ = writeResponse(st, wire.FileResponse{Error: "bad offset"})
+		return
+	}
+	if _, err := f.Seek(int64(req.Offset), io.SeekStart); err != nil {
+		_ = writeResponse(st, wire.FileResponse{Error: "bad offset"})
+		return
+	}
+
+	if err := writeResponse(st, wire.FileResponse{Size: uint64(info.Size())}); err != nil {
+		return
+	}
+	_, _ = io.Copy(st, f)
+}
+
+// Open returns the content of a file we have, shared by us or cached,
+// or ErrNotShared.
+func (s *Service) Open(hash string) (*os.File, error) {
+	s.mu.Lock()
+	path, ok := s.shared[hash]
+	s.mu.Unlock()
+	if ok {
+		return os.Open(path)
+	}
+
+	f, err := s.store.Open(hash)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, ErrNotShared
+	}
+	return f, err
+}
+
+func readRequest(r io.Reader) (wire.FileRequest, error) {
+	b, err := wire.ReadDelimited(bufio.NewReader(r))
+	if err != nil {
+		return wire.FileRequest{}, err
+	}
+	return wire.UnmarshalFileRequest(b)
+}
+
+func writeResponse(w io.Writer, resp wire.FileResponse) error {
+	return wire.WriteDelimited(w, resp.Marshal())
+}
+
+// report sends p on updates without ever blocking the download. When
+// nobody is reading, intermediate updates are dropped and final ones
+// wait in the backlog, delivered in order once there is room.
+func (s *Service) report(p Progress) {
+	if !p.Done {
+		select {
+		case s.updates <- p:
+		default:
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.drainer {
+		select {
+		case s.updates <- p:
+			return
+		default:
+		}
+		s.drainer = true
+		go s.drainBacklog()
+	}
+	s.backlog = append(s.backlog, p)
+}
+
+// drainBacklog delivers the final updates report couldn't, until none
+// are left.
+func (s *Service) drainBacklog() {
+	for {
+		s.mu.Lock()
+		if len(s.backlog) == 0 {
+			s.drainer = false
+			s.mu.Unlock()
+			return
+		}
+		p := s.backlog[0]
+		s.mu.Unlock()
+
+		s.updates <- p
+
+		s.mu.Lock()
+		s.backlog = s.backlog[1:]
+		s.mu.Unlock()
+	}
+}
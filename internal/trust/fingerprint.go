@@ -0,0 +1,96 @@
+// Package trust lets people confirm who they are talking to. Every peer
+// ID gets a safety number and word list that two people can compare out
+// of band, and a local trust-on-first-use store remembers which key each
+// name has used so a newcomer borrowing a known name stands out.
+package trust
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// fingerprintIterations slows down brute-forcing a key whose
+// fingerprint collides with someone else's, as Signal does.
+const fingerprintIterations = 5200
+
+// fingerprint returns the 30-digit fingerprint of a peer's public key.
+func fingerprint(id peer.ID) (string, error) {
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return "", fmt.Errorf("peer %s has no embedded key: %w", id, err)
+	}
+	key, err := crypto.MarshalPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha512.Sum512(append([]byte("hush-fingerprint-v1"), key...))
+	for range fingerprintIterations {
+		sum = sha512.Sum512(append(sum[:], key...))
+	}
+
+	// Six 5-digit chunks, each from 5 bytes of the hash.
+	var b strings.Builder
+	for i := range 6 {
+		var chunk [8]byte
+		copy(chunk[3:], sum[i*5:i*5+5])
+		fmt.Fprintf(&b, "%05d", binary.BigEndian.Uint64(chunk[:])%100000)
+	}
+	return b.String(), nil
+}
+
+// pair orders two fingerprints the same way on both ends, so each side
+// computes the same code.
+func pair(a, b peer.ID) (string, string, error) {
+	fa, err := fingerprint(a)
+	if err != nil {
+		return "", "", err
+	}
+	fb, err := fingerprint(b)
+	if err != nil {
+		return "", "", err
+	}
+	if fa > fb {
+		fa, fb = fb, fa
+	}
+	return fa, fb, nil
+}
+
+// SafetyNumber returns the 60-digit code for the conversation between
+// self and peer, in twelve groups of five. Both people see the same
+// number; if it matches when read aloud, nobody is in the middle.
+func SafetyNumber(self, peer peer.ID) (string, error) {
+	fa, fb, err := pair(self, peer)
+	if err != nil {
+		return "", err
+	}
+	digits := fa + fb
+
+	groups := make([]string, 0, len(digits)/5)
+	for i := 0; i < len(digits); i += 5 {
+		groups = append(groups, digits[i:i+5])
+	}
+	return strings.Join(groups, " "), nil
+}
+
+// Words returns the same code as a short list of words, easier to read
+// over a call than sixty digits.
+func Words(self, peer peer.ID) ([]string, error) {
+	fa, fb, err := pair(self, peer)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha512.Sum512(bytes.Join([][]byte{[]byte(fa), []byte(fb)}, []byte{0}))
+
+	words := make([]string, 8)
+	for i := range words {
+		words[i] = wordList[sum[i]]
+	}
+	return words, nil
+}
@@ -0,0 +1,291 @@
+package trust
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/config"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+var (
+	// ErrUnknownPeer means the store has never seen the peer.
+	ErrUnknownPeer = errors.New("unknown peer")
+
+	// ErrKeyChanged means a name is no longer used by the key that was
+	// compared, so confirming it would verify someone else.
+	ErrKeyChanged = errors.New("a different key is using this name now")
+)
+
+// Record is what we know about one peer key.
+type Record struct {
+	ID         peer.ID   `json:"id"`
+	Name       string    `json:"name"` // most recent display name
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Verified   bool      `json:"verified,omitempty"`
+	VerifiedAt time.Time `json:"verified_at,omitzero"`
+}
+
+// Alert reports a name we know turning up with a different key: either
+// the person reinstalled, or someone is impersonating them.
+type Alert struct {
+	Name          string
+	Known         peer.ID // the key we had for this name
+	New           peer.ID
+	KnownVerified bool
+}
+
+func (a Alert) String() string {
+	was := "first seen"
+	if a.KnownVerified {
+		was = "verified"
+	}
+	return fmt.Sprintf("%q is using a new key (%s ≠ %s key %s) — /verify %s before trusting them",
+		a.Name, ShortID(a.New), was, ShortID(a.Known), a.Name)
+}
+
+// Store is the local trust-on-first-use record of peer keys, kept in a
+// JSON file.
+type Store struct {
+	path string
+
+	mu    sync.Mutex
+	peers map[peer.ID]*Record
+}
+
+// DefaultPath returns where the trust store lives.
+func DefaultPath() (string, error) {
+	return config.Path("trust.json")
+}
+
+// Open loads the store at path, starting empty if it doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, peers: make(map[peer.ID]*Record)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recs []Record
+	if err := json.Unmarshal(data, &recs); err != nil {
+		return nil, fmt.Errorf("reading trust store %s: %w", path, err)
+	}
+	for _, r := range recs {
+		s.peers[r.ID] = &r
+	}
+	return s, nil
+}
+
+// Observe records that id is using name. If another key already used
+// that name, it returns an alert; this happens once, when the new key
+// first shows up under the name.
+func (s *Store) Observe(id peer.ID, name string) (Alert, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || id == "" {
+		return Alert{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	r, ok := s.peers[id]
+	if ok && r.Name == name {
+		r.LastSeen = now
+		return Alert{}, false
+	}
+	if !ok {
+		r = &Record{ID: id, FirstSeen: now}
+		s.peers[id] = r
+	}
+	r.Name = name
+	r.LastSeen = now
+
+	alert, conflict := s.conflictLocked(id, name)
+	_ = s.saveLocked()
+	return alert, conflict
+}
+
+// conflictLocked looks for another key that used name: a verified one
+// if there is one, and otherwise the first seen.
+func (s *Store) conflictLocked(id peer.ID, name string) (Alert, bool) {
+	var known *Record
+	for _, r := range s.peers {
+		if r.ID == id || !strings.EqualFold(r.Name, name) {
+			continue
+		}
+		if known == nil || prefer(r, known) {
+			known = r
+		}
+	}
+	if known == nil {
+		return Alert{}, false
+	}
+	return Alert{Name: name, Known: known.ID, New: id, KnownVerified: known.Verified}, true
+}
+
+// prefer reports whether a should be named in an alert over b: verified
+// beats unverified, then the earlier first sighting wins, then the ID,
+// so the choice doesn't depend on map order.
+func prefer(a, b *Record) bool {
+	if a.Verified != b.Verified {
+		return a.Verified
+	}
+	if !a.FirstSeen.Equal(b.FirstSeen) {
+		return a.FirstSeen.Before(b.FirstSeen)
+	}
+	return a.ID < b.ID
+}
+
+// Verify marks id as confirmed out of band.
+func (s *Store) Verify(id peer.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.peers[id]
+	if !ok {
+		return ErrUnknownPeer
+	}
+	r.Verified = true
+	r.VerifiedAt = time.Now()
+	return s.saveLocked()
+}
+
+// Confirm verifies the key currently using name, which must be the one
+// whose ShortID is code: the key the user compared safety numbers for.
+// If another key has taken the name since, it returns ErrKeyChanged.
+func (s *Store) Confirm(name, code string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs := s.lookupLocked(name)
+	if len(recs) == 0 {
+		return Record{}, ErrUnknownPeer
+	}
+	r := s.peers[recs[0].ID]
+	if ShortID(r.ID) != code {
+		return *r, ErrKeyChanged
+	}
+	r.Verified = true
+	r.VerifiedAt = time.Now()
+	return *r, s.saveLocked()
+}
+
+// Get returns the record for id.
+func (s *Store) Get(id peer.ID) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.peers[id]
+	if !ok {
+		return Record{}, false
+	}
+	return *r, true
+}
+
+// Verified reports whether id has been verified.
+func (s *Store) Verified(id peer.ID) bool {
+	r, ok := s.Get(id)
+	return ok && r.Verified
+}
+
+// Lookup returns the keys that have used name, most recently seen
+// first.
+func (s *Store) Lookup(name string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookupLocked(name)
+}
+
+func (s *Store) lookupLocked(name string) []Record {
+	var out []Record
+	for _, r := range s.peers {
+		if strings.EqualFold(r.Name, name) {
+			out = append(out, *r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+// Watch observes the sender of every message and presence announcement
+// in c until ctx is done, delivering alerts on the returned channel.
+func (s *Store) Watch(ctx context.Context, c *chat.Chat) <-chan Alert {
+	sub := c.Subscribe(chat.SubscribeOptions{
+		Filter: chat.Filter{Kinds: []wire.Kind{wire.KindChat, wire.KindPresence}},
+		Policy: chat.Block,
+	})
+	alerts := make(chan Alert, 16)
+
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case ev, ok := <-sub.C():
+				if !ok {
+					return
+				}
+				name := ev.Name
+				if ev.Kind == wire.KindChat {
+					if ev.Message.Hidden > 0 {
+						continue // our own placeholder, not something they said
+					}
+					name = ev.Message.Sender
+				}
+				if a, conflict := s.Observe(ev.From, name); conflict {
+					select {
+					case alerts <- a:
+					default:
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return alerts
+}
+
+func (s *Store) saveLocked() error {
+	recs := make([]Record, 0, len(s.peers))
+	for _, r := range s.peers {
+		recs = append(recs, *r)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].FirstSeen.Before(recs[j].FirstSeen) })
+
+	data, err := json.MarshalIndent(recs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// ShortID returns the tail of a peer ID, which is the part that differs
+// between keys. It is shown next to safety numbers and typed back to
+// confirm them.
+func ShortID(id peer.ID) string {
+	s := id.String()
+	if len(s) > 8 {
+		return s[len(s)-8:]
+	}
+	return s
+}
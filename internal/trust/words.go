@@ -0,0 +1,39 @@
+package trust
+
+// wordList maps each byte of a safety code to a word, so two people can
+// compare codes by reading them aloud. Order matters: never reorder or
+// replace entries, or existing codes change.
+var wordList = [256]string{
+	"acorn", "actor", "agent", "album", "alarm", "alley", "amber", "angle",
+	"ankle", "apple", "apron", "arena", "arrow", "atlas", "attic", "badge",
+	"bagel", "baker", "bamboo", "banjo", "barn", "basil", "basin", "beach",
+	"beard", "beast", "bench", "berry", "bison", "blade", "blaze", "blimp",
+	"bloom", "board", "boat", "boot", "bread", "brick", "brook", "brush",
+	"bucket", "bugle", "cabin", "cable", "cactus", "camel", "candy", "canoe",
+	"canyon", "cargo", "carrot", "castle", "cedar", "chalk", "chart", "cherry",
+	"chess", "cider", "cliff", "clock", "cloud", "clown", "coach", "cobra",
+	"cocoa", "comet", "coral", "cotton", "couch", "crane", "crate", "creek",
+	"crown", "daisy", "dance", "delta", "denim", "desk", "diary", "dock",
+	"dolphin", "donut", "dragon", "drum", "eagle", "easel", "echo", "elbow",
+	"ember", "engine", "fable", "falcon", "farm", "feast", "fern", "ferry",
+	"fiddle", "field", "flag", "flame", "flute", "foam", "forest", "fossil",
+	"frame", "frost", "fudge", "gable", "galaxy", "garden", "gecko", "ghost",
+	"giant", "ginger", "glacier", "glove", "goose", "grape", "gravel", "guitar",
+	"hammer", "harbor", "hazel", "heron", "hinge", "hippo", "honey", "hotel",
+	"husky", "igloo", "island", "ivory", "jacket", "jaguar", "jelly", "jewel",
+	"jigsaw", "juice", "kayak", "kettle", "kiosk", "kite", "koala", "ladder",
+	"lagoon", "lamp", "lantern", "laser", "lemon", "lever", "lily", "linen",
+	"lizard", "llama", "lobby", "locket", "lotus", "magnet", "mango", "maple",
+	"marble", "meadow", "melon", "mint", "mirror", "mitten", "moose", "motor",
+	"mouse", "mural", "nectar", "needle", "nickel", "noodle", "nutmeg", "oasis",
+	"ocean", "olive", "onion", "opera", "orbit", "otter", "oven", "paddle",
+	"palace", "panda", "paper", "parrot", "peach", "pearl", "pebble", "pencil",
+	"pepper", "piano", "pilot", "pixel", "planet", "plaza", "plum", "pony",
+	"poppy", "prism", "puffin", "pumpkin", "quartz", "quill", "rabbit", "radar",
+	"radio", "raven", "ribbon", "river", "robin", "rocket", "rose", "ruby",
+	"saddle", "salmon", "satin", "scarf", "shell", "silver", "sketch", "sloth",
+	"socket", "spoon", "squid", "stamp", "storm", "sugar", "summit", "swan",
+	"table", "tango", "thorn", "tiger", "timber", "toast", "topaz", "tower",
+	"trail", "tulip", "tuna", "turtle", "umbrella", "valley", "velvet", "violin",
+	"walnut", "walrus", "whale", "willow", "window", "wizard", "yacht", "zebra",
+}
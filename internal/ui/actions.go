@@ -0,0 +1,173 @@
+package ui
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/reflow/truncate"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+)
+
+// maxQuoteLen is how much of a message a quote-reply carries over.
+const maxQuoteLen = 100
+
+// msgAction is one entry in the selected message's action menu.
+type msgAction struct {
+	key key.Binding // runs it directly while the menu is open
+	run func(m Model, msg chat.ChatMessage) (tea.Model, tea.Cmd)
+}
+
+// actions lists the action menu's entries, leaving out any whose key
+// has been unbound.
+func (m Model) actions() []msgAction {
+	all := []msgAction{
+		{key: m.keymap.Expand, run: Model.actExpand},
+		{key: m.keymap.Copy, run: Model.actCopy},
+		{key: m.keymap.Reply, run: Model.actReply},
+		{key: m.keymap.CopyID, run: Model.actCopyID},
+		{key: m.keymap.Open, run: func(m Model, _ chat.ChatMessage) (tea.Model, tea.Cmd) { return m.actPager() }},
+	}
+	return slices.DeleteFunc(all, func(a msgAction) bool { return !a.key.Enabled() })
+}
+
+// updateMenu handles keys while the action menu is open: MenuPrev and
+// MenuNext move along it, Enter or an action's key runs one, Back
+// closes it.
+func (m Model) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	actions := m.actions()
+	if m.selectedMsg < 0 || m.selectedMsg >= m.timeline.Len() || len(actions) == 0 {
+		m.menu = false
+		return m, nil
+	}
+	switch {
+	case key.Matches(msg, m.keymap.Back, m.keymap.Quit):
+		m.menu = false
+	case key.Matches(msg, m.keymap.MenuPrev):
+		m.menuItem = (m.menuItem + len(actions) - 1) % len(actions)
+	case key.Matches(msg, m.keymap.MenuNext):
+		m.menuItem = (m.menuItem + 1) % len(actions)
+	case key.Matches(msg, m.keymap.Enter):
+		return m.runAction(actions[m.menuItem])
+	default:
+		for _, a := range actions {
+			if key.Matches(msg, a.key) {
+				return m.runAction(a)
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m Model) runAction(a msgAction) (tea.Model, tea.Cmd) {
+	m.menu = false
+	return a.run(m, m.timeline.At(m.selectedMsg))
+}
+
+// viewMenu draws the action menu in the warning line.
+func (m Model) viewMenu() string {
+	var b strings.Builder
+	b.WriteString("  ")
+	for i, a := range m.actions() {
+		item := "[" + a.key.Help().Key + "] " + a.key.Help().Desc
+		if i == m.menuItem {
+			b.WriteString(SelectedMsgStyle.Render(item))
+		} else {
+			b.WriteString(StatusStyle.Render(item))
+		}
+		b.WriteString("  ")
+	}
+	b.WriteString(TimestampStyle.Render(m.keymap.Back.Help().Key + " to close"))
+	return b.String()
+}
+
+// actExpand shows the message in full, or folds it back to one line.
+// Text attachments open or close their preview along with it.
+func (m Model) actExpand(msg chat.ChatMessage) (tea.Model, tea.Cmd) {
+	m.expanded[msg.ID] = !m.expanded[msg.ID]
+	if hasPreview(msg) {
+		m.previews[msg.ID] = m.expanded[msg.ID]
+	}
+	m.layoutMessages()
+	return m, nil
+}
+
+// actCopy copies the message's text to the clipboard.
+func (m Model) actCopy(msg chat.ChatMessage) (tea.Model, tea.Cmd) {
+	m.showWarning = true
+	m.warningMsg = "✓ copied the message"
+	return m, copyText(msg.Content)
+}
+
+// actCopyID copies the sender's peer ID, e.g. for /verify or /block.
+func (m Model) actCopyID(msg chat.ChatMessage) (tea.Model, tea.Cmd) {
+	if msg.From == "" {
+		return m.Warn("⚠ this message has no sender ID")
+	}
+	m.showWarning = true
+	m.warningMsg = "✓ copied " + msg.From.String()
+	return m, copyText(msg.From.String())
+}
+
+// actReply starts a reply quoting the first line of the message.
+func (m Model) actReply(msg chat.ChatMessage) (tea.Model, tea.Cmd) {
+	sender := msg.Sender
+	if m.isOwn(msg) {
+		sender = m.username
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(msg.Content), "\n")
+	line = truncate.StringWithTail(line, maxQuoteLen, "…")
+
+	m.selectedMsg = -1
+	m.layoutMessages()
+	m.gotoBottom()
+	m.textArea.Placeholder = ""
+	m.textArea.SetValue("> " + sender + ": " + line + "\n\n")
+	m.textArea.CursorEnd()
+	m.fitInput()
+	return m, nil
+}
+
+// actPager shows the message on its own, full screen. Text attachments
+// open in full; anything else is the message rendered at full width.
+func (m Model) actPager() (tea.Model, tea.Cmd) {
+	msg := m.timeline.At(m.selectedMsg)
+	if hasPreview(msg) {
+		return m.openPager()
+	}
+
+	sender := msg.Sender
+	if m.isOwn(msg) {
+		sender = "you"
+	}
+	content := msg.Content + m.attachmentStatus(msg)
+	if m.renderer != nil {
+		if out, err := m.renderer.Render(content); err == nil {
+			content = out
+		}
+	}
+	m.openOverlay(sender+" · "+msg.Time().In(m.clock.loc()).Format("Jan 2 15:04:05"), strings.Trim(content, "\n"))
+	return m, nil
+}
+
+// copyText puts s on the clipboard of the terminal we run in with an
+// OSC 52 escape, which also reaches the local clipboard over SSH.
+// Terminals without OSC 52 support ignore it. Like notifyMention it
+// writes through Output, so it can't land in the middle of a frame.
+func copyText(s string) tea.Cmd {
+	return func() tea.Msg {
+		seq := osc52.New(s)
+		switch {
+		case os.Getenv("TMUX") != "":
+			seq = seq.Tmux()
+		case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+			seq = seq.Screen()
+		}
+		_, _ = Output.Write([]byte(seq.String()))
+		return nil
+	}
+}
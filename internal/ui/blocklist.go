@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+)
+
+// resolvePeer finds the key behind a name (or the tail of a peer ID),
+// preferring the one seen most recently. To undo a mute or block, the
+// key on the list comes first: whoever uses the name now may not be the
+// one that was muted.
+func (m Model) resolvePeer(who string, listed bool) (peer.ID, string, bool) {
+	if listed {
+		if id, name, ok := m.blocks.Find(who); ok {
+			return id, sanitizeLine(name), true
+		}
+	}
+	if m.trust != nil {
+		if recs := m.trust.Lookup(who); len(recs) > 0 {
+			return recs[0].ID, sanitizeLine(recs[0].Name), true
+		}
+	}
+	id, name, ok := m.blocks.Find(who)
+	return id, sanitizeLine(name), ok
+}
+
+// cmdMute runs /mute, /unmute, /block and /unblock.
+func (m Model) cmdMute(cmd, who string) (tea.Model, tea.Cmd) {
+	if m.blocks == nil {
+		return m.Warn("⚠ muting is unavailable")
+	}
+	id, name, ok := m.resolvePeer(who, strings.HasPrefix(cmd, "un"))
+	if !ok {
+		return m.Warn(fmt.Sprintf("⚠ nobody called %q has been seen", who))
+	}
+	if name == "" {
+		name = "…" + shortPeer(id)
+	}
+
+	var err error
+	switch cmd {
+	case "mute":
+		err = m.blocks.Mute(id, name)
+	case "unmute":
+		err = m.blocks.Unmute(id)
+	case "block":
+		err = m.blocks.Block(id, name)
+	case "unblock":
+		err = m.blocks.Unblock(id)
+	}
+	if err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+
+	if m.blocks.Muted(id) {
+		// Hide what they already said, too, in every room
+		for _, tl := range m.timelines {
+			if tl.RemoveFunc(func(msg chat.ChatMessage) bool { return msg.From == id }) > 0 && tl == m.timeline {
+				m.selectedMsg = -1
+			}
+		}
+	}
+	m.resetInput()
+	m.layoutMessages()
+	m.showWarning = true
+	m.warningMsg = fmt.Sprintf("✓ %sed %s (…%s)", strings.TrimSuffix(cmd, "e"), name, shortPeer(id))
+	return m, nil
+}
+
+// cmdBlocked lists muted and blocked peers.
+func (m Model) cmdBlocked() (tea.Model, tea.Cmd) {
+	if m.blocks == nil {
+		return m.Warn("⚠ muting is unavailable")
+	}
+
+	entries := m.blocks.Entries()
+	var b strings.Builder
+	b.WriteString("\n")
+	if len(entries) == 0 {
+		b.WriteString(StatusStyle.Render("nobody is muted or blocked") + "\n")
+	}
+	for _, e := range entries {
+		state, undo := "muted  ", "/unmute"
+		if e.Blocked {
+			state, undo = "blocked", "/unblock"
+		}
+		name := sanitizeLine(e.Name)
+		if name == "" {
+			name = "(unnamed)"
+		}
+		fmt.Fprintf(&b, "  %s  %-24s %s  %s\n",
+			WarningStyle.Render(state), name,
+			TimestampStyle.Render("…"+e.ID[max(0, len(e.ID)-8):]),
+			StatusStyle.Render(undo+" "+name))
+	}
+
+	m.resetInput()
+	m.openOverlay(fmt.Sprintf("muted and blocked (%d)", len(entries)), b.String())
+	return m, nil
+}
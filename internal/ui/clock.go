@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock is how the TUI shows times.
+type Clock struct {
+	// Layout formats message times, as for time.Time.Format. Empty shows
+	// messages from the last hour as "2m ago" and older ones as 15:04.
+	Layout string
+	// Location is the time zone times are shown in; nil is the local one.
+	Location *time.Location
+}
+
+// NewClock returns a Clock showing message times in layout, in the IANA
+// time zone called zone, e.g. "Europe/Berlin"; an empty zone is the
+// local one.
+func NewClock(layout, zone string) (Clock, error) {
+	c := Clock{Layout: layout}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return c, err
+		}
+		c.Location = loc
+	}
+	return c, nil
+}
+
+func (c Clock) loc() *time.Location {
+	if c.Location == nil {
+		return time.Local
+	}
+	return c.Location
+}
+
+// Format returns t as shown beside a message at the time now.
+func (c Clock) Format(t, now time.Time) string {
+	t = t.In(c.loc())
+	if c.Layout != "" {
+		return t.Format(c.Layout)
+	}
+	switch ago := now.Sub(t); {
+	case ago < -time.Minute || ago >= time.Hour:
+		return t.Format("15:04")
+	case ago < time.Minute:
+		// A clock a little ahead of ours still counts as just now
+		return "just now"
+	default:
+		return fmt.Sprintf("%dm ago", int(ago.Minutes()))
+	}
+}
+
+// Day returns the label of the divider above the first message of t's
+// day, as seen at the time now.
+func (c Clock) Day(t, now time.Time) string {
+	t, now = t.In(c.loc()), now.In(c.loc())
+	switch {
+	case c.sameDay(t, now):
+		return "today"
+	case c.sameDay(t, now.AddDate(0, 0, -1)):
+		return "yesterday"
+	case t.Year() == now.Year():
+		return t.Format("Mon, Jan 2")
+	default:
+		return t.Format("Mon, Jan 2 2006")
+	}
+}
+
+// sameDay reports whether a and b fall on the same date in c's zone.
+func (c Clock) sameDay(a, b time.Time) bool {
+	ay, am, ad := a.In(c.loc()).Date()
+	by, bm, bd := b.In(c.loc()).Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+)
+
+// Command is a slash command for the chat input.
+type Command struct {
+	Name    string
+	Aliases []string
+	Usage   string // what follows the name, e.g. "<name> [confirm]"
+	Help    string // one line for /help
+
+	// MinArgs and MaxArgs bound the number of words after the name;
+	// MaxArgs is -1 for no limit. Lines outside them get a usage error
+	// in the warning line rather than reaching Run.
+	MinArgs int
+	MaxArgs int
+
+	// Run carries the command out. arg is everything after the name,
+	// with surrounding space trimmed.
+	Run func(m Model, arg string) (tea.Model, tea.Cmd)
+}
+
+// commands holds every registered command by name and by alias.
+var commands = make(map[string]*Command)
+
+// RegisterCommand adds a command to the chat input. Other packages can
+// plug in their own by calling it from an init function. Like
+// http.Handle, it panics if the name or an alias is already taken.
+func RegisterCommand(c Command) {
+	if c.Name == "" || c.Run == nil {
+		panic("ui: command needs a name and Run")
+	}
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if _, dup := commands[name]; dup {
+			panic("ui: command /" + name + " registered twice")
+		}
+		commands[name] = &c
+	}
+}
+
+// Commands returns every registered command, sorted by name.
+func Commands() []Command {
+	var cmds []Command
+	for name, c := range commands {
+		if name == c.Name {
+			cmds = append(cmds, *c)
+		}
+	}
+	slices.SortFunc(cmds, func(a, b Command) int { return strings.Compare(a.Name, b.Name) })
+	return cmds
+}
+
+// Synopsis is the command as it would be typed, e.g.
+// "/verify <name> [confirm <key>]".
+func (c Command) Synopsis() string {
+	return strings.TrimSpace("/" + c.Name + " " + c.Usage)
+}
+
+// handleCommand parses a line typed into the chat input and runs the
+// command it names.
+func (m Model) handleCommand(line string) (tea.Model, tea.Cmd) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	arg = strings.TrimSpace(arg)
+
+	c, ok := commands[strings.ToLower(name)]
+	if !ok {
+		return m.Warn(fmt.Sprintf("⚠ unknown command /%s, /help lists them", name))
+	}
+	n := len(strings.Fields(arg))
+	if n < c.MinArgs || (c.MaxArgs >= 0 && n > c.MaxArgs) {
+		return m.Warn("⚠ usage: " + c.Synopsis())
+	}
+	return c.Run(m, arg)
+}
+
+// Warn shows msg in the warning line above the input, where commands
+// report problems and confirmations.
+func (m Model) Warn(msg string) (tea.Model, tea.Cmd) {
+	m.showWarning = true
+	m.warningMsg = msg
+	return m, nil
+}
+
+// Chat returns the chat the model is showing, for commands to act on.
+func (m Model) Chat() *chat.Chat {
+	return m.chat
+}
+
+// Username returns the name we post under.
+func (m Model) Username() string {
+	return m.username
+}
@@ -0,0 +1,257 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/reflow/truncate"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/transfer"
+)
+
+// progressMsg carries a file transfer update.
+type progressMsg transfer.Progress
+
+// sharedMsg reports that a file finished hashing for /send.
+type sharedMsg struct {
+	att chat.Attachment
+	err error
+}
+
+func init() {
+	for _, c := range []Command{
+		{Name: "help", Usage: "[<command>]", Help: "list commands, or explain one", MaxArgs: 1, Run: Model.cmdHelp},
+		{Name: "nick", Usage: "<name>", Help: "change the name you post under", MinArgs: 1, MaxArgs: -1, Run: Model.cmdNick},
+		{Name: "me", Usage: "<action>", Help: "say what you are doing, e.g. /me waves", MinArgs: 1, MaxArgs: -1, Run: Model.cmdMe},
+		{Name: "clear", Help: "clear the messages on screen", Run: Model.cmdClear},
+		{Name: "send", Usage: "<path>", Help: "offer a file to the room", MinArgs: 1, MaxArgs: -1, Run: Model.cmdSend},
+		{Name: "accept", Usage: "[<name>]", Help: "download the latest file offer, or the latest matching name", MaxArgs: -1, Run: Model.cmdAccept},
+		{Name: "attachments", Help: "list cached attachments", Run: noArgs(Model.cmdAttachments)},
+		{Name: "verify", Usage: "<name> [confirm <key>]", Help: "compare safety numbers with someone, then confirm", MinArgs: 1, MaxArgs: -1, Run: Model.cmdVerify},
+		{Name: "mute", Usage: "<name>", Help: "hide someone's messages", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdMute, "mute")},
+		{Name: "unmute", Usage: "<name>", Help: "show someone's messages again", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdMute, "unmute")},
+		{Name: "block", Usage: "<name>", Help: "stop relaying and connecting to someone", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdMute, "block")},
+		{Name: "unblock", Usage: "<name>", Help: "undo /block", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdMute, "unblock")},
+		{Name: "blocked", Help: "list muted and blocked peers", Run: noArgs(Model.cmdBlocked)},
+		{Name: "join", Usage: "<room>|<invite code>", Help: "join another room, or switch to one you are in", MinArgs: 1, MaxArgs: -1, Run: Model.cmdJoin},
+		{Name: "leave", Help: "leave this room", Run: noArgs(Model.cmdLeave)},
+		{Name: "invite", Usage: "[once] [<duration>|never]", Help: "show an invite code for this room", MaxArgs: 2, Run: Model.cmdInvite},
+		{Name: "kick", Usage: "<name> [<duration>]", Help: "ignore someone in this room for a while", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdModerate, "kick")},
+		{Name: "ban", Usage: "<name>", Help: "ignore someone in this room until unbanned", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdModerate, "ban")},
+		{Name: "unban", Usage: "<name>", Help: "lift a kick or ban", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdModerate, "unban")},
+		{Name: "op", Usage: "<name>", Help: "make someone a moderator (owner only)", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdModerate, "op")},
+		{Name: "deop", Usage: "<name>", Help: "stop someone being a moderator (owner only)", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdModerate, "deop")},
+		{Name: "admit", Usage: "<name>", Help: "make someone a member, who can read this room", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdModerate, "admit")},
+		{Name: "remove", Usage: "<name>", Help: "stop someone being a member of this room", MinArgs: 1, MaxArgs: -1, Run: peerCommand(Model.cmdModerate, "remove")},
+		{Name: "topic", Usage: "[<text>]", Help: "set or clear the room topic", MaxArgs: -1, Run: Model.cmdTopic},
+		{Name: "mods", Help: "list the room's owner, moderators and bans", Run: noArgs(Model.cmdMods)},
+		{Name: "theme", Usage: "[<name>]", Help: "switch color theme, or list them", MaxArgs: 1, Run: Model.cmdTheme},
+	} {
+		RegisterCommand(c)
+	}
+}
+
+// noArgs adapts a handler that takes no argument.
+func noArgs(run func(Model) (tea.Model, tea.Cmd)) func(Model, string) (tea.Model, tea.Cmd) {
+	return func(m Model, _ string) (tea.Model, tea.Cmd) { return run(m) }
+}
+
+// peerCommand adapts a handler shared by several commands, such as
+// /mute and /block, that is told which one ran.
+func peerCommand(run func(Model, string, string) (tea.Model, tea.Cmd), name string) func(Model, string) (tea.Model, tea.Cmd) {
+	return func(m Model, arg string) (tea.Model, tea.Cmd) { return run(m, name, arg) }
+}
+
+// cmdHelp lists the commands in an overlay, or explains one.
+func (m Model) cmdHelp(arg string) (tea.Model, tea.Cmd) {
+	if arg != "" {
+		c, ok := commands[strings.ToLower(strings.TrimPrefix(arg, "/"))]
+		if !ok {
+			return m.Warn(fmt.Sprintf("⚠ unknown command /%s", strings.TrimPrefix(arg, "/")))
+		}
+		return m.Warn(c.Synopsis() + " — " + c.Help)
+	}
+
+	cmds := Commands()
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, c := range cmds {
+		fmt.Fprintf(&b, "  %-34s %s\n", c.Synopsis(), StatusStyle.Render(c.Help))
+	}
+	b.WriteString("\n" + StatusStyle.Render("  start a message with // to send one beginning with /") + "\n")
+	b.WriteString(StatusStyle.Render("  "+m.keymap.Help.Help().Key+" on an empty input lists the keys") + "\n")
+
+	m.resetInput()
+	m.openOverlay(fmt.Sprintf("commands (%d)", len(cmds)), b.String())
+	return m, nil
+}
+
+// cmdNick changes the name we post under and tells the room.
+func (m Model) cmdNick(name string) (tea.Model, tea.Cmd) {
+	if utf8.RuneCountInString(name) > maxNameLen || sanitizeLine(name) != name {
+		return m.Warn(fmt.Sprintf("⚠ names are up to %d characters, without control characters", maxNameLen))
+	}
+	old := m.username
+	m.username = name
+	if m.rooms != nil {
+		m.rooms.SetName(name)
+	}
+	m.resetInput()
+	m.layoutMessages()
+	return m.Warn(fmt.Sprintf("✓ %s is now %s", old, name))
+}
+
+// actionEscaper keeps asterisks in a /me action from closing its
+// italics early. Backslashes go too, or a trailing one would escape the
+// closing asterisk.
+var actionEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`)
+
+// cmdMe posts an action, shown in italics.
+func (m Model) cmdMe(action string) (tea.Model, tea.Cmd) {
+	return m.send("*" + actionEscaper.Replace(action) + "*")
+}
+
+// cmdClear empties the room's timeline on our screen only.
+func (m Model) cmdClear(string) (tea.Model, tea.Cmd) {
+	m.timeline.RemoveFunc(func(chat.ChatMessage) bool { return true })
+	m.selectedMsg = -1
+	m.expanded = make(map[string]bool)
+	m.previews = make(map[string]bool)
+	m.resetInput()
+	m.layoutMessages()
+	return m, nil
+}
+
+// cmdSend offers a file to the room. Hashing can take a while for big
+// files, so it happens in a command rather than in Update.
+func (m Model) cmdSend(path string) (tea.Model, tea.Cmd) {
+	if m.files == nil {
+		return m.Warn("⚠ file sharing is unavailable")
+	}
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+
+	m.resetInput()
+	files, c := m.files, m.chat
+	return m, func() tea.Msg {
+		att, err := files.Share(c, path)
+		return sharedMsg{att: att, err: err}
+	}
+}
+
+func (m Model) handleShared(msg sharedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		return m.Warn("⚠ " + msg.err.Error())
+	}
+	ownMsg, err := m.chat.PublishAttachment(m.username, msg.att)
+	if err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+	m.insertMessage(ownMsg)
+	m.layoutMessages()
+	m.gotoBottom()
+	return m, nil
+}
+
+// cmdAccept downloads the most recent file offer, or the most recent
+// one whose name starts with the argument.
+func (m Model) cmdAccept(name string) (tea.Model, tea.Cmd) {
+	if m.files == nil {
+		return m.Warn("⚠ file sharing is unavailable")
+	}
+
+	msgs := m.timeline.Messages()
+	for i := len(msgs) - 1; i >= 0; i-- {
+		msg := msgs[i]
+		att := msg.Attachment
+		if att == nil || m.isOwn(msg) {
+			continue
+		}
+		if name != "" && !strings.HasPrefix(strings.ToLower(att.Name), strings.ToLower(name)) {
+			continue
+		}
+		if p, ok := m.transfers[att.Hash]; ok && p.Done && p.Err == "" {
+			continue // already have it
+		}
+
+		m.files.Download(context.Background(), m.chat, msg.From, *att)
+		m.transfers[att.Hash] = transfer.Progress{Hash: att.Hash, Name: att.Name, Size: att.Size}
+		m.resetInput()
+		m.layoutMessages()
+		return m, nil
+	}
+
+	if name != "" {
+		return m.Warn(fmt.Sprintf("⚠ no file offer matching %q", name))
+	}
+	return m.Warn("⚠ no file offers to accept")
+}
+
+// cmdAttachments lists the attachment cache in an overlay.
+func (m Model) cmdAttachments() (tea.Model, tea.Cmd) {
+	if m.files == nil {
+		return m.Warn("⚠ file sharing is unavailable")
+	}
+
+	store := m.files.Store()
+	used, max := store.Size()
+	entries := store.List()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  %s of %s used\n\n", chat.HumanSize(used), chat.HumanSize(max))
+	if len(entries) == 0 {
+		b.WriteString(StatusStyle.Render("nothing cached yet — /accept a file to fill it"))
+	}
+	for _, e := range entries {
+		fmt.Fprintf(&b, "  %-32s %9s  %s  %s\n",
+			truncate.StringWithTail(sanitizeLine(e.Name), 32, "…"),
+			chat.HumanSize(e.Size),
+			TimestampStyle.Render(e.Hash[:min(12, len(e.Hash))]),
+			TimestampStyle.Render("used "+e.LastUsed.Format("Jan 2 15:04")))
+	}
+
+	m.resetInput()
+	m.openOverlay(fmt.Sprintf("cached attachments (%d)", len(entries)), b.String())
+	return m, nil
+}
+
+// waitForProgress returns a command that waits for the next transfer update.
+func (m Model) waitForProgress() tea.Cmd {
+	return func() tea.Msg {
+		return progressMsg(<-m.files.Updates())
+	}
+}
+
+// attachmentStatus describes where an attachment's transfer stands, to
+// be shown after the offer text.
+func (m Model) attachmentStatus(msg chat.ChatMessage) string {
+	att := msg.Attachment
+	if att == nil {
+		return ""
+	}
+	if m.isOwn(msg) {
+		return " · shared"
+	}
+
+	p, ok := m.transfers[att.Hash]
+	switch {
+	case !ok:
+		return " · /accept to download"
+	case p.Done && p.Err != "":
+		return " · ✗ failed, /accept to retry"
+	case p.Done:
+		return " · ✓ saved to " + p.Path
+	case p.Size > 0:
+		return fmt.Sprintf(" · ⇣ %d%%", p.Received*100/p.Size)
+	}
+	return " · ⇣ starting"
+}
@@ -0,0 +1,28 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMeEscapesAction(t *testing.T) {
+	m := NewModel("me", nil, "", Services{})
+	model, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	m = model.(Model)
+
+	for _, action := range []string{
+		"thinks 2 * 3 = 6",
+		"*waves* back",
+		`saves to C:\`,
+	} {
+		out, err := m.renderer.Render("*" + actionEscaper.Replace(action) + "*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(sanitize(out)); got != action {
+			t.Errorf("/me %s rendered as %q", action, got)
+		}
+	}
+}
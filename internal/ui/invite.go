@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/ekrishgupta/Hush/internal/invite"
+	"github.com/ekrishgupta/Hush/internal/moderation"
+)
+
+// defaultInviteTTL is how long an invite lasts unless told otherwise.
+const defaultInviteTTL = 24 * time.Hour
+
+// cmdInvite runs /invite [once] [<duration>|never], showing a code for
+// this room and its QR code.
+func (m Model) cmdInvite(arg string) (tea.Model, tea.Cmd) {
+	if m.invites == nil {
+		return m.Warn("⚠ invites are unavailable")
+	}
+
+	opts := invite.Options{TTL: defaultInviteTTL}
+	for _, word := range strings.Fields(arg) {
+		switch word {
+		case "once":
+			opts.Once = true
+		case "never":
+			opts.TTL = 0
+		default:
+			ttl, err := time.ParseDuration(word)
+			if err != nil || ttl <= 0 {
+				return m.Warn("⚠ usage: /invite [once] [<duration>|never], e.g. /invite once 2h")
+			}
+			opts.TTL = ttl
+		}
+	}
+
+	opts.Admit = m.mod != nil && m.mod.CanAdmit(m.chat.Self())
+	code, err := m.invites.Create(m.chat.Room(), opts)
+	if err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+	inv, err := invite.Parse(code)
+	if err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+
+	var b strings.Builder
+	b.WriteString("\n")
+	if qr, err := invite.QR(code); err == nil {
+		for _, line := range strings.Split(strings.TrimRight(qr, "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(StatusStyle.Render("  "+inv.Describe()) + "\n\n")
+	fmt.Fprintf(&b, "  hush join %s\n\n", code)
+	b.WriteString(StatusStyle.Render("  or paste the code into the desktop app's invite box") + "\n")
+
+	m.resetInput()
+	m.openOverlay("invite to #"+moderation.DisplayName(inv.Room), b.String())
+	return m, nil
+}
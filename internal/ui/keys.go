@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// KeyMap holds every key the TUI responds to outside of typing.
+type KeyMap struct {
+	Quit     key.Binding
+	Back     key.Binding // deselects, closes menus and overlays
+	Help     key.Binding
+	Enter    key.Binding // sends, or opens the selected message's actions
+	Up       key.Binding
+	Down     key.Binding
+	Bottom   key.Binding // deselects and scrolls to the newest message
+	Complete key.Binding // completes an @name
+
+	ToggleRooms key.Binding
+	TogglePeers key.Binding
+	PrevRoom    key.Binding
+	NextRoom    key.Binding
+	GoToRoom    key.Binding // its nth key goes to the nth room
+
+	MenuPrev key.Binding
+	MenuNext key.Binding
+	Expand   key.Binding
+	Copy     key.Binding
+	Reply    key.Binding
+	CopyID   key.Binding
+	Open     key.Binding // also works without the menu open
+}
+
+// DefaultKeyMap returns the keys used unless the config says otherwise.
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Quit:     key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("ctrl+c", "quit")),
+		Back:     key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "back")),
+		Help:     key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "these keys")),
+		Enter:    key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "send, or act on the selection")),
+		Up:       key.NewBinding(key.WithKeys("up"), key.WithHelp("↑", "select an earlier message")),
+		Down:     key.NewBinding(key.WithKeys("down"), key.WithHelp("↓", "select a later message")),
+		Bottom:   key.NewBinding(key.WithKeys("alt+g", "ctrl+end"), key.WithHelp("alt+g", "jump to the newest message")),
+		Complete: key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "complete an @name")),
+
+		ToggleRooms: key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "rooms")),
+		TogglePeers: key.NewBinding(key.WithKeys("ctrl+o"), key.WithHelp("ctrl+o", "who's online")),
+		PrevRoom:    key.NewBinding(key.WithKeys("alt+up"), key.WithHelp("alt+↑", "previous room")),
+		NextRoom:    key.NewBinding(key.WithKeys("alt+down"), key.WithHelp("alt+↓", "next room")),
+		GoToRoom: key.NewBinding(
+			key.WithKeys("alt+1", "alt+2", "alt+3", "alt+4", "alt+5", "alt+6", "alt+7", "alt+8", "alt+9"),
+			key.WithHelp("alt+1…9", "room by number"),
+		),
+
+		MenuPrev: key.NewBinding(key.WithKeys("left", "h", "shift+tab"), key.WithHelp("←", "previous action")),
+		MenuNext: key.NewBinding(key.WithKeys("right", "l", "tab"), key.WithHelp("→", "next action")),
+		Expand:   key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "expand")),
+		Copy:     key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "copy")),
+		Reply:    key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "reply")),
+		CopyID:   key.NewBinding(key.WithKeys("i"), key.WithHelp("i", "copy ID")),
+		Open:     key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "open")),
+	}
+}
+
+// NewKeyMap returns the default keys with overrides applied. overrides
+// maps a binding's name, e.g. "quit" or "prev_room", to the keys that
+// trigger it in bubbletea's notation ("ctrl+q", "alt+enter", "j"); an
+// empty list unbinds it.
+func NewKeyMap(overrides map[string][]string) (KeyMap, error) {
+	k := DefaultKeyMap()
+	byName := k.named()
+	for name, keys := range overrides {
+		b, ok := byName[name]
+		if !ok {
+			names := slices.Sorted(maps.Keys(byName))
+			return k, fmt.Errorf("unknown key binding %q, want one of %s", name, strings.Join(names, ", "))
+		}
+		if len(keys) == 0 {
+			if name == "quit" {
+				return k, fmt.Errorf("%q needs at least one key", name)
+			}
+			b.Unbind()
+			continue
+		}
+		b.SetKeys(keys...)
+		b.SetHelp(strings.Join(keys, "/"), b.Help().Desc)
+	}
+	return k, nil
+}
+
+func (k *KeyMap) named() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"quit":         &k.Quit,
+		"back":         &k.Back,
+		"help":         &k.Help,
+		"enter":        &k.Enter,
+		"up":           &k.Up,
+		"down":         &k.Down,
+		"bottom":       &k.Bottom,
+		"complete":     &k.Complete,
+		"toggle_rooms": &k.ToggleRooms,
+		"toggle_peers": &k.TogglePeers,
+		"prev_room":    &k.PrevRoom,
+		"next_room":    &k.NextRoom,
+		"go_to_room":   &k.GoToRoom,
+		"menu_prev":    &k.MenuPrev,
+		"menu_next":    &k.MenuNext,
+		"expand":       &k.Expand,
+		"copy":         &k.Copy,
+		"reply":        &k.Reply,
+		"copy_id":      &k.CopyID,
+		"open":         &k.Open,
+	}
+}
+
+// ShortHelp implements help.KeyMap.
+func (k KeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Help, k.Enter, k.Up, k.Back, k.Quit}
+}
+
+// FullHelp implements help.KeyMap, one group per column.
+func (k KeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Enter, k.Complete, k.Up, k.Down, k.Bottom, k.Back, k.Help, k.Quit},
+		{k.ToggleRooms, k.TogglePeers, k.PrevRoom, k.NextRoom, k.GoToRoom},
+		{k.MenuPrev, k.MenuNext, k.Expand, k.Copy, k.Reply, k.CopyID, k.Open},
+	}
+}
+
+// typing reports whether msg is text for the input rather than a key
+// binding. Printable keys type once something has been typed, so
+// bindings like ? only act on an empty input or a selected message.
+func (m Model) typing(msg tea.KeyMsg) bool {
+	if msg.Alt || (msg.Type != tea.KeyRunes && msg.Type != tea.KeySpace) {
+		return false
+	}
+	if m.screen == "welcome" {
+		return m.input.Value() != ""
+	}
+	return m.selectedMsg == -1 && m.textArea.Value() != ""
+}
+
+// showKeys opens an overlay listing the key bindings in use.
+func (m Model) showKeys() (tea.Model, tea.Cmd) {
+	h := help.New()
+	h.Width = m.chatWidth()
+
+	titles := []string{"chat", "rooms", "selected message"}
+	var b strings.Builder
+	for i, group := range m.keymap.FullHelp() {
+		b.WriteString("\n  " + SidebarTitleStyle.Render(titles[i]) + "\n")
+		for _, line := range strings.Split(h.FullHelpView([][]key.Binding{group}), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	b.WriteString("\n" + StatusStyle.Render(`  rebind them under "keys" in config.json, e.g. "quit": ["ctrl+q"]`) + "\n")
+
+	m.openOverlay("keys", b.String())
+	return m, nil
+}
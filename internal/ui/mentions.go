@@ -0,0 +1,122 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/reflow/truncate"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/moderation"
+)
+
+// completion is the state of Tab-completing an @name, so pressing Tab
+// again moves on to the next match.
+type completion struct {
+	base  string   // the input up to the @
+	names []string // matching names, sorted
+	next  int
+}
+
+// current is the input as the last completion left it.
+func (c *completion) current() string {
+	return c.base + "@" + c.names[(c.next+len(c.names)-1)%len(c.names)] + " "
+}
+
+// mentionsMe reports whether someone else's msg mentions us.
+func (m Model) mentionsMe(msg chat.ChatMessage) bool {
+	return m.chat != nil && !m.isOwn(msg) && msg.Mentioned(m.chat.Self())
+}
+
+// completeMention completes the @name being typed at the end of the
+// input from the names of who is in the room. ok is false if there is
+// nothing to complete, so Tab can do whatever else it does.
+func (m Model) completeMention() (_ tea.Model, ok bool) {
+	value := m.textArea.Value()
+	lines := strings.Split(value, "\n")
+	li := m.textArea.LineInfo()
+	if m.chat == nil || m.textArea.Line() != len(lines)-1 || li.StartColumn+li.ColumnOffset != len([]rune(lines[len(lines)-1])) {
+		return m, false // only at the end of the input
+	}
+
+	c := m.completion
+	if c == nil || value != c.current() {
+		at := strings.LastIndexByte(value, '@')
+		if at < 0 || strings.ContainsAny(value[at:], " \t\n") {
+			return m, false
+		}
+		prefix := strings.ToLower(value[at+1:])
+		c = &completion{base: value[:at]}
+		for _, id := range m.chat.Peers() {
+			name, known := m.chat.PeerName(id)
+			name = sanitizeLine(name)
+			if known && name != "" && strings.HasPrefix(strings.ToLower(name), prefix) {
+				c.names = append(c.names, name)
+			}
+		}
+		if len(c.names) == 0 {
+			return m, false
+		}
+		slices.SortFunc(c.names, func(a, b string) int { return strings.Compare(strings.ToLower(a), strings.ToLower(b)) })
+		c.names = slices.Compact(c.names)
+	}
+
+	m.textArea.SetValue(c.base + "@" + c.names[c.next%len(c.names)] + " ")
+	c.next++
+	m.completion = c
+	m.fitInput()
+	return m, true
+}
+
+// Output is the terminal the TUI draws on; pass it to tea.WithOutput.
+// Bubble Tea writes each frame in a single Write, so taking turns with
+// it keeps a notification from landing in the middle of one.
+var Output = &terminal{File: os.Stdout}
+
+// terminal serialises writes to a terminal. It is still an *os.File
+// underneath, so Bubble Tea can size it and put it in raw mode.
+type terminal struct {
+	*os.File
+	mu sync.Mutex
+}
+
+func (t *terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.File.Write(p)
+}
+
+// notifyMention alerts the user to a message mentioning them in room:
+// a desktop notification on terminals that take OSC 9, a bell on the
+// rest. It writes through Output, between frames.
+func notifyMention(room string, msg chat.ChatMessage) tea.Cmd {
+	text, _, _ := strings.Cut(msg.Content, "\n")
+	text = fmt.Sprintf("%s in #%s: %s", msg.Sender, moderation.DisplayName(room), text)
+	text = truncate.StringWithTail(sanitizeLine(text), 200, "…")
+	return func() tea.Msg {
+		seq := "\a"
+		if supportsOSC9() {
+			seq = "\x1b]9;" + text + "\a"
+		}
+		_, _ = Output.Write([]byte(seq))
+		return nil
+	}
+}
+
+// supportsOSC9 reports whether the terminal shows OSC 9 sequences as
+// notifications. Terminals that don't would drop or print them, and
+// tmux doesn't pass them on without extra setup.
+func supportsOSC9() bool {
+	if os.Getenv("TMUX") != "" {
+		return false
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "ghostty":
+		return true
+	}
+	return false
+}
@@ -6,27 +6,56 @@ import (
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
-	"github.com/charmbracelet/glamour/styles"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/muesli/reflow/truncate"
 
+	"github.com/ekrishgupta/Hush/internal/block"
 	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/groupkey"
+	"github.com/ekrishgupta/Hush/internal/invite"
+	"github.com/ekrishgupta/Hush/internal/moderation"
+	"github.com/ekrishgupta/Hush/internal/rooms"
+	"github.com/ekrishgupta/Hush/internal/theme"
+	"github.com/ekrishgupta/Hush/internal/transfer"
+	"github.com/ekrishgupta/Hush/internal/trust"
 )
 
 const (
-	spamCooldown   = 1500 * time.Millisecond
+	spamCooldown = 1500 * time.Millisecond
+
+	// maxNameLen is the longest name, in runes, we post under.
+	maxNameLen = 30
+
+	// MaxMessageSize is the longest message sent inline; longer input
+	// is sent as a text attachment.
 	MaxMessageSize = 512
+
+	skewMarker    = "⏱ "
+	pendingMarker = "◌ pending "
 )
 
 // ── Bubble Tea messages ─────────────────────────────
 
-// IncomingMsg is a Bubble Tea message wrapping a chat message from the network.
-type IncomingMsg chat.ChatMessage
+// IncomingMsg is a Bubble Tea message wrapping a chat message from the
+// network, and the room it was said in.
+type IncomingMsg struct {
+	Room string
+	chat.ChatMessage
+}
+
+// chatErrMsg reports a problem with incoming traffic in a room, e.g. a
+// message that failed to decode.
+type chatErrMsg struct {
+	room string
+	err  error
+}
 
 type tickMsg time.Time
 
@@ -46,10 +75,24 @@ var hushASCII = `
 type Model struct {
 	screen   string // "welcome" or "chat"
 	username string
+	files    *transfer.Service
+	trust    *trust.Store
+	blocks   *block.List
+	invites  *invite.Service
+
+	// rooms joins and leaves rooms; joined lists them in sidebar order
+	rooms     *rooms.Manager
+	joined    []*rooms.Room
+	timelines map[string]*chat.Timeline // by room
+	unread    map[string]int            // messages not yet seen, by room
+
+	// The room on screen, and its parts
+	room     *rooms.Room
 	chat     *chat.Chat
-	msgChan  <-chan chat.ChatMessage
+	mod      *moderation.Room
+	keys     *groupkey.Keys
+	timeline *chat.Timeline
 
-	messages []chat.ChatMessage
 	viewport viewport.Model
 	input    textinput.Model // For welcome screen
 	textArea textarea.Model  // For chat screen
@@ -62,14 +105,43 @@ type Model struct {
 	height int
 	ready  bool
 
+	showRooms bool // left sidebar
+	showPeers bool // right sidebar
+
+	keymap KeyMap
+	theme  *theme.Theme // nil keeps the adaptive default colors
+	clock  Clock
+	now    time.Time // what relative times count from, moved on by tickMsg
+
 	renderer        *glamour.TermRenderer
 	compactRenderer *glamour.TermRenderer
+	rendered        map[string]*renderedMsg // by message ID
+	lineStarts      []int                   // viewport line each message starts on, then the total
+
+	peerCount    int
+	pendingCount int
+	keyEpoch     uint64
+
+	transfers map[string]transfer.Progress // by attachment hash
 
-	peerCount int
+	// overlay, when set, is shown in place of the messages
+	overlay      *viewport.Model
+	overlayTitle string
+
+	previews  map[string]bool // message IDs with an expanded paste preview
+	pagerWant string          // attachment to page once it has downloaded
+
+	suspect    map[peer.ID]bool // keys that took over a known name
+	trustAlert *trust.Alert     // shown in the status bar until verified
 
 	// Navigation & Truncation
-	expanded    map[int]bool // map[messageIndex]bool
-	selectedMsg int          // index of selected message, -1 if none (input focused)
+	expanded    map[string]bool   // message IDs shown in full
+	menu        bool              // action menu open for the selected message
+	menuItem    int               // highlighted entry in the action menu
+	newBelow    int               // messages arrived below while scrolled up
+	marks       map[string]string // room name → first message ID not yet seen there
+	completion  *completion       // Tab-completing an @name
+	selectedMsg int               // index of selected message, -1 if none (input focused)
 }
 
 func tick() tea.Cmd {
@@ -78,19 +150,32 @@ func tick() tea.Cmd {
 	})
 }
 
-// NewModel creates a new chat TUI model.
-func NewModel(username string, c *chat.Chat, msgChan <-chan chat.ChatMessage) Model {
+// Services are the optional backends behind the TUI's features. A nil
+// field disables the commands that need it.
+type Services struct {
+	Files   *transfer.Service // /send, /accept, /attachments
+	Trust   *trust.Store      // /verify
+	Blocks  *block.List       // /mute, /block
+	Invites *invite.Service   // /invite
+	Keys    *KeyMap           // nil for DefaultKeyMap
+	Theme   *theme.Theme      // /theme; nil for colors that suit the terminal
+	Clock   *Clock            // nil for relative times in the local zone
+}
+
+// NewModel creates a new chat TUI model showing the rooms rm has
+// joined, starting with the one called current.
+func NewModel(username string, rm *rooms.Manager, current string, svc Services) Model {
 	// Welcome Screen Input
 	ti := textinput.New()
 	ti.Placeholder = "enter your name..."
 	ti.Focus()
-	ti.CharLimit = 30
+	ti.CharLimit = maxNameLen
 	ti.Width = 40
 
 	// Chat Screen Input
 	ta := textarea.New()
 	ta.Placeholder = "type a message..."
-	ta.CharLimit = MaxMessageSize
+	ta.CharLimit = maxPasteSize
 	ta.ShowLineNumbers = false
 	ta.SetHeight(1)
 	ta.SetWidth(60) // Will be updated on resize
@@ -107,41 +192,67 @@ func NewModel(username string, c *chat.Chat, msgChan <-chan chat.ChatMessage) Mo
 		ta.Focus()
 	}
 
-	return Model{
+	m := Model{
 		screen:      screen,
 		username:    username,
-		chat:        c,
-		msgChan:     msgChan,
+		files:       svc.Files,
+		trust:       svc.Trust,
+		blocks:      svc.Blocks,
+		invites:     svc.Invites,
+		rooms:       rm,
+		timelines:   make(map[string]*chat.Timeline),
+		unread:      make(map[string]int),
+		marks:       make(map[string]string),
+		suspect:     make(map[peer.ID]bool),
+		transfers:   make(map[string]transfer.Progress),
 		input:       ti,
 		textArea:    ta,
-		messages:    []chat.ChatMessage{},
-		expanded:    make(map[int]bool),
+		timeline:    chat.NewTimeline(),
+		expanded:    make(map[string]bool),
+		rendered:    make(map[string]*renderedMsg),
+		previews:    make(map[string]bool),
+		keymap:      DefaultKeyMap(),
+		now:         time.Now(),
 		selectedMsg: -1,
 		// internal/ui/model.go
 		// We initialize renderer later on resize or here with default
 		// Actually best to init here with safe default
 	}
-}
-
-// waitForMsg returns a command that waits for the next network message.
-func (m Model) waitForMsg() tea.Cmd {
-	return func() tea.Msg {
-		if m.msgChan == nil {
-			return nil
+	if svc.Keys != nil {
+		m.keymap = *svc.Keys
+	}
+	if svc.Clock != nil {
+		m.clock = *svc.Clock
+	}
+	if svc.Theme != nil {
+		m.theme = svc.Theme
+		useTheme(svc.Theme)
+	}
+	if rm != nil {
+		for _, r := range rm.Rooms() {
+			m.joined = append(m.joined, r)
+			m.timelines[r.Name] = chat.NewTimeline()
 		}
-		msg, ok := <-m.msgChan
-		if !ok {
-			return nil
+		if r := m.joinedRoom(current); r != nil {
+			m.enter(r)
+		} else if len(m.joined) > 0 {
+			m.enter(m.joined[0])
 		}
-		return IncomingMsg(msg)
 	}
+	return m
 }
 
 // Init starts listening for network messages.
 func (m Model) Init() tea.Cmd {
 	cmds := []tea.Cmd{textinput.Blink}
-	if m.msgChan != nil {
-		cmds = append(cmds, m.waitForMsg(), tick())
+	if len(m.joined) > 0 {
+		cmds = append(cmds, tick())
+	}
+	for _, r := range m.joined {
+		cmds = append(cmds, m.listen(r))
+	}
+	if m.files != nil {
+		cmds = append(cmds, m.waitForProgress())
 	}
 	return tea.Batch(cmds...)
 }
@@ -153,8 +264,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tickMsg:
+		// Relative times on screen catch up as they're redrawn
+		m.now = time.Time(msg)
 		if m.chat != nil {
 			m.peerCount = m.chat.PeerCount()
+			m.pendingCount = m.chat.PendingCount()
+		}
+		if m.keys != nil {
+			m.keyEpoch = m.keys.Epoch()
 		}
 		cmds = append(cmds, tick())
 
@@ -164,11 +281,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		// Update glamour renderer with new width
 		// Subtract some padding for aesthetics
-		wrapWidth := m.width - 10
+		wrapWidth := m.chatWidth() - 10
 		if wrapWidth < 20 {
 			wrapWidth = 20
 		}
-		style := styles.DraculaStyleConfig
+		style := m.markdownStyle()
 		var zero uint = 0
 		style.Document.Margin = &zero
 		// Keep padding/indent for structured content? Maybe set to 0 too for compact.
@@ -181,12 +298,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		)
 
 		// Compact renderer: No wrap, no margin
-		styleCompact := styles.DraculaStyleConfig
+		styleCompact := m.markdownStyle()
 		styleCompact.Document.Margin = &zero
 		m.compactRenderer, _ = glamour.NewTermRenderer(
 			glamour.WithStyles(styleCompact),
 			glamour.WithWordWrap(0),
 		)
+		// Everything rendered so far used the old width or style
+		clear(m.rendered)
 
 		if m.screen == "chat" {
 			headerH := 3
@@ -207,72 +326,168 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 			if !m.ready {
-				m.viewport = viewport.New(m.width, vpHeight)
-				m.viewport.SetContent(m.renderMessages())
+				m.viewport = viewport.New(m.chatWidth(), vpHeight)
+				m.layoutMessages()
 				m.ready = true
 			} else {
-				m.viewport.Width = m.width
+				m.viewport.Width = m.chatWidth()
 				m.viewport.Height = vpHeight
-				// Re-render specifically to handle dynamic width changes like truncation points
-				m.viewport.SetContent(m.renderMessages())
+				// Lay out again: expanded messages wrap differently at a new width
+				m.layoutMessages()
 			}
 			m.textArea.SetWidth(m.width - 6)
 		}
 
 	case tea.KeyMsg:
-		switch msg.Type {
-		case tea.KeyCtrlC, tea.KeyEsc:
+		if m.overlay != nil {
+			return m.updateOverlay(msg)
+		}
+		if m.menu {
+			return m.updateMenu(msg)
+		}
+		if m.typing(msg) {
+			m.showWarning = false
+			break
+		}
+		if m.screen == "chat" {
+			if next, cmd, ok := m.handleSidebarKey(msg); ok {
+				return next, cmd
+			}
+		}
+		switch {
+		case key.Matches(msg, m.keymap.Quit, m.keymap.Back):
 			if m.selectedMsg != -1 {
 				m.selectedMsg = -1
-				m.viewport.GotoBottom()
+				m.gotoBottom()
 				return m, nil
 			}
-			return m, tea.Quit
+			if key.Matches(msg, m.keymap.Quit) {
+				return m, tea.Quit
+			}
+			return m, nil
+
+		case m.screen == "chat" && key.Matches(msg, m.keymap.Help):
+			return m.showKeys()
 
-		case tea.KeyUp, tea.KeyDown:
-			if m.screen == "chat" && len(m.messages) > 0 {
-				if msg.Type == tea.KeyUp {
+		case key.Matches(msg, m.keymap.Up, m.keymap.Down):
+			if m.screen == "chat" && m.timeline.Len() > 0 {
+				if key.Matches(msg, m.keymap.Up) {
 					if m.selectedMsg == -1 {
 						// Select last message
-						m.selectedMsg = len(m.messages) - 1
+						m.selectedMsg = m.timeline.Len() - 1
 					} else if m.selectedMsg > 0 {
 						m.selectedMsg--
 					}
-				} else { // KeyDown
+				} else { // Down
 					if m.selectedMsg != -1 {
-						if m.selectedMsg < len(m.messages)-1 {
+						if m.selectedMsg < m.timeline.Len()-1 {
 							m.selectedMsg++
 						} else {
 							// Deselect, return to input
 							m.selectedMsg = -1
-							m.viewport.GotoBottom()
+							m.gotoBottom()
 						}
 					}
 				}
-				// Re-render to show selection
-				m.viewport.SetContent(m.renderMessages())
+				// Selecting doesn't change any message's height, so
+				// there's nothing to lay out again
 				return m, nil
 			}
 
-		case tea.KeyEnter:
+		case key.Matches(msg, m.keymap.Enter):
 			if m.screen == "welcome" {
 				return m.handleWelcomeEnter()
 			}
-			// If a message is selected, ignore Enter (disable expansion)
+			// If a message is selected, Enter opens its actions
 			if m.selectedMsg != -1 {
+				m.menu, m.menuItem = true, 0
 				return m, nil
 			}
 			return m.handleChatEnter()
 
+		case m.screen == "chat" && m.selectedMsg == -1 && key.Matches(msg, m.keymap.Complete):
+			if next, ok := m.completeMention(); ok {
+				return next, nil
+			}
+
+		case m.screen == "chat" && key.Matches(msg, m.keymap.Bottom):
+			return m.jumpToBottom()
+
+		case m.selectedMsg != -1 && key.Matches(msg, m.keymap.Open):
+			return m.actPager()
+
 		default:
 			m.showWarning = false
 		}
 
 	case IncomingMsg:
-		m.messages = append(m.messages, chat.ChatMessage(msg))
-		m.viewport.SetContent(m.renderMessages())
-		m.viewport.GotoBottom()
-		cmds = append(cmds, m.waitForMsg())
+		r := m.joinedRoom(msg.Room)
+		if r == nil {
+			break // a room we have since left
+		}
+		cmds = append(cmds, waitForMsg(r))
+		if m.blocks != nil && m.blocks.Muted(msg.From) {
+			break
+		}
+		// A known ID is one of our queued messages that was just
+		// delivered or a flood placeholder with a new count; any other
+		// repeat of one is dropped
+		cm := sanitizeMessage(msg.ChatMessage)
+		if r != m.room {
+			tl := m.timelines[r.Name]
+			if tl.Replace(cm, r.Chat.Self()) {
+				break
+			}
+			if _, ok := tl.Insert(cm); !ok {
+				break
+			}
+			if !m.isOwn(cm) {
+				m.unread[r.Name]++
+				m.markUnread(r.Name, cm.ID)
+			}
+		} else if !m.showIncoming(cm) {
+			break
+		}
+		if m.mentionsMe(cm) {
+			cmds = append(cmds, notifyMention(r.Name, cm))
+		}
+
+	case chatErrMsg:
+		r := m.joinedRoom(msg.room)
+		if r == nil {
+			break
+		}
+		m.showWarning = true
+		m.warningMsg = "⚠ dropped " + sanitizeLine(msg.err.Error())
+		if r != m.room {
+			m.warningMsg = "⚠ #" + moderation.DisplayName(r.Name) + ": dropped " + sanitizeLine(msg.err.Error())
+		}
+		cmds = append(cmds, waitForErr(r))
+
+	case progressMsg:
+		// Names, and paths built from them, come from the offering peer,
+		// and errors can carry text from the peer we downloaded from
+		msg.Name, msg.Path, msg.Err = sanitizeLine(msg.Name), sanitizeLine(msg.Path), sanitizeLine(msg.Err)
+		m.transfers[msg.Hash] = transfer.Progress(msg)
+		if msg.Done && msg.Err != "" {
+			m.showWarning = true
+			m.warningMsg = fmt.Sprintf("⚠ %s: %s", msg.Name, msg.Err)
+		}
+		m.pagerReady(transfer.Progress(msg))
+		m.layoutMessages()
+		cmds = append(cmds, m.waitForProgress())
+
+	case sharedMsg:
+		return m.handleShared(msg)
+
+	case trustAlertMsg:
+		return m.handleTrustAlert(msg)
+
+	case moderationMsg:
+		return m.handleModeration(msg.room)
+
+	case joinedMsg:
+		return m.handleJoined(msg)
 	}
 
 	// Update sub-components
@@ -292,43 +507,52 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.textArea.Placeholder = ""
 		}
 
-		// Dynamic Resize Logic
-		lines := m.textArea.LineCount()
+		m.fitInput()
 
-		// Adjust prompt based on multiline state
-		if lines > 1 {
-			m.textArea.Prompt = "  "
-		} else {
-			m.textArea.Prompt = "> "
+		m.viewport, cmd = m.viewport.Update(msg)
+		cmds = append(cmds, cmd)
+		if m.viewport.AtBottom() {
+			m.newBelow = 0
 		}
+	}
 
-		if lines < 1 {
-			lines = 1
-		}
-		if lines > 5 {
-			lines = 5
-		} // Cap expansion
+	return m, tea.Batch(cmds...)
+}
 
-		if lines != m.textArea.Height() {
-			m.textArea.SetHeight(lines)
+// fitInput grows the textarea with what has been typed, up to five
+// lines, and gives the viewport what is left.
+func (m *Model) fitInput() {
+	// Dynamic Resize Logic
+	lines := m.textArea.LineCount()
 
-			// Recalculate viewport height
-			headerH := 3
-			warnH := 1
-			inputH := lines + 2
-			vpHeight := m.height - headerH - inputH - warnH - 1
-			if vpHeight < 0 {
-				vpHeight = 0
-			}
+	// Adjust prompt based on multiline state
+	if lines > 1 {
+		m.textArea.Prompt = "  "
+	} else {
+		m.textArea.Prompt = "> "
+	}
 
-			m.viewport.Height = vpHeight
+	if lines < 1 {
+		lines = 1
+	}
+	if lines > 5 {
+		lines = 5
+	} // Cap expansion
+
+	if lines != m.textArea.Height() {
+		m.textArea.SetHeight(lines)
+
+		// Recalculate viewport height
+		headerH := 3
+		warnH := 1
+		inputH := lines + 2
+		vpHeight := m.height - headerH - inputH - warnH - 1
+		if vpHeight < 0 {
+			vpHeight = 0
 		}
 
-		m.viewport, cmd = m.viewport.Update(msg)
-		cmds = append(cmds, cmd)
+		m.viewport.Height = vpHeight
 	}
-
-	return m, tea.Batch(cmds...)
 }
 
 func (m Model) handleWelcomeEnter() (tea.Model, tea.Cmd) {
@@ -339,6 +563,9 @@ func (m Model) handleWelcomeEnter() (tea.Model, tea.Cmd) {
 
 	m.username = name
 	m.screen = "chat"
+	if m.rooms != nil {
+		m.rooms.SetName(name)
+	}
 	m.ready = false
 
 	// Switch to Chat TextArea
@@ -353,17 +580,8 @@ func (m Model) handleWelcomeEnter() (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	cmds = append(cmds, tick())
 
-	// Start listening now
-	if m.chat != nil {
-		cmds = append(cmds, m.waitForMsg())
-	}
-
 	// Force a WindowSize re-calc by sending the current size
-	if m.width > 0 {
-		cmds = append(cmds, func() tea.Msg {
-			return tea.WindowSizeMsg{Width: m.width, Height: m.height}
-		})
-	}
+	cmds = append(cmds, m.resize())
 
 	return m, tea.Batch(cmds...)
 }
@@ -376,21 +594,44 @@ func (m Model) handleChatEnter() (tea.Model, tea.Cmd) {
 	if content == "" {
 		return m, nil
 	}
+	switch {
+	case strings.HasPrefix(content, "//"):
+		content = content[1:] // a message that starts with a slash
+	case strings.HasPrefix(content, "/"):
+		return m.handleCommand(content)
+	}
+	return m.send(content)
+}
 
+// send posts content typed into the chat input.
+func (m Model) send(content string) (tea.Model, tea.Cmd) {
 	if time.Since(m.lastSent) < spamCooldown {
 		m.showWarning = true
 		m.warningMsg = "⚡ Slow down!"
 		return m, nil
 	}
+	if isLongPaste(content) {
+		return m.sendPaste(content)
+	}
 
 	m.showWarning = false
-	if err := m.chat.Publish(m.username, content); err == nil {
-		ownMsg := chat.NewChatMessage(m.username, content)
-		m.messages = append(m.messages, ownMsg)
-		m.viewport.SetContent(m.renderMessages())
-		m.viewport.GotoBottom()
-		m.lastSent = time.Now()
+	ownMsg, err := m.chat.Publish(m.username, content)
+	if err != nil {
+		m.showWarning = true
+		m.warningMsg = "⚠ " + err.Error()
+		return m, nil
 	}
+	m.insertMessage(ownMsg)
+	m.layoutMessages()
+	m.gotoBottom()
+	m.lastSent = time.Now()
+	m.resetInput()
+
+	return m, nil
+}
+
+// resetInput clears the textarea and shrinks it back to one line.
+func (m *Model) resetInput() {
 	m.textArea.Reset()
 	m.textArea.SetHeight(1)
 
@@ -403,174 +644,204 @@ func (m Model) handleChatEnter() (tea.Model, tea.Cmd) {
 		vpHeight = 0
 	}
 	m.viewport.Height = vpHeight
+}
 
-	return m, nil
+// isOwn reports whether we sent msg, under this name or an earlier one.
+// Only our peer ID counts, since anyone can pick our name; a message
+// without one, like those from before IDs were recorded, isn't ours.
+func (m Model) isOwn(msg chat.ChatMessage) bool {
+	return m.chat != nil && msg.From != "" && msg.From == m.chat.Self()
+}
+
+// insertMessage adds msg to the timeline at its causal position, keeping
+// the selection on the same message if something lands above it. It
+// reports false if the message was already there.
+func (m *Model) insertMessage(msg chat.ChatMessage) bool {
+	idx, ok := m.timeline.Insert(msg)
+	if ok && m.selectedMsg != -1 && idx <= m.selectedMsg {
+		m.selectedMsg++
+	}
+	return ok
 }
 
 // ── Render: Messages ────────────────────────────────
 
-func (m Model) renderMessages() string {
-	if len(m.messages) == 0 {
-		return StatusStyle.Render("\n  waiting for ghosts to appear... 👻\n")
+// renderMessage renders the i-th message of the timeline: one line, or
+// the message in full once expanded, with any open preview below it. A
+// folded message continuing its sender's group goes without their name,
+// and without its time unless selected.
+func (m Model) renderMessage(i int, msg chat.ChatMessage) string {
+	grouped := !m.expanded[msg.ID] && m.continues(i, msg)
+	tsRaw := m.clock.Format(msg.Time(), m.now)
+	if grouped && i != m.selectedMsg {
+		tsRaw = ""
+	}
+	ts := TimestampStyle.Render(tsRaw)
+	if msg.Skewed {
+		// Flag peers whose clocks are far off so odd ordering makes sense
+		tsRaw = skewMarker + tsRaw
+		ts = SkewStyle.Render(skewMarker) + ts
+	}
+	if msg.Pending {
+		// Queued in the outbox until someone joins
+		tsRaw = pendingMarker + tsRaw
+		ts = TimestampStyle.Render(pendingMarker) + ts
+	}
+	if msg.Hidden > 0 {
+		// Stands in for a flooding peer's messages; one dim line, no markdown
+		return m.renderHidden(msg, i == m.selectedMsg, ts)
 	}
 
-	var b strings.Builder
-	for i, msg := range m.messages {
-		tsRaw := msg.Time().Format("15:04:05")
-		ts := TimestampStyle.Render(tsRaw)
-
-		// Determine sender label
-		var senderLabel string
-		if msg.Sender == m.username {
-			senderLabel = "you"
+	// Determine sender label
+	var senderLabel string
+	if m.isOwn(msg) {
+		senderLabel = "you"
+	} else {
+		senderLabel = msg.Sender
+	}
+	var badge string
+	switch {
+	case m.suspect[msg.From]:
+		// A known name on an unfamiliar key: possibly an impersonator
+		badge = WarningStyle.Render("⚠") + " "
+	case m.trust != nil && msg.From != "" && m.trust.Verified(msg.From):
+		badge = VerifiedStyle.Render("✓") + " "
+	}
+	badge += m.roleBadge(msg.From)
+
+	isSelected := (i == m.selectedMsg)
+	isExpanded := m.expanded[msg.ID]
+
+	// Margin/Cursor
+	// Default margin is 2 spaces. If selected, use "> ", and "@ "
+	// for messages that mention us.
+	var margin string
+	switch {
+	case isSelected:
+		margin = lipgloss.NewStyle().Foreground(ghostPink).Render("> ")
+	case m.mentionsMe(msg):
+		margin = MentionStyle.Render("@ ")
+	default:
+		margin = "  "
+	}
+
+	// Prepare styles
+	var (
+		rawContent    = msg.Content + m.attachmentStatus(msg)
+		styledSender  string
+		styledContent string
+	)
+	if hasPreview(msg) {
+		if m.previews[msg.ID] {
+			rawContent = "▾ " + rawContent
 		} else {
-			senderLabel = msg.Sender
+			rawContent = "▸ " + rawContent
 		}
+	}
+
+	if m.isOwn(msg) {
+		styledSender = SelfMsgSender.Render(senderLabel)
+	} else {
+		styledSender = PeerMsgSender.Render(senderLabel)
+	}
+	styledSender = badge + styledSender
 
-		isSelected := (i == m.selectedMsg)
-		isExpanded := m.expanded[i]
+	var lines string
 
-		// Margin/Cursor
-		// Default margin is 2 spaces. If selected, use "> ".
-		var margin string
+	if !isExpanded {
+		// Compact view: Single line with truncation
+		// Markdown rendered to ANSI, first line only
+		rendered := m.renderCompact(msg.ID, rawContent)
+
+		// Calculate space
+		prefixWidth := lipgloss.Width(margin) + lipgloss.Width(badge) + lipgloss.Width(senderLabel) + 2
+		suffixWidth := 3 + lipgloss.Width(tsRaw)
+		availableWidth := m.chatWidth() - prefixWidth - suffixWidth
+		if availableWidth < 10 {
+			availableWidth = 10
+		}
+
+		// Prepare ellipsis
+		var tail string
 		if isSelected {
-			margin = lipgloss.NewStyle().Foreground(ghostPink).Render("> ")
+			tail = SelectedMsgStyle.Render(" (...)")
 		} else {
-			margin = "  "
+			tail = " (...)"
 		}
 
-		// Prepare styles
-		var (
-			rawContent    = msg.Content
-			styledSender  string
-			styledContent string
-		)
-
-		if msg.Sender == m.username {
-			styledSender = SelfMsgSender.Render(senderLabel)
+		// Truncate ANSI-aware
+		var displayContent string
+		// Check if we actually need truncation to avoid unnecessary ellipsis
+		if lipgloss.Width(rendered) > availableWidth {
+			displayContent = truncate.StringWithTail(rendered, uint(availableWidth), tail)
 		} else {
-			styledSender = PeerMsgSender.Render(senderLabel)
-		}
-
-		var lines string
-
-		if !isExpanded {
-			// Compact view: Single line with truncation
-			// Render Markdown first to get ANSI
-			var rendered string
-			if m.compactRenderer != nil {
-				// Use compact renderer
-				out, err := m.compactRenderer.Render(rawContent)
-				if err == nil {
-					rendered = strings.TrimSpace(out)
-				} else {
-					rendered = rawContent
-				}
-			} else {
-				rendered = rawContent
-			}
-
-			// Extract first line
-			if idx := strings.Index(rendered, "\n"); idx != -1 {
-				rendered = rendered[:idx]
-			}
-
-			// Calculate space
-			prefixWidth := lipgloss.Width(margin) + lipgloss.Width(senderLabel) + 2
-			suffixWidth := 3 + lipgloss.Width(tsRaw)
-			availableWidth := m.width - prefixWidth - suffixWidth
-			if availableWidth < 10 {
-				availableWidth = 10
-			}
+			displayContent = rendered
+		}
 
-			// Prepare ellipsis
-			var tail string
-			if isSelected {
-				tail = SelectedMsgStyle.Render(" (...)")
-			} else {
-				tail = " (...)"
-			}
+		// For style consistency (green/pink colors), we might want to apply them ONLY if
+		// the content is plain text (no escape codes). But checking for escape codes is fragile.
+		// Let's rely on glamour's dracula theme which is nice enough.
+		styledContent = displayContent
 
-			// Truncate ANSI-aware
-			var displayContent string
-			// Check if we actually need truncation to avoid unnecessary ellipsis
-			if lipgloss.Width(rendered) > availableWidth {
-				displayContent = truncate.StringWithTail(rendered, uint(availableWidth), tail)
-			} else {
-				displayContent = rendered
-			}
+		left := fmt.Sprintf("%s%s: %s", margin, styledSender, styledContent)
+		if grouped {
+			// Lined up under the group's first message
+			left = margin + strings.Repeat(" ", lipgloss.Width(styledSender)+2) + styledContent
+		}
+		currentLen := lipgloss.Width(left)
+		padding := m.chatWidth() - currentLen - lipgloss.Width(ts)
+		if padding < 2 {
+			padding = 2
+		}
 
-			// For style consistency (green/pink colors), we might want to apply them ONLY if
-			// the content is plain text (no escape codes). But checking for escape codes is fragile.
-			// Let's rely on glamour's dracula theme which is nice enough.
-			styledContent = displayContent
+		lines = fmt.Sprintf("%s%s%s", left, strings.Repeat(" ", padding), ts)
 
-			left := fmt.Sprintf("%s%s: %s", margin, styledSender, styledContent)
-			currentLen := lipgloss.Width(left)
-			padding := m.width - currentLen - lipgloss.Width(ts)
-			if padding < 2 {
-				padding = 2
-			}
+	} else {
+		// Expanded view: Multiline Markdown (glamour)
+		// We render the Header (Sender + Timestamp) followed by Content
+
+		// Header
+		// Format: "MarginSender:                               TIMESTAMP"
+		colon := ": "
+		headerLeft := fmt.Sprintf("%s%s%s", margin, styledSender, colon) // Includes color codes
+
+		// Calculate padding for timestamp alignment
+		// Ensure timestamp is pinned to right
+		tsWidth := lipgloss.Width(ts)
+		headerWidth := lipgloss.Width(headerLeft)
+		padding := m.chatWidth() - headerWidth - tsWidth - 2 // -2 margin right
+		if padding < 2 {
+			padding = 2
+		}
 
-			lines = fmt.Sprintf("%s%s%s", left, strings.Repeat(" ", padding), ts)
+		header := fmt.Sprintf("%s%s%s", headerLeft, strings.Repeat(" ", padding), ts)
 
-		} else {
-			// Expanded view: Multiline Markdown (glamour)
-			// We render the Header (Sender + Timestamp) followed by Content
-
-			// Header
-			// Format: "MarginSender:                               TIMESTAMP"
-			colon := ": "
-			headerLeft := fmt.Sprintf("%s%s%s", margin, styledSender, colon) // Includes color codes
-
-			// Calculate padding for timestamp alignment
-			// Ensure timestamp is pinned to right
-			tsWidth := lipgloss.Width(ts)
-			headerWidth := lipgloss.Width(headerLeft)
-			padding := m.width - headerWidth - tsWidth - 2 // -2 margin right
-			if padding < 2 {
-				padding = 2
-			}
+		// Content (Markdown), indented 2 spaces under the header
+		indentedBlock := m.renderFull(msg.ID, rawContent)
 
-			header := fmt.Sprintf("%s%s%s", headerLeft, strings.Repeat(" ", padding), ts)
-
-			// Content (Markdown)
-			// Use our glamour renderer
-			var renderedContent string
-			if m.renderer != nil {
-				out, err := m.renderer.Render(rawContent)
-				if err != nil {
-					renderedContent = rawContent // Fallback
-				} else {
-					renderedContent = out
-				}
-			} else {
-				renderedContent = rawContent
-			}
+		lines = header + "\n" + indentedBlock
+	}
 
-			// Trim excessive newlines from glamour output
-			renderedContent = strings.TrimSpace(renderedContent)
-
-			// Indent the rendered block to align with content start (optional)
-			// Or just indent a bit (2 spaces)
-			// Glamour adds margins usually, so maybe just 2 spaces
-			indent := strings.Repeat(" ", 2)
-			rows := strings.Split(renderedContent, "\n")
-			var indentedBlock string
-			for i, r := range rows {
-				if i == 0 {
-					indentedBlock += indent + r
-				} else {
-					indentedBlock += "\n" + indent + r
-				}
-			}
+	if hasPreview(msg) && m.previews[msg.ID] {
+		lines += "\n" + m.renderPreview(msg.Attachment)
+	}
 
-			lines = header + "\n" + indentedBlock
-		}
+	return lines
+}
 
-		b.WriteString(lines + "\n")
+// renderHidden renders the placeholder for messages dropped from a
+// peer that is flooding the room.
+func (m Model) renderHidden(msg chat.ChatMessage, selected bool, ts string) string {
+	margin := "  "
+	if selected {
+		margin = lipgloss.NewStyle().Foreground(ghostPink).Render("> ")
 	}
-	return b.String()
+	left := margin + HiddenStyle.Render("⋯ "+msg.Content)
+	padding := m.chatWidth() - lipgloss.Width(left) - lipgloss.Width(ts)
+	if padding < 2 {
+		padding = 2
+	}
+	return left + strings.Repeat(" ", padding) + ts
 }
 
 func (m Model) View() string {
@@ -644,23 +915,51 @@ func (m Model) viewChat() string {
 	b.WriteString(Header())
 	b.WriteString("\n")
 
-	// Status bar
-	status := fmt.Sprintf("  online as %s  (%d active ghosts)", m.username, m.peerCount)
-	b.WriteString(StatusStyle.Render(status))
+	// Status bar, replaced by any unresolved identity warning
+	if a := m.trustAlert; a != nil {
+		b.WriteString(WarningStyle.Render("  ⚠ " + a.String()))
+	} else {
+		status := fmt.Sprintf("  online as %s  (%d active ghosts)", m.username, m.peerCount)
+		if m.mod != nil && (m.mod.Owned() || len(m.joined) > 1) {
+			status = "  #" + moderation.DisplayName(m.chat.Room()) + status
+			if topic := m.mod.Topic(); topic != "" {
+				status += "  · " + sanitizeLine(topic)
+			}
+		}
+		if left, _ := m.sidebarWidths(); left == 0 {
+			if n := m.unreadElsewhere(); n > 0 {
+				status += fmt.Sprintf("  · %d unread in other rooms", n)
+			}
+		}
+		if m.pendingCount > 0 {
+			status += fmt.Sprintf("  · %d waiting for a peer", m.pendingCount)
+		}
+		if m.keyEpoch > 0 {
+			status += fmt.Sprintf("  · 🔒 key epoch %d", m.keyEpoch)
+		}
+		b.WriteString(StatusStyle.Render(status))
+	}
 	b.WriteString("\n")
 	b.WriteString(Divider(m.width))
 	b.WriteString("\n")
 
-	// Message viewport
-	b.WriteString(m.viewport.View())
+	// Message viewport, between any open sidebars
+	middle := m.viewMessages()
+	if m.overlay != nil {
+		middle = m.viewOverlay()
+	}
+	b.WriteString(m.viewSidebars(middle, m.viewport.Height))
 	b.WriteString("\n")
 
-	// Divider
-	b.WriteString(Divider(m.width))
+	// Divider, or how many new messages are below
+	b.WriteString(m.viewBottomDivider())
 	b.WriteString("\n")
 
-	// Warning
-	if m.showWarning {
+	// Warning, or the selected message's actions
+	if m.menu {
+		b.WriteString(m.viewMenu())
+		b.WriteString("\n")
+	} else if m.showWarning {
 		b.WriteString(WarningStyle.Render("  " + m.warningMsg))
 		b.WriteString("\n")
 	} else {
@@ -0,0 +1,189 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/moderation"
+	"github.com/ekrishgupta/Hush/internal/rooms"
+)
+
+// moderationMsg reports that a room's moderation state changed.
+type moderationMsg struct{ room string }
+
+// waitForModeration returns a command that waits for the next change to
+// r's moderation.
+func waitForModeration(r *rooms.Room) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case <-r.Mod.Changes():
+			return moderationMsg{room: r.Name}
+		case <-r.Done():
+			return nil
+		}
+	}
+}
+
+// handleModeration drops what kicked and banned peers already said and
+// redraws badges and the topic.
+func (m Model) handleModeration(room string) (tea.Model, tea.Cmd) {
+	r := m.joinedRoom(room)
+	if r == nil {
+		return m, nil
+	}
+	m.dropSanctioned(r)
+	return m, waitForModeration(r)
+}
+
+// dropSanctioned removes messages from peers who are kicked or banned
+// in r.
+func (m *Model) dropSanctioned(r *rooms.Room) {
+	n := m.timelines[r.Name].RemoveFunc(func(msg chat.ChatMessage) bool { return r.Mod.Banned(msg.From) })
+	if r != m.room {
+		return
+	}
+	if n > 0 {
+		m.selectedMsg = -1
+	}
+	m.layoutMessages()
+}
+
+// roleBadge marks the room's owner with ~ and moderators with @.
+func (m Model) roleBadge(id peer.ID) string {
+	if m.mod == nil || id == "" {
+		return ""
+	}
+	switch m.mod.Role(id) {
+	case moderation.Owner:
+		return RoleStyle.Render("~")
+	case moderation.Moderator:
+		return RoleStyle.Render("@")
+	}
+	return ""
+}
+
+// cmdModerate runs /kick, /ban, /unban, /op, /deop, /admit and /remove.
+func (m Model) cmdModerate(cmd, arg string) (tea.Model, tea.Cmd) {
+	if m.mod == nil || !m.mod.Owned() {
+		return m.Warn("⚠ " + moderation.ErrNotOwned.Error())
+	}
+
+	who, d := arg, moderation.DefaultKick
+	if cmd == "kick" {
+		if i := strings.LastIndex(arg, " "); i > 0 {
+			if v, err := time.ParseDuration(arg[i+1:]); err == nil && v > 0 {
+				who, d = strings.TrimSpace(arg[:i]), v
+			}
+		}
+	}
+	id, name, ok := m.resolvePeer(who, false)
+	if !ok {
+		return m.Warn(fmt.Sprintf("⚠ nobody called %q has been seen", who))
+	}
+	if name == "" {
+		name = "…" + shortPeer(id)
+	}
+
+	var (
+		err  error
+		done string
+	)
+	switch cmd {
+	case "kick":
+		err, done = m.mod.Kick(id, d), fmt.Sprintf("kicked %s for %s", name, d)
+	case "ban":
+		err, done = m.mod.Ban(id), "banned "+name
+	case "unban":
+		err, done = m.mod.Unban(id), "unbanned "+name
+	case "op":
+		err, done = m.mod.Grant(id), name+" is now a moderator"
+	case "deop":
+		err, done = m.mod.Revoke(id), name+" is no longer a moderator"
+	case "admit":
+		err, done = m.mod.Admit(id), name+" is now a member"
+	case "remove":
+		err, done = m.mod.Remove(id), name+" is no longer a member"
+	}
+	if err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+
+	m.resetInput()
+	m.dropSanctioned(m.room)
+	m.showWarning = true
+	m.warningMsg = "✓ " + done
+	return m, nil
+}
+
+// cmdTopic runs /topic <text>.
+func (m Model) cmdTopic(topic string) (tea.Model, tea.Cmd) {
+	if m.mod == nil || !m.mod.Owned() {
+		return m.Warn("⚠ " + moderation.ErrNotOwned.Error())
+	}
+	if err := m.mod.SetTopic(topic); err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+	m.resetInput()
+	m.showWarning = true
+	m.warningMsg = "✓ set the topic"
+	if topic == "" {
+		m.warningMsg = "✓ cleared the topic"
+	}
+	return m, nil
+}
+
+// cmdMods lists the room's owner, moderators, members, kicks and bans.
+func (m Model) cmdMods() (tea.Model, tea.Cmd) {
+	if m.mod == nil || !m.mod.Owned() {
+		return m.Warn("⚠ " + moderation.ErrNotOwned.Error())
+	}
+
+	st := m.mod.State()
+	var b strings.Builder
+	b.WriteString("\n")
+	if st.Topic != "" {
+		b.WriteString("  " + sanitizeLine(st.Topic) + "\n\n")
+	}
+	row := func(mark string, id peer.ID, note string) {
+		fmt.Fprintf(&b, "  %s %-24s %s  %s\n",
+			mark, m.peerName(id),
+			TimestampStyle.Render("…"+shortPeer(id)),
+			StatusStyle.Render(note))
+	}
+	row(RoleStyle.Render("~"), st.Owner, "owner")
+	for _, id := range st.Moderators {
+		row(RoleStyle.Render("@"), id, "moderator · /deop to remove")
+	}
+	for _, id := range st.Members {
+		row(" ", id, "member · /remove to remove")
+	}
+	for _, s := range st.Sanctions {
+		note := "banned · /unban to lift"
+		if !s.Until.IsZero() {
+			note = "kicked until " + s.Until.Format("15:04") + " · /unban to lift"
+		}
+		row(WarningStyle.Render("✗"), s.ID, note)
+	}
+
+	m.resetInput()
+	m.openOverlay("moderation of #"+moderation.DisplayName(st.Room), b.String())
+	return m, nil
+}
+
+// peerName is the last name we saw id use, or the tail of its ID.
+func (m Model) peerName(id peer.ID) string {
+	if id == m.chat.Self() {
+		return "you"
+	}
+	if m.trust != nil {
+		if rec, ok := m.trust.Get(id); ok && rec.Name != "" {
+			return sanitizeLine(rec.Name)
+		}
+	}
+	return "…" + shortPeer(id)
+}
@@ -0,0 +1,33 @@
+package ui
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// openOverlay shows content in a scrollable panel over the message list
+// until Esc is pressed.
+func (m *Model) openOverlay(title, content string) {
+	vp := viewport.New(m.viewport.Width, m.viewport.Height-1)
+	vp.SetContent(content)
+	m.overlay = &vp
+	m.overlayTitle = title
+}
+
+// updateOverlay handles keys while an overlay is open. Everything except
+// scrolling and Back is swallowed so typing can't leak into the input.
+func (m Model) updateOverlay(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if key.Matches(msg, m.keymap.Back, m.keymap.Quit) {
+		m.overlay = nil
+		return m, nil
+	}
+	vp, cmd := m.overlay.Update(msg)
+	m.overlay = &vp
+	return m, cmd
+}
+
+func (m Model) viewOverlay() string {
+	title := OverlayTitleStyle.Render(m.overlayTitle) + StatusStyle.Render("  "+m.keymap.Back.Help().Key+" to close")
+	return title + "\n" + m.overlay.View()
+}
@@ -0,0 +1,123 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/reflow/truncate"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/transfer"
+)
+
+const (
+	// maxInlineLines is the most lines a message can have before it is
+	// sent as a text attachment instead, like one over MaxMessageSize.
+	maxInlineLines = 12
+
+	// maxPasteSize caps what the input accepts at all.
+	maxPasteSize = 1 << 20
+
+	// maxPagerSize is how much of a text attachment the pager loads.
+	maxPagerSize = 4 << 20
+)
+
+// isLongPaste reports whether content is too big to send inline.
+func isLongPaste(content string) bool {
+	return len(content) > MaxMessageSize || strings.Count(content, "\n") >= maxInlineLines
+}
+
+// sendPaste turns oversize input into a text attachment, so it neither
+// hits the message size limit nor floods everyone's viewport.
+func (m Model) sendPaste(content string) (tea.Model, tea.Cmd) {
+	if m.files == nil {
+		return m.Warn(fmt.Sprintf("⚠ message too long (%d characters, max %d)", len(content), MaxMessageSize))
+	}
+
+	m.resetInput()
+	m.lastSent = time.Now()
+	files, c := m.files, m.chat
+	name := "paste-" + time.Now().Format("150405") + ".txt"
+	return m, func() tea.Msg {
+		att, err := files.ShareData(c, name, []byte(content))
+		return sharedMsg{att: att, err: err}
+	}
+}
+
+// hasPreview reports whether msg is a text attachment with a preview
+// block that can be expanded and paged.
+func hasPreview(msg chat.ChatMessage) bool {
+	return msg.Attachment != nil && msg.Attachment.Preview != ""
+}
+
+// openPager shows the selected text attachment in full. Files we don't
+// have yet are downloaded first and the pager opens when they arrive.
+func (m Model) openPager() (tea.Model, tea.Cmd) {
+	msg := m.timeline.At(m.selectedMsg)
+	if !hasPreview(msg) || m.files == nil {
+		return m, nil
+	}
+	att := *msg.Attachment
+
+	text, err := m.readAttachment(att.Hash)
+	if errors.Is(err, transfer.ErrNotShared) {
+		m.files.Download(context.Background(), m.chat, msg.From, att)
+		m.transfers[att.Hash] = transfer.Progress{Hash: att.Hash, Name: att.Name, Size: att.Size}
+		m.pagerWant = att.Hash
+		m.layoutMessages()
+		return m.Warn("⇣ fetching " + att.Name + ", it opens when done")
+	}
+	if err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+
+	m.openOverlay(att.Name, text)
+	return m, nil
+}
+
+// pagerReady opens the pager for a download the user was waiting on.
+func (m *Model) pagerReady(p transfer.Progress) {
+	if !p.Done || p.Hash != m.pagerWant {
+		return
+	}
+	m.pagerWant = ""
+	if p.Err != "" {
+		return
+	}
+	if text, err := m.readAttachment(p.Hash); err == nil {
+		m.openOverlay(p.Name, text)
+	}
+}
+
+func (m Model) readAttachment(hash string) (string, error) {
+	f, err := m.files.Open(hash)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, maxPagerSize))
+	if err != nil {
+		return "", err
+	}
+	return sanitize(strings.ToValidUTF8(string(b), "�")), nil
+}
+
+// renderPreview draws an expanded preview block under its message.
+func (m Model) renderPreview(att *chat.Attachment) string {
+	width := max(m.chatWidth()-8, 10)
+
+	var b strings.Builder
+	for _, line := range strings.Split(att.Preview, "\n") {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		line = truncate.StringWithTail(line, uint(width), "…")
+		b.WriteString("    " + DividerStyle.Render("│ ") + line + "\n")
+	}
+	b.WriteString("    " + DividerStyle.Render("└ ") + TimestampStyle.Render(m.keymap.Open.Help().Key+" to open in pager"))
+	return b.String()
+}
@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+)
+
+// groupGap is how long after a sender's last message their next one
+// still goes under the same header.
+const groupGap = 5 * time.Minute
+
+// renderedMsg is a message's markdown as glamour rendered it. Rendering is
+// by far the slowest part of drawing the messages, so it is kept until
+// the message is edited or the renderers change with the width or theme.
+type renderedMsg struct {
+	content string // the markdown rendered, to notice edits
+	compact string // first line, for the one-line view
+	full    string // all of it, indented, for the expanded view
+	hasFull bool
+}
+
+// renderedFor returns what has been rendered of content for message id,
+// forgetting it if the message has changed since.
+func (m Model) renderedFor(id, content string) *renderedMsg {
+	r := m.rendered[id]
+	if r == nil || r.content != content {
+		r = &renderedMsg{content: content}
+		if m.compactRenderer == nil {
+			r.compact = content
+		} else if out, err := m.compactRenderer.Render(content); err == nil {
+			r.compact = strings.TrimSpace(out)
+		} else {
+			r.compact = content
+		}
+		r.compact, _, _ = strings.Cut(r.compact, "\n")
+		m.rendered[id] = r
+	}
+	return r
+}
+
+// renderCompact returns the first line of content rendered as markdown.
+func (m Model) renderCompact(id, content string) string {
+	return m.renderedFor(id, content).compact
+}
+
+// renderFull returns content rendered as markdown, wrapped to the
+// viewport and indented 2 spaces.
+func (m Model) renderFull(id, content string) string {
+	r := m.renderedFor(id, content)
+	if r.hasFull {
+		return r.full
+	}
+	out := content
+	if m.renderer != nil {
+		if s, err := m.renderer.Render(content); err == nil {
+			out = s
+		}
+	}
+	// Glamour pads its output with blank lines
+	rows := strings.Split(strings.TrimSpace(out), "\n")
+	for i, row := range rows {
+		rows[i] = "  " + row
+	}
+	r.full, r.hasFull = strings.Join(rows, "\n"), true
+	return r.full
+}
+
+// layoutMessages works out which viewport line each message starts on
+// and sizes the viewport to match. The viewport only holds blank lines
+// to scroll through; viewMessages renders the messages on screen, so
+// the cost of a redraw doesn't grow with the history.
+func (m *Model) layoutMessages() {
+	if m.timeline.Len() == 0 {
+		m.lineStarts = nil
+		m.viewport.SetContent(StatusStyle.Render("\n  waiting for ghosts to appear... 👻\n"))
+		return
+	}
+
+	mark := m.roomMark()
+	starts := make([]int, 0, m.timeline.Len()+1)
+	line := 0
+	for i, msg := range m.timeline.Messages() {
+		starts = append(starts, line)
+		line += len(m.rowsAbove(i, msg, mark)) + m.messageHeight(i, msg)
+	}
+	m.lineStarts = append(starts, line)
+	// Each message ended in a newline, leaving a blank line at the end
+	m.viewport.SetContent(strings.Repeat("\n", line))
+}
+
+// messageHeight returns how many lines the i-th message takes up.
+// Folded messages are one line and need no rendering to know it. Like
+// rowsAbove, it is called for every message on each layout, so it takes
+// the model by pointer rather than copying it.
+func (m *Model) messageHeight(i int, msg chat.ChatMessage) int {
+	if msg.Hidden == 0 && (m.expanded[msg.ID] || (hasPreview(msg) && m.previews[msg.ID])) {
+		return strings.Count(m.renderMessage(i, msg), "\n") + 1
+	}
+	return 1
+}
+
+// viewMessages draws the lines of the timeline the viewport is
+// scrolled to, rendering just the messages that show there.
+func (m Model) viewMessages() string {
+	if m.timeline.Len() == 0 {
+		return m.viewport.View() // the empty room notice
+	}
+	if len(m.lineStarts) != m.timeline.Len()+1 {
+		m.layoutMessages() // not laid out since the timeline changed
+	}
+
+	top, height := m.viewport.YOffset, m.viewport.Height
+	mark := m.roomMark()
+	lines := make([]string, 0, height)
+	first := sort.Search(m.timeline.Len(), func(i int) bool { return m.lineStarts[i+1] > top })
+	for i := first; i < m.timeline.Len() && m.lineStarts[i] < top+height; i++ {
+		msg := m.timeline.At(i)
+		block := append(m.rowsAbove(i, msg, mark), strings.Split(m.renderMessage(i, msg), "\n")...)
+		lines = append(lines, block[min(max(top-m.lineStarts[i], 0), len(block)):]...)
+	}
+	lines = lines[:min(len(lines), height)]
+
+	return lipgloss.NewStyle().
+		Width(m.viewport.Width).
+		Height(height).
+		MaxHeight(height).
+		MaxWidth(m.viewport.Width).
+		Render(strings.Join(lines, "\n"))
+}
+
+// rowsAbove returns the dividers drawn above the i-th message: its date
+// if it's the first of a day, and the unread mark if it's the first not
+// yet seen.
+func (m *Model) rowsAbove(i int, msg chat.ChatMessage, mark string) []string {
+	var rows []string
+	if i == 0 || !m.clock.sameDay(m.timeline.At(i-1).Time(), msg.Time()) {
+		rows = append(rows, m.dividerRow(TimestampStyle.Render(" "+m.clock.Day(msg.Time(), m.now)+" ")))
+	}
+	if msg.ID == mark && i > 0 {
+		rows = append(rows, m.renderMark())
+	}
+	return rows
+}
+
+// dividerRow draws a divider across the messages with label centered.
+func (m Model) dividerRow(label string) string {
+	side := max(m.chatWidth()-lipgloss.Width(label)-4, 0)
+	return "  " + DividerStyle.Render(strings.Repeat("─", side/2)) + label +
+		DividerStyle.Render(strings.Repeat("─", side-side/2))
+}
+
+// continues reports whether the i-th message follows on from the one
+// before, sent by the same peer the same day and shortly after, so it
+// shares that one's header.
+func (m Model) continues(i int, msg chat.ChatMessage) bool {
+	if i == 0 || msg.Hidden > 0 || msg.ID == m.roomMark() {
+		return false
+	}
+	prev := m.timeline.At(i - 1)
+	if prev.Hidden > 0 || prev.Sender != msg.Sender || prev.From != msg.From {
+		return false
+	}
+	gap := msg.Time().Sub(prev.Time())
+	return gap >= 0 && gap < groupGap && m.clock.sameDay(prev.Time(), msg.Time())
+}
+
+// roomMark returns the ID of the first message the user hasn't seen in
+// the room on screen, if any.
+func (m Model) roomMark() string {
+	if m.room == nil {
+		return ""
+	}
+	return m.marks[m.room.Name]
+}
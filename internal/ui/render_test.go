@@ -0,0 +1,82 @@
+package ui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+)
+
+// benchSizes are the timeline lengths the rendering benchmarks run at.
+var benchSizes = []int{100, 1000, 10000}
+
+// benchModel returns a chat screen holding n messages from a few
+// peers, a minute apart so they span several days.
+func benchModel(b *testing.B, n int) Model {
+	b.Helper()
+	m := NewModel("me", nil, "", Services{})
+	m.chat = chat.NewChat(nil, nil, peer.ID("me"))
+	model, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	m = model.(Model)
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i := range n {
+		m.timeline.Insert(benchMessage(i, start))
+	}
+	m.now = start.Add(time.Duration(n) * time.Minute)
+	m.layoutMessages()
+	m.viewport.GotoBottom()
+	return m
+}
+
+func benchMessage(i int, start time.Time) chat.ChatMessage {
+	msg := chat.NewChatMessage(fmt.Sprintf("ghost%d", i%3),
+		fmt.Sprintf("message **%d** with some `code` and a [link](https://example.com)", i),
+		chat.HLC{Wall: start.Add(time.Duration(i) * time.Minute).UnixMilli()})
+	msg.From = peer.ID(fmt.Sprintf("peer%d", i%3))
+	return msg
+}
+
+func BenchmarkLayoutMessages(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			m := benchModel(b, n)
+			for b.Loop() {
+				m.layoutMessages()
+			}
+		})
+	}
+}
+
+func BenchmarkViewMessages(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			m := benchModel(b, n)
+			m.viewMessages() // render what's on screen once, as a redraw would find it
+			for b.Loop() {
+				m.viewMessages()
+			}
+		})
+	}
+}
+
+// BenchmarkIncoming is a message arriving in the room on screen: it is
+// inserted, the timeline laid out again and the bottom drawn.
+func BenchmarkIncoming(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			m := benchModel(b, n)
+			start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+			i := n
+			for b.Loop() {
+				m.showIncoming(benchMessage(i, start))
+				m.viewMessages()
+				i++
+			}
+		})
+	}
+}
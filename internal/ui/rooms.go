@@ -0,0 +1,231 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/invite"
+	"github.com/ekrishgupta/Hush/internal/moderation"
+	"github.com/ekrishgupta/Hush/internal/rooms"
+	"github.com/ekrishgupta/Hush/internal/wire"
+)
+
+// joinedMsg reports the result of /join.
+type joinedMsg struct {
+	room *rooms.Room
+	err  error
+}
+
+// listen returns the commands that wait on everything r reports. They
+// stop once the room is left.
+func (m Model) listen(r *rooms.Room) tea.Cmd {
+	cmds := []tea.Cmd{waitForMsg(r), waitForErr(r), waitForModeration(r)}
+	if r.Alerts != nil {
+		cmds = append(cmds, waitForAlert(r))
+	}
+	return tea.Batch(cmds...)
+}
+
+// waitForMsg returns a command that waits for the next message in r.
+func waitForMsg(r *rooms.Room) tea.Cmd {
+	return func() tea.Msg {
+		for ev := range r.Events() {
+			if ev.Kind == wire.KindChat {
+				return IncomingMsg{Room: r.Name, ChatMessage: ev.Message}
+			}
+		}
+		return nil
+	}
+}
+
+// waitForErr returns a command that waits for the next error in r.
+func waitForErr(r *rooms.Room) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case err := <-r.Chat.Errors():
+			return chatErrMsg{room: r.Name, err: err}
+		case <-r.Done():
+			return nil
+		}
+	}
+}
+
+// joinedRoom returns the joined room called name, or nil if we aren't
+// in it (any more).
+func (m Model) joinedRoom(name string) *rooms.Room {
+	for _, r := range m.joined {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// unreadElsewhere counts unread messages in rooms other than this one.
+func (m Model) unreadElsewhere() int {
+	n := 0
+	for name, count := range m.unread {
+		if m.room == nil || name != m.room.Name {
+			n += count
+		}
+	}
+	return n
+}
+
+// roomIndex returns the position of the current room in the sidebar.
+func (m Model) roomIndex() int {
+	return slices.IndexFunc(m.joined, func(r *rooms.Room) bool { return r == m.room })
+}
+
+// enter shows r, remembering it as the room to open next time.
+func (m *Model) enter(r *rooms.Room) {
+	if m.room != nil && m.room != r {
+		// Whatever was new there has been seen now
+		delete(m.marks, m.room.Name)
+	}
+	m.room = r
+	m.chat, m.mod, m.keys = r.Chat, r.Mod, r.Keys
+	m.timeline = m.timelines[r.Name]
+	m.unread[r.Name] = 0
+	m.peerCount = r.Chat.PeerCount()
+	m.pendingCount = r.Chat.PendingCount()
+	m.keyEpoch = 0
+	if r.Keys != nil {
+		m.keyEpoch = r.Keys.Epoch()
+	}
+
+	m.selectedMsg = -1
+	m.menu = false
+	m.overlay = nil
+	m.layoutMessages()
+	m.gotoBottom()
+
+	// Best effort: at worst the next start opens a different room
+	_ = m.rooms.Focus(r.Name)
+}
+
+// switchRoom moves to the room by places along the sidebar, wrapping
+// around at the ends.
+func (m Model) switchRoom(by int) (tea.Model, tea.Cmd) {
+	n := len(m.joined)
+	if n < 2 {
+		return m, nil
+	}
+	m.enter(m.joined[((m.roomIndex()+by)%n+n)%n])
+	return m, nil
+}
+
+// selectRoom moves to the i'th room in the sidebar, counting from 0.
+func (m Model) selectRoom(i int) (tea.Model, tea.Cmd) {
+	if i < 0 || i >= len(m.joined) {
+		return m, nil
+	}
+	m.enter(m.joined[i])
+	return m, nil
+}
+
+// addRoom starts showing a room we just joined.
+func (m *Model) addRoom(r *rooms.Room) tea.Cmd {
+	if _, ok := m.timelines[r.Name]; ok {
+		return nil // already in it
+	}
+	m.joined = append(m.joined, r)
+	m.timelines[r.Name] = chat.NewTimeline()
+	if m.username != "" {
+		r.Chat.SetName(m.username)
+	}
+	return m.listen(r)
+}
+
+// cmdJoin runs /join <room> and /join <invite code>. Redeeming an
+// invite dials its issuer, so joining happens in a command.
+func (m Model) cmdJoin(arg string) (tea.Model, tea.Cmd) {
+	if m.rooms == nil {
+		return m.Warn("⚠ rooms are unavailable")
+	}
+
+	// An invite code may have been wrapped across lines when copied
+	code := strings.Join(strings.Fields(arg), "")
+	inv, err := invite.Parse(code)
+	if err != nil && strings.HasPrefix(code, "HUSH:") {
+		return m.Warn("⚠ " + err.Error())
+	}
+	if err != nil {
+		name := strings.TrimPrefix(arg, "#")
+		if strings.ContainsAny(name, " \t") || len(name) > invite.MaxRoomName {
+			return m.Warn(fmt.Sprintf("⚠ room names are up to %d characters, without spaces", invite.MaxRoomName))
+		}
+		inv = invite.Invite{Room: name}
+	}
+	if r, ok := m.rooms.Get(inv.Room); ok {
+		m.resetInput()
+		m.enter(r)
+		return m, nil
+	}
+
+	m.resetInput()
+	m.showWarning = true
+	m.warningMsg = "⇢ joining #" + moderation.DisplayName(inv.Room)
+	rm, invites, redeem := m.rooms, m.invites, err == nil
+	return m, func() tea.Msg {
+		ctx := context.Background()
+		if redeem && invites != nil {
+			if err := invites.Join(ctx, inv); err != nil {
+				return joinedMsg{err: err}
+			}
+			if err := rm.Update(inv.Apply); err != nil {
+				return joinedMsg{err: err}
+			}
+		}
+		r, err := rm.Join(ctx, inv.Room)
+		return joinedMsg{room: r, err: err}
+	}
+}
+
+// handleJoined switches to a room /join got us into. The room may be
+// joined even with an error, if only saving the room list failed.
+func (m Model) handleJoined(msg joinedMsg) (tea.Model, tea.Cmd) {
+	if msg.room == nil {
+		return m.Warn("⚠ " + msg.err.Error())
+	}
+	cmd := m.addRoom(msg.room)
+	m.enter(msg.room)
+	m.showWarning = true
+	m.warningMsg = "✓ joined #" + moderation.DisplayName(msg.room.Name)
+	if msg.err != nil {
+		m.warningMsg = "⚠ " + msg.err.Error()
+	}
+	return m, cmd
+}
+
+// cmdLeave runs /leave, moving to the next room in the sidebar.
+func (m Model) cmdLeave() (tea.Model, tea.Cmd) {
+	if m.rooms == nil {
+		return m.Warn("⚠ rooms are unavailable")
+	}
+	left := m.room
+	err := m.rooms.Leave(left.Name)
+	if _, still := m.rooms.Get(left.Name); still {
+		return m.Warn("⚠ " + err.Error())
+	}
+
+	i := m.roomIndex()
+	m.joined = slices.Delete(m.joined, i, i+1)
+	delete(m.timelines, left.Name)
+	delete(m.unread, left.Name)
+	delete(m.marks, left.Name)
+	m.enter(m.joined[min(i, len(m.joined)-1)])
+
+	m.resetInput()
+	m.showWarning = true
+	m.warningMsg = "✓ left #" + moderation.DisplayName(left.Name)
+	if err != nil {
+		m.warningMsg = "⚠ " + err.Error()
+	}
+	return m, nil
+}
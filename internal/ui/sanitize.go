@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+)
+
+// Introducers of terminal control sequences, as 7-bit ESC forms and
+// their single-rune C1 equivalents.
+const (
+	esc   = 0x1b
+	c1DCS = 0x90
+	c1SOS = 0x98
+	c1CSI = 0x9b
+	c1ST  = 0x9c
+	c1OSC = 0x9d
+	c1PM  = 0x9e
+	c1APC = 0x9f
+)
+
+// sanitize strips terminal escape sequences and other control characters
+// from text a peer sent us, keeping newlines and tabs. A peer could
+// otherwise move the cursor and redraw the screen, retitle the window or
+// write to the clipboard with OSC 52. What is left is plain text, so the
+// only escapes that reach the terminal are the ones our own styling and
+// glamour add.
+func sanitize(s string) string {
+	// Invalid UTF-8 decodes as U+FFFD, so raw 8-bit C1 bytes would get
+	// past the checks below and reach the terminal as they are
+	s = strings.ToValidUTF8(s, "")
+	if clean(s) {
+		return s
+	}
+
+	rs := []rune(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(rs); i++ {
+		switch r := rs[i]; {
+		case r == esc:
+			i = skipEscape(rs, i)
+		case r == c1CSI:
+			i = skipCSI(rs, i+1)
+		case r == c1OSC || r == c1DCS || r == c1SOS || r == c1PM || r == c1APC:
+			i = skipString(rs, i+1)
+		case r == '\n' || r == '\t':
+			b.WriteRune(r)
+		case unicode.IsControl(r):
+			// Other C0 and C1 controls, DEL, and a bare \r that could
+			// overwrite the start of the line
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// sanitizeLine is sanitize for names and other one-line labels: line
+// breaks and tabs become spaces too.
+func sanitizeLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, sanitize(s))
+}
+
+// sanitizeMessage cleans every peer-supplied field of a message before
+// it is stored or rendered.
+func sanitizeMessage(msg chat.ChatMessage) chat.ChatMessage {
+	msg.Sender = sanitizeLine(msg.Sender)
+	msg.Content = sanitize(msg.Content)
+	if msg.Attachment != nil {
+		att := *msg.Attachment // shared with other subscribers
+		att.Name = sanitizeLine(att.Name)
+		att.Mime = sanitizeLine(att.Mime)
+		att.Preview = sanitize(att.Preview)
+		msg.Attachment = &att
+	}
+	return msg
+}
+
+// clean reports whether s has nothing for sanitize to remove, which is
+// almost always the case.
+func clean(s string) bool {
+	for _, r := range s {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// skipEscape skips the sequence starting with the ESC at rs[i] and
+// returns the index of its last rune.
+func skipEscape(rs []rune, i int) int {
+	if i+1 >= len(rs) {
+		return i
+	}
+	switch rs[i+1] {
+	case '[':
+		return skipCSI(rs, i+2)
+	case ']', 'P', 'X', '^', '_':
+		return skipString(rs, i+2)
+	}
+
+	// Anything else is ESC, optional intermediates, then one final
+	// character, e.g. ESC c (reset) or ESC ( 0 (switch character set).
+	j := i + 1
+	for j < len(rs) && rs[j] >= 0x20 && rs[j] <= 0x2f {
+		j++
+	}
+	if j < len(rs) && rs[j] == esc {
+		return j - 1 // a doubled ESC; the second one starts the real sequence
+	}
+	return min(j, len(rs)-1)
+}
+
+// skipCSI skips the parameters and final byte of a control sequence
+// whose introducer ends just before rs[j].
+func skipCSI(rs []rune, j int) int {
+	for ; j < len(rs); j++ {
+		switch r := rs[j]; {
+		case r >= 0x40 && r <= 0x7e:
+			return j // final byte
+		case r < 0x20 || r > 0x3f:
+			return j - 1 // malformed; let the caller look at r
+		}
+	}
+	return len(rs) - 1
+}
+
+// skipString skips an OSC, DCS, SOS, PM or APC string up to and
+// including its terminator: BEL, ST or ESC \. An unterminated string
+// runs to the end, as it would on a terminal.
+func skipString(rs []rune, j int) int {
+	for ; j < len(rs); j++ {
+		switch rs[j] {
+		case 0x07, c1ST:
+			return j
+		case esc:
+			if j+1 < len(rs) && rs[j+1] == '\\' {
+				return j + 1
+			}
+			return j - 1 // ESC cancels the string and starts something new
+		}
+	}
+	return len(rs) - 1
+}
@@ -0,0 +1,88 @@
+package ui
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "hello, world", want: "hello, world"},
+		{name: "newlines and tabs kept", in: "a\n\tb", want: "a\n\tb"},
+		{name: "unicode kept", in: "héllo 👋 ─", want: "héllo 👋 ─"},
+
+		// CSI
+		{name: "clear screen", in: "a\x1b[2Jb", want: "ab"},
+		{name: "cursor home and clear", in: "\x1b[H\x1b[2Jgotcha", want: "gotcha"},
+		{name: "colour", in: "\x1b[31mred\x1b[0m", want: "red"},
+		{name: "private mode", in: "a\x1b[?1049hb", want: "ab"},
+		{name: "C1 CSI", in: "a\u009b2Jb", want: "ab"},
+		{name: "malformed CSI", in: "a\x1b[1\nb", want: "a\nb"},
+
+		// OSC
+		{name: "OSC 0 title, BEL", in: "a\x1b]0;owned\x07b", want: "ab"},
+		{name: "OSC 0 title, ST", in: "a\x1b]0;owned\x1b\\b", want: "ab"},
+		{name: "OSC 8 hyperlink", in: "\x1b]8;;https://evil.example\x1b\\click\x1b]8;;\x1b\\", want: "click"},
+		{name: "OSC 52 clipboard", in: "a\x1b]52;c;cm0gLXJmIH4=\x07b", want: "ab"},
+		{name: "C1 OSC with C1 ST", in: "a\u009d0;owned\u009cb", want: "ab"},
+		{name: "raw 8-bit CSI", in: "a\x9b31mRED\x9b0m b", want: "a31mRED0m b"},
+		{name: "raw 8-bit OSC", in: "a\x9d0;owned\x07b", want: "a0;ownedb"},
+		{name: "raw 8-bit ST", in: "a\x9cb", want: "ab"},
+		{name: "invalid UTF-8", in: "a\xff\xfeb", want: "ab"},
+
+		// DCS and the other strings
+		{name: "DCS", in: "a\x1bP1$r0m\x1b\\b", want: "ab"},
+		{name: "C1 DCS", in: "a\u0090q#0;2;0;0;0\u009cb", want: "ab"},
+		{name: "APC", in: "a\x1b_Gf=100;AAAA\x1b\\b", want: "ab"},
+		{name: "PM", in: "a\x1b^secret\x07b", want: "ab"},
+		{name: "SOS", in: "a\x1bXsecret\x07b", want: "ab"},
+
+		// Other escapes
+		{name: "reset", in: "a\x1bcb", want: "ab"},
+		{name: "character set", in: "a\x1b(0b", want: "ab"},
+		{name: "doubled ESC", in: "a\x1b\x1b[2Jb", want: "ab"},
+
+		// Lone controls
+		{name: "bare CR", in: "safe\rEVIL", want: "safeEVIL"},
+		{name: "CRLF", in: "a\r\nb", want: "a\nb"},
+		{name: "BEL", in: "ding\x07", want: "ding"},
+		{name: "backspace", in: "ab\bc", want: "abc"},
+		{name: "DEL", in: "a\x7fb", want: "ab"},
+		{name: "NEL", in: "a\u0085b", want: "ab"},
+		{name: "C1 ST on its own", in: "a\u009cb", want: "ab"},
+
+		// Unterminated sequences run to the end, as on a terminal
+		{name: "trailing ESC", in: "abc\x1b", want: "abc"},
+		{name: "unterminated CSI", in: "abc\x1b[12;", want: "abc"},
+		{name: "unterminated OSC", in: "abc\x1b]0;title", want: "abc"},
+		{name: "unterminated OSC 52", in: "abc\x1b]52;c;cm0gLXJm", want: "abc"},
+		{name: "unterminated DCS", in: "abc\x1bPdata", want: "abc"},
+		{name: "OSC cut short by ESC", in: "a\x1b]0;title\x1b[2Jb", want: "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitize(tt.in); got != tt.want {
+				t.Errorf("sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "ann", want: "ann"},
+		{in: "ann\nadmin", want: "ann admin"},
+		{in: "ann\tbob", want: "ann bob"},
+		{in: "ann\x1b[2K\rroot", want: "annroot"},
+		{in: "\x1b]0;x\x07ann", want: "ann"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeLine(tt.in); got != tt.want {
+			t.Errorf("sanitizeLine(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
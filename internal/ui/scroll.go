@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/ekrishgupta/Hush/internal/chat"
+)
+
+// showIncoming adds a message that arrived in the room on screen and
+// reports whether it was new. The view only follows it down if it was
+// already at the bottom; otherwise it stays where the user scrolled to
+// and counts the message as new.
+func (m *Model) showIncoming(msg chat.ChatMessage) bool {
+	atBottom := m.viewport.AtBottom()
+	if m.timeline.Replace(msg, m.chat.Self()) {
+		m.layoutMessages()
+		return false
+	}
+	if !m.insertMessage(msg) {
+		return false
+	}
+	if !atBottom && !m.isOwn(msg) {
+		if m.newBelow == 0 {
+			m.marks[m.room.Name] = msg.ID // first since scrolling up
+		}
+		m.newBelow++
+	}
+	m.layoutMessages()
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+	return true
+}
+
+// markUnread remembers id as the first message in room the user hasn't
+// seen since leaving it, unless there already is one.
+func (m *Model) markUnread(room, id string) {
+	if _, ok := m.marks[room]; !ok {
+		m.marks[room] = id
+	}
+}
+
+// gotoBottom scrolls to the newest message.
+func (m *Model) gotoBottom() {
+	m.viewport.GotoBottom()
+	m.newBelow = 0
+}
+
+// jumpToBottom deselects any message and scrolls to the newest one.
+func (m Model) jumpToBottom() (tea.Model, tea.Cmd) {
+	m.selectedMsg = -1
+	m.gotoBottom()
+	return m, nil
+}
+
+// renderMark draws the line above the first message that arrived while
+// the user was in another room or scrolled up.
+func (m Model) renderMark() string {
+	return m.dividerRow(UnreadStyle.Render(" new since you left "))
+}
+
+// viewBottomDivider draws the line under the messages, saying how many
+// new ones there are below when scrolled up.
+func (m Model) viewBottomDivider() string {
+	if m.newBelow == 0 || m.overlay != nil {
+		return Divider(m.width)
+	}
+	label := fmt.Sprintf(" ↓ %d new message", m.newBelow)
+	if m.newBelow > 1 {
+		label += "s"
+	}
+	label = UnreadStyle.Render(label+" ") + TimestampStyle.Render(m.keymap.Bottom.Help().Key+" to jump ")
+	return DividerStyle.Render("──") + label + Divider(max(m.width-2-lipgloss.Width(label), 0))
+}
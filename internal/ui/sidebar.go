@@ -0,0 +1,211 @@
+package ui
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/muesli/reflow/truncate"
+
+	"github.com/ekrishgupta/Hush/internal/moderation"
+)
+
+const (
+	// roomsWidth and peersWidth are the columns each sidebar takes,
+	// including its border.
+	roomsWidth = 22
+	peersWidth = 24
+
+	// minChatWidth is the narrowest the messages get before sidebars
+	// fold away to make space.
+	minChatWidth = 40
+)
+
+// sidebarWidths returns the columns taken by the open sidebars. The
+// peer list folds away first when the terminal is too narrow.
+func (m Model) sidebarWidths() (left, right int) {
+	if m.showRooms {
+		left = roomsWidth
+	}
+	if m.showPeers {
+		right = peersWidth
+	}
+	if m.width-left-right < minChatWidth {
+		right = 0
+	}
+	if m.width-left < minChatWidth {
+		left = 0
+	}
+	return left, right
+}
+
+// chatWidth is the width left for the messages between the sidebars.
+func (m Model) chatWidth() int {
+	left, right := m.sidebarWidths()
+	return m.width - left - right
+}
+
+// handleSidebarKey toggles the sidebars and switches rooms, by default:
+//
+//	ctrl+r       rooms sidebar
+//	ctrl+o       online peers sidebar
+//	alt+↑ / ↓    previous / next room
+//	alt+1 … 9    room by its number in the sidebar
+//
+// ok is false for any other key.
+func (m Model) handleSidebarKey(msg tea.KeyMsg) (_ tea.Model, _ tea.Cmd, ok bool) {
+	switch {
+	case key.Matches(msg, m.keymap.ToggleRooms):
+		m.showRooms = !m.showRooms
+		return m, m.resize(), true
+	case key.Matches(msg, m.keymap.TogglePeers):
+		m.showPeers = !m.showPeers
+		return m, m.resize(), true
+	case key.Matches(msg, m.keymap.PrevRoom):
+		next, cmd := m.switchRoom(-1)
+		return next, cmd, true
+	case key.Matches(msg, m.keymap.NextRoom):
+		next, cmd := m.switchRoom(1)
+		return next, cmd, true
+	case key.Matches(msg, m.keymap.GoToRoom):
+		next, cmd := m.selectRoom(slices.Index(m.keymap.GoToRoom.Keys(), msg.String()))
+		return next, cmd, true
+	}
+	return m, nil, false
+}
+
+// resize lays the screen out again at its current size, e.g. after a
+// sidebar opens or closes.
+func (m Model) resize() tea.Cmd {
+	if m.width == 0 {
+		return nil
+	}
+	w, h := m.width, m.height
+	return func() tea.Msg {
+		return tea.WindowSizeMsg{Width: w, Height: h}
+	}
+}
+
+// viewSidebars puts the open sidebars either side of middle, which is
+// height lines tall.
+func (m Model) viewSidebars(middle string, height int) string {
+	left, right := m.sidebarWidths()
+	if left == 0 && right == 0 {
+		return middle
+	}
+	parts := []string{}
+	if left > 0 {
+		parts = append(parts, SidebarStyle.BorderRight(true).
+			Width(left-1).Height(height).MaxHeight(height).
+			Render(m.viewRooms(left-2)))
+	}
+	parts = append(parts, lipgloss.NewStyle().Width(m.chatWidth()).Render(middle))
+	if right > 0 {
+		parts = append(parts, SidebarStyle.BorderLeft(true).
+			Width(right-1).Height(height).MaxHeight(height).
+			Render(m.viewPeers(right-2)))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, parts...)
+}
+
+// viewRooms lists the joined rooms with their unread counts, numbered
+// for GoToRoom.
+func (m Model) viewRooms(width int) string {
+	var b strings.Builder
+	b.WriteString(SidebarTitleStyle.Render("rooms") + "\n")
+	for i, r := range m.joined {
+		num := "  "
+		if i < min(len(m.keymap.GoToRoom.Keys()), 9) {
+			num = fmt.Sprintf("%d ", i+1)
+		}
+		name := "#" + moderation.DisplayName(r.Name)
+		if r.Keys != nil {
+			name = "🔒" + name
+		}
+		var count string
+		if n := m.unread[r.Name]; n > 0 {
+			count = " " + UnreadStyle.Render(fmt.Sprint(min(n, 999)))
+		}
+		name = truncate.StringWithTail(sanitizeLine(name), uint(max(width-4-lipgloss.Width(count), 1)), "…")
+
+		line := "  " + TimestampStyle.Render(num) + name
+		if r == m.room {
+			line = RoleStyle.Render("▸ ") + TimestampStyle.Render(num) + SidebarActiveStyle.Render(name)
+		}
+		pad := max(width-lipgloss.Width(line)-lipgloss.Width(count), 0)
+		b.WriteString(line + strings.Repeat(" ", pad) + count + "\n")
+	}
+	b.WriteString("\n" + TimestampStyle.Render(m.keymap.PrevRoom.Help().Key+" "+m.keymap.NextRoom.Help().Key+" switch"))
+	return b.String()
+}
+
+// viewPeers lists who is online in the current room: their role, and
+// whether they are verified, suspect or muted.
+func (m Model) viewPeers(width int) string {
+	if m.chat == nil {
+		return ""
+	}
+	ids := m.chat.Peers()
+	names := make(map[peer.ID]string, len(ids))
+	for _, id := range ids {
+		names[id] = m.rosterName(id)
+	}
+	// Owner first, then moderators, then everyone by name
+	slices.SortFunc(ids, func(a, b peer.ID) int {
+		if m.mod != nil {
+			if c := cmp.Compare(m.mod.Role(b), m.mod.Role(a)); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(strings.ToLower(names[a]), strings.ToLower(names[b]))
+	})
+
+	var b strings.Builder
+	b.WriteString(SidebarTitleStyle.Render(fmt.Sprintf("online (%d)", len(ids))) + "\n")
+	b.WriteString(m.rosterLine(m.chat.Self(), m.username+" (you)", width) + "\n")
+	for _, id := range ids {
+		b.WriteString(m.rosterLine(id, names[id], width) + "\n")
+	}
+	return b.String()
+}
+
+// rosterName is the name id uses in this room, falling back to the one
+// we last saw it use anywhere.
+func (m Model) rosterName(id peer.ID) string {
+	if name, ok := m.chat.PeerName(id); ok && name != "" {
+		return sanitizeLine(name)
+	}
+	return m.peerName(id)
+}
+
+// rosterLine renders one peer in the peer list.
+func (m Model) rosterLine(id peer.ID, name string, width int) string {
+	mark := " "
+	switch {
+	case m.suspect[id]:
+		mark = WarningStyle.Render("⚠")
+	case m.trust != nil && m.trust.Verified(id):
+		mark = VerifiedStyle.Render("✓")
+	}
+	badge := m.roleBadge(id)
+	if badge == "" {
+		badge = " "
+	}
+	muted := m.blocks != nil && m.blocks.Muted(id)
+
+	name = truncate.StringWithTail(name, uint(max(width-4, 1)), "…")
+	switch {
+	case muted:
+		name = HiddenStyle.Render(name)
+	case id == m.chat.Self():
+		name = SelfMsgSender.Render(name)
+	default:
+		name = PeerMsgSender.Render(name)
+	}
+	return mark + badge + " " + name
+}
@@ -2,73 +2,151 @@ package ui
 
 import (
 	"github.com/charmbracelet/lipgloss"
+
+	"github.com/ekrishgupta/Hush/internal/theme"
+)
+
+var (
+	// Colors — Adaptive for Light/Dark terminal backgrounds, until a
+	// theme replaces them
+	ghostPurple lipgloss.TerminalColor = lipgloss.AdaptiveColor{Light: "#6200EA", Dark: "#B388FF"}
+	ghostPink   lipgloss.TerminalColor = lipgloss.AdaptiveColor{Light: "#C51162", Dark: "#FF80AB"}
+	softGreen   lipgloss.TerminalColor = lipgloss.AdaptiveColor{Light: "#00C853", Dark: "#69F0AE"}
+	warmWhite   lipgloss.TerminalColor = lipgloss.AdaptiveColor{Light: "#1A1A1A", Dark: "#F5F5F5"}
+	dimGray     lipgloss.TerminalColor = lipgloss.AdaptiveColor{Light: "#9E9E9E", Dark: "#666666"}
+	warningRed  lipgloss.TerminalColor = lipgloss.AdaptiveColor{Light: "#D50000", Dark: "#FF5252"}
+	selectionBg lipgloss.TerminalColor = lipgloss.AdaptiveColor{Light: "#E0E0E0", Dark: "#333333"}
 )
 
+// The styles, built from the colors by buildStyles.
 var (
-	// Colors — Adaptive for Light/Dark terminal backgrounds
-	ghostPurple = lipgloss.AdaptiveColor{Light: "#6200EA", Dark: "#B388FF"}
-	ghostPink   = lipgloss.AdaptiveColor{Light: "#C51162", Dark: "#FF80AB"}
-	softGreen   = lipgloss.AdaptiveColor{Light: "#00C853", Dark: "#69F0AE"}
-	warmWhite   = lipgloss.AdaptiveColor{Light: "#1A1A1A", Dark: "#F5F5F5"}
-	dimGray     = lipgloss.AdaptiveColor{Light: "#9E9E9E", Dark: "#666666"}
-	warningRed  = lipgloss.AdaptiveColor{Light: "#D50000", Dark: "#FF5252"}
+	HeaderStyle, StatusStyle, PeerMsgSender, PeerMsgContent,
+	SelfMsgSender, SelfMsgContent, TimestampStyle, SkewStyle,
+	VerifiedStyle, RoleStyle, HiddenStyle, WarningStyle,
+	InputBorderStyle, InputBorderWarnStyle, DividerStyle, OverlayTitleStyle,
+	SidebarStyle, SidebarTitleStyle, SidebarActiveStyle, UnreadStyle, SelectedMsgStyle,
+	MentionStyle lipgloss.Style
+)
+
+func init() {
+	buildStyles()
+}
 
+// useTheme switches every style to t's colors.
+func useTheme(t *theme.Theme) {
+	c := t.Colors
+	ghostPurple, ghostPink, softGreen = lipgloss.Color(c.Accent), lipgloss.Color(c.Highlight), lipgloss.Color(c.Self)
+	warmWhite, dimGray, warningRed = lipgloss.Color(c.Text), lipgloss.Color(c.Muted), lipgloss.Color(c.Warning)
+	selectionBg = lipgloss.Color(c.Selection)
+	buildStyles()
+}
+
+// buildStyles creates the styles from the current colors.
+func buildStyles() {
 	// Header — the "Hush" banner
 	HeaderStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(ghostPurple).
-			Padding(0, 1)
+		Bold(true).
+		Foreground(ghostPurple).
+		Padding(0, 1)
 
 	// Status bar below header
 	StatusStyle = lipgloss.NewStyle().
-			Foreground(dimGray).
-			Italic(true).
-			Padding(0, 1)
+		Foreground(dimGray).
+		Italic(true).
+		Padding(0, 1)
 
 	// Messages from other peers
 	PeerMsgSender = lipgloss.NewStyle().
-			Foreground(ghostPink).
-			Bold(true)
+		Foreground(ghostPink).
+		Bold(true)
 
 	PeerMsgContent = lipgloss.NewStyle().
-			Foreground(warmWhite)
+		Foreground(warmWhite)
 
 	// Messages from self
 	SelfMsgSender = lipgloss.NewStyle().
-			Foreground(softGreen).
-			Bold(true)
+		Foreground(softGreen).
+		Bold(true)
 
 	SelfMsgContent = lipgloss.NewStyle().
-			Foreground(warmWhite)
+		Foreground(warmWhite)
 
 	// Timestamp
 	TimestampStyle = lipgloss.NewStyle().
-			Foreground(dimGray)
+		Foreground(dimGray)
+
+	// Marker for messages from peers with badly skewed clocks
+	SkewStyle = lipgloss.NewStyle().
+		Foreground(warningRed)
+
+	// Check mark after verified senders
+	VerifiedStyle = lipgloss.NewStyle().
+		Foreground(softGreen)
+
+	// Owner and moderator marks before senders
+	RoleStyle = lipgloss.NewStyle().
+		Foreground(ghostPurple).
+		Bold(true)
+
+	// Placeholder for messages hidden from a flooding peer
+	HiddenStyle = lipgloss.NewStyle().
+		Foreground(dimGray).
+		Italic(true)
 
 	// Warning text for anti-spam
 	WarningStyle = lipgloss.NewStyle().
-			Foreground(warningRed).
-			Bold(true)
+		Foreground(warningRed).
+		Bold(true)
 
 	// Input area border
 	InputBorderStyle = lipgloss.NewStyle().
-				Border(lipgloss.RoundedBorder()).
-				BorderForeground(ghostPurple).
-				Padding(0, 1)
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ghostPurple).
+		Padding(0, 1)
 
 	InputBorderWarnStyle = lipgloss.NewStyle().
-				Border(lipgloss.RoundedBorder()).
-				BorderForeground(warningRed).
-				Padding(0, 1)
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(warningRed).
+		Padding(0, 1)
 
 	// Divider line
 	DividerStyle = lipgloss.NewStyle().
-			Foreground(dimGray)
+		Foreground(dimGray)
+
+	// Title bar of overlays such as /attachments
+	OverlayTitleStyle = lipgloss.NewStyle().
+		Foreground(ghostPurple).
+		Bold(true).
+		Padding(0, 1)
+
+	// Sidebars listing rooms and who is online
+	SidebarStyle = lipgloss.NewStyle().
+		Border(lipgloss.NormalBorder(), false).
+		BorderForeground(dimGray).
+		PaddingLeft(1)
+
+	SidebarTitleStyle = lipgloss.NewStyle().
+		Foreground(dimGray).
+		Bold(true)
+
+	SidebarActiveStyle = lipgloss.NewStyle().
+		Foreground(ghostPurple).
+		Bold(true)
+
+	// Count of unread messages in another room
+	UnreadStyle = lipgloss.NewStyle().
+		Foreground(ghostPink).
+		Bold(true)
+
+	// Marks messages that mention us
+	MentionStyle = lipgloss.NewStyle().
+		Foreground(warningRed).
+		Bold(true)
 
 	// Selected message highlight
 	SelectedMsgStyle = lipgloss.NewStyle().
-				Background(lipgloss.AdaptiveColor{Light: "#E0E0E0", Dark: "#333333"})
-)
+		Background(selectionBg)
+}
 
 // Header renders the app title.
 func Header() string {
@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour/ansi"
+	"github.com/charmbracelet/glamour/styles"
+
+	"github.com/ekrishgupta/Hush/internal/config"
+	"github.com/ekrishgupta/Hush/internal/theme"
+)
+
+// markdownStyle is the glamour style messages are rendered with.
+func (m Model) markdownStyle() ansi.StyleConfig {
+	if m.theme == nil {
+		return styles.DraculaStyleConfig
+	}
+	return m.theme.MarkdownStyle()
+}
+
+// cmdTheme runs /theme, listing the themes or switching to one and
+// remembering it for next time.
+func (m Model) cmdTheme(arg string) (tea.Model, tea.Cmd) {
+	if arg == "" {
+		names, err := theme.Names()
+		if err != nil {
+			return m.Warn("⚠ " + err.Error())
+		}
+		for i, name := range names {
+			if m.theme != nil && name == m.theme.Name {
+				names[i] = "[" + name + "]"
+			}
+		}
+		return m.Warn("themes: " + strings.Join(names, " · "))
+	}
+
+	t, err := theme.Load(strings.ToLower(arg))
+	if err != nil {
+		return m.Warn("⚠ " + sanitizeLine(err.Error()))
+	}
+	m.theme = t
+	useTheme(t)
+
+	m.resetInput()
+	m.showWarning = true
+	m.warningMsg = "✓ switched to the " + t.Name + " theme"
+	if m.rooms != nil {
+		if err := m.rooms.Update(func(cfg *config.Config) { cfg.Theme = t.Name }); err != nil {
+			m.warningMsg = "⚠ " + err.Error()
+		}
+	}
+	// Rebuilds the markdown renderers and renders the messages again
+	return m, m.resize()
+}
@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ekrishgupta/Hush/internal/rooms"
+	"github.com/ekrishgupta/Hush/internal/trust"
+)
+
+// trustAlertMsg reports a known name showing up in a room with a new key.
+type trustAlertMsg struct {
+	room  string
+	alert trust.Alert
+}
+
+// waitForAlert returns a command that waits for the next trust alert
+// in r.
+func waitForAlert(r *rooms.Room) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case a := <-r.Alerts:
+			return trustAlertMsg{room: r.Name, alert: a}
+		case <-r.Done():
+			return nil
+		}
+	}
+}
+
+func (m Model) handleTrustAlert(msg trustAlertMsg) (tea.Model, tea.Cmd) {
+	a := msg.alert
+	a.Name = sanitizeLine(a.Name)
+	m.suspect[a.New] = true
+	m.trustAlert = &a
+	m.layoutMessages()
+	if r := m.joinedRoom(msg.room); r != nil {
+		return m, waitForAlert(r)
+	}
+	return m, nil
+}
+
+// cmdVerify shows the safety number and words for a peer, or with
+// "confirm" and the key shown after the name, marks them verified.
+func (m Model) cmdVerify(arg string) (tea.Model, tea.Cmd) {
+	if m.trust == nil {
+		return m.Warn("⚠ verification is unavailable")
+	}
+	name, code, confirm := strings.Cut(arg+" ", " confirm ")
+	name, code = strings.TrimSpace(name), strings.TrimSpace(code)
+
+	if confirm {
+		if code == "" {
+			return m.Warn(fmt.Sprintf("⚠ run /verify %s first and confirm with the key it shows", name))
+		}
+		rec, err := m.trust.Confirm(name, code)
+		switch {
+		case errors.Is(err, trust.ErrUnknownPeer):
+			return m.Warn(fmt.Sprintf("⚠ nobody called %q has been seen", name))
+		case errors.Is(err, trust.ErrKeyChanged):
+			return m.Warn(fmt.Sprintf("⚠ %s is now using key …%s, not …%s — run /verify %s again",
+				sanitizeLine(rec.Name), trust.ShortID(rec.ID), sanitizeLine(code), sanitizeLine(rec.Name)))
+		case err != nil:
+			return m.Warn("⚠ " + err.Error())
+		}
+		delete(m.suspect, rec.ID)
+		if m.trustAlert != nil && m.trustAlert.New == rec.ID {
+			m.trustAlert = nil
+		}
+		m.resetInput()
+		m.layoutMessages()
+		m.showWarning = true
+		m.warningMsg = "✓ " + sanitizeLine(rec.Name) + " is verified"
+		return m, nil
+	}
+
+	recs := m.trust.Lookup(name)
+	if len(recs) == 0 {
+		return m.Warn(fmt.Sprintf("⚠ nobody called %q has been seen", name))
+	}
+	rec := recs[0] // the key currently using the name
+	rec.Name = sanitizeLine(rec.Name)
+
+	number, err := trust.SafetyNumber(m.chat.Self(), rec.ID)
+	if err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+	words, err := trust.Words(m.chat.Self(), rec.ID)
+	if err != nil {
+		return m.Warn("⚠ " + err.Error())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n  %s  ·  key …%s  ·  first seen %s\n",
+		PeerMsgSender.Render(rec.Name), shortPeer(rec.ID), rec.FirstSeen.Format("Jan 2 2006 15:04"))
+	if rec.Verified {
+		fmt.Fprintf(&b, "  %s\n", VerifiedStyle.Render("✓ verified "+rec.VerifiedAt.Format("Jan 2 2006")))
+	}
+	if m.suspect[rec.ID] {
+		b.WriteString("  " + WarningStyle.Render("⚠ this name was used by a different key before") + "\n")
+	}
+	if len(recs) > 1 {
+		fmt.Fprintf(&b, "  %s\n", StatusStyle.Render(fmt.Sprintf("%d other keys have used this name", len(recs)-1)))
+	}
+
+	b.WriteString("\n  Safety number\n\n")
+	groups := strings.Fields(number)
+	for i := 0; i < len(groups); i += 4 {
+		b.WriteString("    " + strings.Join(groups[i:min(i+4, len(groups))], "  ") + "\n")
+	}
+	b.WriteString("\n  Words\n\n    " + strings.Join(words, " ") + "\n\n")
+	b.WriteString(StatusStyle.Render(fmt.Sprintf("Compare these with %s in person or over a call. If they match:", rec.Name)) + "\n")
+	fmt.Fprintf(&b, "    /verify %s confirm %s\n", rec.Name, trust.ShortID(rec.ID))
+
+	m.resetInput()
+	m.openOverlay("verify "+rec.Name, b.String())
+	return m, nil
+}
+
+// shortPeer returns the tail of a peer ID, which is the part that
+// differs between keys.
+func shortPeer(id peer.ID) string {
+	return trust.ShortID(id)
+}
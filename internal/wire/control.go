@@ -0,0 +1,122 @@
+package wire
+
+import "fmt"
+
+// ModKind is the kind of a moderation action.
+type ModKind int32
+
+const (
+	ModUnknown ModKind = iota
+	ModKick
+	ModBan
+	ModUnban
+	ModGrant
+	ModRevoke
+	ModTopic
+	ModAdmit
+	ModRemove
+)
+
+// ModAction is one moderation action in an owned room.
+type ModAction struct {
+	Room   string
+	Kind   ModKind
+	Target []byte
+	Text   string
+	Time   int64
+	Until  int64
+	Issuer []byte
+}
+
+// Marshal encodes the action.
+func (a ModAction) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, a.Room)
+	b = appendVarint(b, 2, uint64(a.Kind))
+	b = appendBytes(b, 3, a.Target)
+	b = appendString(b, 4, a.Text)
+	b = appendVarint(b, 5, uint64(a.Time))
+	b = appendVarint(b, 6, uint64(a.Until))
+	b = appendBytes(b, 7, a.Issuer)
+	return b
+}
+
+// UnmarshalModAction decodes an action.
+func UnmarshalModAction(b []byte) (ModAction, error) {
+	var a ModAction
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			a.Room = string(f.bytes)
+		case 2:
+			a.Kind = ModKind(f.varint)
+		case 3:
+			a.Target = f.bytes
+		case 4:
+			a.Text = string(f.bytes)
+		case 5:
+			a.Time = int64(f.varint)
+		case 6:
+			a.Until = int64(f.varint)
+		case 7:
+			a.Issuer = f.bytes
+		}
+	})
+	if err != nil {
+		return a, fmt.Errorf("decoding moderation action: %w", err)
+	}
+	return a, nil
+}
+
+// SignedModAction pairs an encoded ModAction with its issuer's signature.
+type SignedModAction struct {
+	Action    []byte
+	Signature []byte
+}
+
+// Control is the payload of a KindControl envelope.
+type Control struct {
+	Actions []SignedModAction
+}
+
+// Marshal encodes the control message.
+func (c Control) Marshal() []byte {
+	var b []byte
+	for _, a := range c.Actions {
+		var sub []byte
+		sub = appendBytes(sub, 1, a.Action)
+		sub = appendBytes(sub, 2, a.Signature)
+		b = appendBytes(b, 1, sub)
+	}
+	return b
+}
+
+// UnmarshalControl decodes a control message.
+func UnmarshalControl(b []byte) (Control, error) {
+	var c Control
+	var raw [][]byte
+	err := parseFields(b, func(f field) {
+		if f.num == 1 {
+			raw = append(raw, f.bytes)
+		}
+	})
+	if err != nil {
+		return c, fmt.Errorf("decoding control message: %w", err)
+	}
+	for _, r := range raw {
+		var a SignedModAction
+		err := parseFields(r, func(f field) {
+			switch f.num {
+			case 1:
+				a.Action = f.bytes
+			case 2:
+				a.Signature = f.bytes
+			}
+		})
+		if err != nil {
+			return c, fmt.Errorf("decoding signed moderation action: %w", err)
+		}
+		c.Actions = append(c.Actions, a)
+	}
+	return c, nil
+}
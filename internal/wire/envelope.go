@@ -0,0 +1,119 @@
+// Package wire defines the versioned binary envelope that every message
+// on a Hush topic is wrapped in. The schema lives in envelope.proto.
+package wire
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Version is the envelope format we write. Envelopes with a higher
+// version are rejected; new features should add kinds or fields instead.
+const Version = 1
+
+// Kind discriminates what an envelope's payload holds.
+type Kind int32
+
+const (
+	KindUnknown Kind = iota
+	KindChat
+	KindControl
+	KindPresence
+	KindFile
+	KindChunk
+	KindSealed
+)
+
+// Supported lists the kinds this build understands, advertised to peers
+// in presence announcements.
+var Supported = []Kind{KindChat, KindControl, KindPresence, KindFile, KindChunk, KindSealed}
+
+// String returns a short human-readable name for the kind.
+func (k Kind) String() string {
+	switch k {
+	case KindChat:
+		return "chat"
+	case KindControl:
+		return "control"
+	case KindPresence:
+		return "presence"
+	case KindFile:
+		return "file"
+	case KindChunk:
+		return "chunk"
+	case KindSealed:
+		return "sealed"
+	}
+	return fmt.Sprintf("kind(%d)", int32(k))
+}
+
+var (
+	// ErrUnsupportedVersion means the envelope is from a newer protocol.
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	// ErrLegacyJSON means the data is a pre-envelope JSON ChatMessage.
+	ErrLegacyJSON = errors.New("legacy JSON message")
+)
+
+// Envelope wraps a payload with its version and kind.
+type Envelope struct {
+	Version uint32
+	Kind    Kind
+	Payload []byte
+}
+
+// New wraps payload in an envelope of the current version.
+func New(kind Kind, payload []byte) Envelope {
+	return Envelope{Version: Version, Kind: kind, Payload: payload}
+}
+
+// Marshal encodes the envelope.
+func (e Envelope) Marshal() []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(e.Version))
+	b = appendVarint(b, 2, uint64(e.Kind))
+	b = appendBytes(b, 3, e.Payload)
+	return b
+}
+
+// Unmarshal decodes an envelope. Data that looks like a legacy JSON
+// message yields ErrLegacyJSON so the caller can fall back to it.
+func Unmarshal(data []byte) (Envelope, error) {
+	var e Envelope
+	if IsLegacyJSON(data) {
+		return e, ErrLegacyJSON
+	}
+
+	err := parseFields(data, func(f field) {
+		switch f.num {
+		case 1:
+			e.Version = uint32(f.varint)
+		case 2:
+			e.Kind = Kind(f.varint)
+		case 3:
+			e.Payload = f.bytes
+		}
+	})
+	if err != nil {
+		return e, fmt.Errorf("decoding envelope: %w", err)
+	}
+	if e.Version == 0 || e.Version > Version {
+		return e, fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.Version)
+	}
+	return e, nil
+}
+
+// IsLegacyJSON reports whether data is a pre-envelope JSON message.
+// A protobuf envelope always starts with a field tag, never '{'.
+func IsLegacyJSON(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
+// Understands reports whether this build can decode the kind.
+func Understands(k Kind) bool {
+	for _, s := range Supported {
+		if s == k {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package wire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxStreamMessage bounds a length-prefixed stream message so a bad
+// peer can't make us allocate arbitrarily.
+const maxStreamMessage = 4 << 10
+
+// FileRequest asks a peer for a file's bytes starting at Offset.
+type FileRequest struct {
+	Hash   string
+	Offset uint64
+}
+
+// Marshal encodes the request.
+func (r FileRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.Hash)
+	b = appendVarint(b, 2, r.Offset)
+	return b
+}
+
+// UnmarshalFileRequest decodes a request.
+func UnmarshalFileRequest(b []byte) (FileRequest, error) {
+	var r FileRequest
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			r.Hash = string(f.bytes)
+		case 2:
+			r.Offset = f.varint
+		}
+	})
+	if err != nil {
+		return r, fmt.Errorf("decoding file request: %w", err)
+	}
+	return r, nil
+}
+
+// FileResponse precedes the file bytes, or carries an error instead.
+type FileResponse struct {
+	Size  uint64
+	Error string
+}
+
+// Marshal encodes the response.
+func (r FileResponse) Marshal() []byte {
+	var b []byte
+	b = appendVarint(b, 1, r.Size)
+	b = appendString(b, 2, r.Error)
+	return b
+}
+
+// UnmarshalFileResponse decodes a response.
+func UnmarshalFileResponse(b []byte) (FileResponse, error) {
+	var r FileResponse
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			r.Size = f.varint
+		case 2:
+			r.Error = string(f.bytes)
+		}
+	})
+	if err != nil {
+		return r, fmt.Errorf("decoding file response: %w", err)
+	}
+	return r, nil
+}
+
+// FileHave is the payload of a KindFile envelope: blobs the sender can
+// serve.
+type FileHave struct {
+	Hashes []string
+}
+
+// Marshal encodes the announcement.
+func (h FileHave) Marshal() []byte {
+	var b []byte
+	for _, hash := range h.Hashes {
+		b = appendString(b, 1, hash)
+	}
+	return b
+}
+
+// UnmarshalFileHave decodes an announcement.
+func UnmarshalFileHave(b []byte) (FileHave, error) {
+	var h FileHave
+	err := parseFields(b, func(f field) {
+		if f.num == 1 {
+			h.Hashes = append(h.Hashes, string(f.bytes))
+		}
+	})
+	if err != nil {
+		return h, fmt.Errorf("decoding file announcement: %w", err)
+	}
+	return h, nil
+}
+
+// WriteDelimited writes msg with a uvarint length prefix.
+func WriteDelimited(w io.Writer, msg []byte) error {
+	b := protowire.AppendVarint(nil, uint64(len(msg)))
+	b = append(b, msg...)
+	_, err := w.Write(b)
+	return err
+}
+
+// ReadDelimited reads one uvarint length-prefixed message.
+func ReadDelimited(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxStreamMessage {
+		return nil, fmt.Errorf("stream message of %d bytes exceeds limit", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,115 @@
+package wire
+
+import "fmt"
+
+// Invite is the signed body of an invite code.
+type Invite struct {
+	Room    string
+	Issuer  []byte
+	Addrs   [][]byte
+	Expires uint64
+	Nonce   []byte
+	Once    bool
+	Admit   bool
+}
+
+// Marshal encodes the invite.
+func (inv Invite) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, inv.Room)
+	b = appendBytes(b, 2, inv.Issuer)
+	for _, a := range inv.Addrs {
+		b = appendBytes(b, 3, a)
+	}
+	b = appendVarint(b, 4, inv.Expires)
+	b = appendBytes(b, 5, inv.Nonce)
+	if inv.Once {
+		b = appendVarint(b, 6, 1)
+	}
+	if inv.Admit {
+		b = appendVarint(b, 7, 1)
+	}
+	return b
+}
+
+// UnmarshalInvite decodes an invite.
+func UnmarshalInvite(b []byte) (Invite, error) {
+	var inv Invite
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			inv.Room = string(f.bytes)
+		case 2:
+			inv.Issuer = f.bytes
+		case 3:
+			inv.Addrs = append(inv.Addrs, f.bytes)
+		case 4:
+			inv.Expires = f.varint
+		case 5:
+			inv.Nonce = f.bytes
+		case 6:
+			inv.Once = f.varint != 0
+		case 7:
+			inv.Admit = f.varint != 0
+		}
+	})
+	if err != nil {
+		return inv, fmt.Errorf("decoding invite: %w", err)
+	}
+	return inv, nil
+}
+
+// SignedInvite pairs an encoded Invite with the issuer's signature.
+type SignedInvite struct {
+	Invite    []byte
+	Signature []byte
+}
+
+// Marshal encodes the signed invite.
+func (s SignedInvite) Marshal() []byte {
+	var b []byte
+	b = appendBytes(b, 1, s.Invite)
+	b = appendBytes(b, 2, s.Signature)
+	return b
+}
+
+// UnmarshalSignedInvite decodes a signed invite.
+func UnmarshalSignedInvite(b []byte) (SignedInvite, error) {
+	var s SignedInvite
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			s.Invite = f.bytes
+		case 2:
+			s.Signature = f.bytes
+		}
+	})
+	if err != nil {
+		return s, fmt.Errorf("decoding signed invite: %w", err)
+	}
+	return s, nil
+}
+
+// InviteResult answers a request to redeem a single-use invite.
+type InviteResult struct {
+	Error string
+}
+
+// Marshal encodes the result.
+func (r InviteResult) Marshal() []byte {
+	return appendString(nil, 1, r.Error)
+}
+
+// UnmarshalInviteResult decodes a result.
+func UnmarshalInviteResult(b []byte) (InviteResult, error) {
+	var r InviteResult
+	err := parseFields(b, func(f field) {
+		if f.num == 1 {
+			r.Error = string(f.bytes)
+		}
+	})
+	if err != nil {
+		return r, fmt.Errorf("decoding invite result: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,254 @@
+package wire
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Chat is the payload of a KindChat envelope.
+type Chat struct {
+	ID         string
+	Sender     string
+	Content    string
+	Timestamp  int64
+	HLCWall    int64
+	HLCLogical uint32
+	Attachment *Attachment
+	Mentions   []Mention
+}
+
+// Mention is someone named in a chat message as @name.
+type Mention struct {
+	Peer []byte
+	Name string
+}
+
+// Marshal encodes the mention.
+func (m Mention) Marshal() []byte {
+	var b []byte
+	b = appendBytes(b, 1, m.Peer)
+	b = appendString(b, 2, m.Name)
+	return b
+}
+
+// UnmarshalMention decodes a mention.
+func UnmarshalMention(b []byte) (Mention, error) {
+	var m Mention
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			m.Peer = f.bytes
+		case 2:
+			m.Name = string(f.bytes)
+		}
+	})
+	if err != nil {
+		return m, fmt.Errorf("decoding mention: %w", err)
+	}
+	return m, nil
+}
+
+// Attachment describes a file offered alongside a chat message.
+type Attachment struct {
+	Hash      string
+	Name      string
+	Size      uint64
+	Mime      string
+	Thumbnail []byte
+	Preview   string
+}
+
+// Marshal encodes the attachment.
+func (a Attachment) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, a.Hash)
+	b = appendString(b, 2, a.Name)
+	b = appendVarint(b, 3, a.Size)
+	if a.Mime != "" {
+		b = appendString(b, 4, a.Mime)
+	}
+	if len(a.Thumbnail) > 0 {
+		b = appendBytes(b, 5, a.Thumbnail)
+	}
+	if a.Preview != "" {
+		b = appendString(b, 6, a.Preview)
+	}
+	return b
+}
+
+// UnmarshalAttachment decodes an attachment.
+func UnmarshalAttachment(b []byte) (Attachment, error) {
+	var a Attachment
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			a.Hash = string(f.bytes)
+		case 2:
+			a.Name = string(f.bytes)
+		case 3:
+			a.Size = f.varint
+		case 4:
+			a.Mime = string(f.bytes)
+		case 5:
+			a.Thumbnail = f.bytes
+		case 6:
+			a.Preview = string(f.bytes)
+		}
+	})
+	if err != nil {
+		return a, fmt.Errorf("decoding attachment: %w", err)
+	}
+	return a, nil
+}
+
+// Marshal encodes the chat payload.
+func (c Chat) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, c.ID)
+	b = appendString(b, 2, c.Sender)
+	b = appendString(b, 3, c.Content)
+	b = appendVarint(b, 4, uint64(c.Timestamp))
+	b = appendVarint(b, 5, uint64(c.HLCWall))
+	b = appendVarint(b, 6, uint64(c.HLCLogical))
+	if c.Attachment != nil {
+		b = appendBytes(b, 7, c.Attachment.Marshal())
+	}
+	for _, m := range c.Mentions {
+		b = appendBytes(b, 8, m.Marshal())
+	}
+	return b
+}
+
+// UnmarshalChat decodes a chat payload.
+func UnmarshalChat(b []byte) (Chat, error) {
+	var c Chat
+	var attachment []byte
+	var mentions [][]byte
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			c.ID = string(f.bytes)
+		case 2:
+			c.Sender = string(f.bytes)
+		case 3:
+			c.Content = string(f.bytes)
+		case 4:
+			c.Timestamp = int64(f.varint)
+		case 5:
+			c.HLCWall = int64(f.varint)
+		case 6:
+			c.HLCLogical = uint32(f.varint)
+		case 7:
+			attachment = f.bytes
+		case 8:
+			mentions = append(mentions, f.bytes)
+		}
+	})
+	if err != nil {
+		return c, fmt.Errorf("decoding chat payload: %w", err)
+	}
+	if attachment != nil {
+		a, err := UnmarshalAttachment(attachment)
+		if err != nil {
+			return c, err
+		}
+		c.Attachment = &a
+	}
+	for _, raw := range mentions {
+		m, err := UnmarshalMention(raw)
+		if err != nil {
+			return c, err
+		}
+		c.Mentions = append(c.Mentions, m)
+	}
+	return c, nil
+}
+
+// Presence is the payload of a KindPresence envelope.
+type Presence struct {
+	Name  string
+	Kinds []Kind
+}
+
+// Marshal encodes the presence payload. Kinds use packed encoding.
+func (p Presence) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, p.Name)
+
+	var packed []byte
+	for _, k := range p.Kinds {
+		packed = protowire.AppendVarint(packed, uint64(k))
+	}
+	b = appendBytes(b, 2, packed)
+	return b
+}
+
+// UnmarshalPresence decodes a presence payload.
+func UnmarshalPresence(b []byte) (Presence, error) {
+	var p Presence
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			p.Name = string(f.bytes)
+		case 2:
+			switch f.typ {
+			case protowire.VarintType:
+				p.Kinds = append(p.Kinds, Kind(f.varint))
+			case protowire.BytesType:
+				for rest := f.bytes; len(rest) > 0; {
+					v, n := protowire.ConsumeVarint(rest)
+					if n < 0 {
+						return
+					}
+					p.Kinds = append(p.Kinds, Kind(v))
+					rest = rest[n:]
+				}
+			}
+		}
+	})
+	if err != nil {
+		return p, fmt.Errorf("decoding presence payload: %w", err)
+	}
+	return p, nil
+}
+
+// Chunk is the payload of a KindChunk envelope: one piece of a
+// compressed chat payload too large for a single message.
+type Chunk struct {
+	ID    string
+	Index uint32
+	Total uint32
+	Data  []byte
+}
+
+// Marshal encodes the chunk payload.
+func (c Chunk) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, c.ID)
+	b = appendVarint(b, 2, uint64(c.Index))
+	b = appendVarint(b, 3, uint64(c.Total))
+	b = appendBytes(b, 4, c.Data)
+	return b
+}
+
+// UnmarshalChunk decodes a chunk payload.
+func UnmarshalChunk(b []byte) (Chunk, error) {
+	var c Chunk
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			c.ID = string(f.bytes)
+		case 2:
+			c.Index = uint32(f.varint)
+		case 3:
+			c.Total = uint32(f.varint)
+		case 4:
+			c.Data = f.bytes
+		}
+	})
+	if err != nil {
+		return c, fmt.Errorf("decoding chunk payload: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,265 @@
+package wire
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// The encoders are written by hand, so these tests hold them to
+// envelope.proto: every field the Go side writes must decode with the
+// schema, and everything the schema describes must come back out of
+// the Go decoders unchanged.
+
+func TestSchemaRoundTrip(t *testing.T) {
+	file := loadSchema(t)
+
+	tests := []struct {
+		message string
+		value   any
+	}{
+		{
+			message: "Envelope",
+			value:   Envelope{Version: Version, Kind: KindSealed, Payload: []byte("payload")},
+		},
+		{
+			message: "Chat",
+			value: Chat{
+				ID: "id", Sender: "ann", Content: "hi @bob", Timestamp: 1700000000,
+				HLCWall: 1700000000123, HLCLogical: 4,
+				Attachment: &Attachment{Hash: "ab12", Name: "a.txt", Size: 42, Mime: "text/plain", Thumbnail: []byte{0xff, 0xd8}, Preview: "first line"},
+				Mentions:   []Mention{{Peer: []byte("peer-b"), Name: "bob"}, {Peer: []byte("peer-c"), Name: "cy"}},
+			},
+		},
+		{message: "Mention", value: Mention{Peer: []byte("peer"), Name: "ann"}},
+		{
+			message: "Attachment",
+			value:   Attachment{Hash: "ab12", Name: "a.png", Size: 1 << 40, Mime: "image/png", Thumbnail: []byte{1, 2, 3}, Preview: "text"},
+		},
+		{message: "Presence", value: Presence{Name: "ann", Kinds: []Kind{KindChat, KindPresence, KindSealed}}},
+		{message: "Chunk", value: Chunk{ID: "id", Index: 2, Total: 3, Data: []byte("data")}},
+		{message: "FileRequest", value: FileRequest{Hash: "ab12", Offset: 1024}},
+		{message: "FileResponse", value: FileResponse{Size: 2048, Error: "gone"}},
+		{message: "FileHave", value: FileHave{Hashes: []string{"ab12", "cd34"}}},
+		{
+			message: "Invite",
+			value:   Invite{Room: "lobby", Issuer: []byte("issuer"), Addrs: [][]byte{{1, 2}, {3, 4}}, Expires: 1700000000, Nonce: []byte("nonce"), Once: true, Admit: true},
+		},
+		{message: "SignedInvite", value: SignedInvite{Invite: []byte("invite"), Signature: []byte("sig")}},
+		{message: "InviteResult", value: InviteResult{Error: "expired"}},
+		{
+			message: "Control",
+			value:   Control{Actions: []SignedModAction{{Action: []byte("a1"), Signature: []byte("s1")}, {Action: []byte("a2"), Signature: []byte("s2")}}},
+		},
+		{
+			message: "ModAction",
+			value:   ModAction{Room: "lobby", Kind: ModTopic, Target: []byte("target"), Text: "topic", Time: 1700000000123, Until: 1700000060123, Issuer: []byte("issuer")},
+		},
+		{message: "Sealed", value: Sealed{Epoch: 7, Index: 9, Ciphertext: []byte("ciphertext")}},
+		{message: "SenderKey", value: SenderKey{Room: "lobby", Epoch: 7, Index: 9, ChainKey: []byte("chain key")}},
+	}
+
+	// SignedModAction is only ever encoded inside Control
+	covered := map[protoreflect.Name]bool{"SignedModAction": true}
+	for _, tt := range tests {
+		covered[protoreflect.Name(tt.message)] = true
+	}
+	for i := 0; i < file.Messages().Len(); i++ {
+		if name := file.Messages().Get(i).Name(); !covered[name] {
+			t.Errorf("%s is in envelope.proto but not tested here", name)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			desc := file.Messages().ByName(protoreflect.Name(tt.message))
+			if desc == nil {
+				t.Fatalf("%s is not in envelope.proto", tt.message)
+			}
+			marshal, unmarshal := codecFor(t, tt.value)
+
+			// Go → schema: everything decodes as a known field, and
+			// every field in the schema is written
+			msg := dynamicpb.NewMessage(desc)
+			if err := proto.Unmarshal(marshal(), msg); err != nil {
+				t.Fatalf("schema can't decode the Go encoding: %v", err)
+			}
+			checkKnown(t, msg)
+			for i := 0; i < desc.Fields().Len(); i++ {
+				if fd := desc.Fields().Get(i); !msg.Has(fd) {
+					t.Errorf("field %s (%d) is in the schema but never written", fd.Name(), fd.Number())
+				}
+			}
+
+			// schema → Go: the Go decoder reads back what was sent
+			data, err := proto.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := unmarshal(data)
+			if err != nil {
+				t.Fatalf("Go can't decode the schema encoding: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("round trip through the schema\n got %+v\nwant %+v", got, tt.value)
+			}
+		})
+	}
+}
+
+// codecFor returns the hand-written encoder and decoder for v's type.
+func codecFor(t *testing.T, v any) (marshal func() []byte, unmarshal func([]byte) (any, error)) {
+	t.Helper()
+	wrap := func(f func([]byte) (any, error)) func([]byte) (any, error) { return f }
+	switch v := v.(type) {
+	case Envelope:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return Unmarshal(b) })
+	case Chat:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalChat(b) })
+	case Mention:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalMention(b) })
+	case Attachment:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalAttachment(b) })
+	case Presence:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalPresence(b) })
+	case Chunk:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalChunk(b) })
+	case FileRequest:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalFileRequest(b) })
+	case FileResponse:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalFileResponse(b) })
+	case FileHave:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalFileHave(b) })
+	case Invite:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalInvite(b) })
+	case SignedInvite:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalSignedInvite(b) })
+	case InviteResult:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalInviteResult(b) })
+	case Control:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalControl(b) })
+	case ModAction:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalModAction(b) })
+	case Sealed:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalSealed(b) })
+	case SenderKey:
+		return v.Marshal, wrap(func(b []byte) (any, error) { return UnmarshalSenderKey(b) })
+	}
+	t.Fatalf("no codec for %T", v)
+	return nil, nil
+}
+
+// checkKnown fails if msg, or any message inside it, holds fields the
+// schema doesn't define.
+func checkKnown(t *testing.T, msg protoreflect.Message) {
+	t.Helper()
+	if len(msg.GetUnknown()) > 0 {
+		t.Errorf("%s: the Go encoding has fields the schema doesn't define", msg.Descriptor().Name())
+	}
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Message() == nil:
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				checkKnown(t, v.List().Get(i).Message())
+			}
+		default:
+			checkKnown(t, v.Message())
+		}
+		return true
+	})
+}
+
+var (
+	protoComment = regexp.MustCompile(`//[^\n]*`)
+	protoBlock   = regexp.MustCompile(`(message|enum)\s+(\w+)\s*\{([^}]*)\}`)
+	protoField   = regexp.MustCompile(`(repeated\s+)?(\w+)\s+(\w+)\s*=\s*(\d+)\s*;`)
+	protoValue   = regexp.MustCompile(`(\w+)\s*=\s*(\d+)\s*;`)
+)
+
+var protoScalars = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":  descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"int32":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint32": descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64": descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+}
+
+// loadSchema reads envelope.proto. There's no protoc in the build, so
+// this understands just the subset of proto3 the file uses: top-level
+// enums and messages of scalar, enum and message fields.
+func loadSchema(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	src, err := os.ReadFile("envelope.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := protoComment.ReplaceAllString(string(src), "")
+
+	const pkg = "hush.wire"
+	enums := make(map[string]bool)
+	for _, m := range protoBlock.FindAllStringSubmatch(text, -1) {
+		if m[1] == "enum" {
+			enums[m[2]] = true
+		}
+	}
+
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("envelope.proto"),
+		Package: proto.String(pkg),
+		Syntax:  proto.String("proto3"),
+	}
+	for _, m := range protoBlock.FindAllStringSubmatch(text, -1) {
+		if m[1] == "enum" {
+			enum := &descriptorpb.EnumDescriptorProto{Name: proto.String(m[2])}
+			for _, v := range protoValue.FindAllStringSubmatch(m[3], -1) {
+				n, _ := strconv.Atoi(v[2])
+				enum.Value = append(enum.Value, &descriptorpb.EnumValueDescriptorProto{Name: proto.String(v[1]), Number: proto.Int32(int32(n))})
+			}
+			fd.EnumType = append(fd.EnumType, enum)
+			continue
+		}
+
+		msg := &descriptorpb.DescriptorProto{Name: proto.String(m[2])}
+		for _, f := range protoField.FindAllStringSubmatch(m[3], -1) {
+			n, _ := strconv.Atoi(f[4])
+			field := &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(f[3]),
+				JsonName: proto.String(f[3]),
+				Number:   proto.Int32(int32(n)),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			if f[1] != "" {
+				field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			}
+			switch typ, scalar := protoScalars[f[2]]; {
+			case scalar:
+				field.Type = typ.Enum()
+			case enums[f[2]]:
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+				field.TypeName = proto.String("." + pkg + "." + f[2])
+			default:
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String("." + pkg + "." + f[2])
+			}
+			msg.Field = append(msg.Field, field)
+		}
+		fd.MessageType = append(fd.MessageType, msg)
+	}
+
+	file, err := protodesc.NewFile(fd, nil)
+	if err != nil {
+		t.Fatalf("envelope.proto: %v", err)
+	}
+	return file
+}
@@ -0,0 +1,77 @@
+package wire
+
+import "fmt"
+
+// Sealed is an encrypted frame in an encrypted room.
+type Sealed struct {
+	Epoch      uint64
+	Index      uint32
+	Ciphertext []byte
+}
+
+// Marshal encodes the sealed frame.
+func (s Sealed) Marshal() []byte {
+	var b []byte
+	b = appendVarint(b, 1, s.Epoch)
+	b = appendVarint(b, 2, uint64(s.Index))
+	b = appendBytes(b, 3, s.Ciphertext)
+	return b
+}
+
+// UnmarshalSealed decodes a sealed frame.
+func UnmarshalSealed(b []byte) (Sealed, error) {
+	var s Sealed
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			s.Epoch = f.varint
+		case 2:
+			s.Index = uint32(f.varint)
+		case 3:
+			s.Ciphertext = f.bytes
+		}
+	})
+	if err != nil {
+		return s, fmt.Errorf("decoding sealed frame: %w", err)
+	}
+	return s, nil
+}
+
+// SenderKey hands a peer the chain key we encrypt with.
+type SenderKey struct {
+	Room     string
+	Epoch    uint64
+	Index    uint32
+	ChainKey []byte
+}
+
+// Marshal encodes the sender key.
+func (k SenderKey) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, k.Room)
+	b = appendVarint(b, 2, k.Epoch)
+	b = appendVarint(b, 3, uint64(k.Index))
+	b = appendBytes(b, 4, k.ChainKey)
+	return b
+}
+
+// UnmarshalSenderKey decodes a sender key.
+func UnmarshalSenderKey(b []byte) (SenderKey, error) {
+	var k SenderKey
+	err := parseFields(b, func(f field) {
+		switch f.num {
+		case 1:
+			k.Room = string(f.bytes)
+		case 2:
+			k.Epoch = f.varint
+		case 3:
+			k.Index = uint32(f.varint)
+		case 4:
+			k.ChainKey = f.bytes
+		}
+	})
+	if err != nil {
+		return k, fmt.Errorf("decoding sender key: %w", err)
+	}
+	return k, nil
+}
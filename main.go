@@ -28,6 +28,11 @@ func main() {
 		Bind: []interface{}{
 			app,
 		},
+		// Files dropped on the window are offered to the room
+		DragAndDrop: &options.DragAndDrop{
+			EnableFileDrop:     true,
+			DisableWebViewDrop: true,
+		},
 	})
 
 	if err != nil {
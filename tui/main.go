@@ -1,14 +1,27 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
 
+	"github.com/ekrishgupta/Hush/internal/blobstore"
+	"github.com/ekrishgupta/Hush/internal/block"
 	"github.com/ekrishgupta/Hush/internal/chat"
+	"github.com/ekrishgupta/Hush/internal/config"
+	"github.com/ekrishgupta/Hush/internal/invite"
+	"github.com/ekrishgupta/Hush/internal/moderation"
 	"github.com/ekrishgupta/Hush/internal/network"
+	"github.com/ekrishgupta/Hush/internal/rooms"
+	"github.com/ekrishgupta/Hush/internal/theme"
+	"github.com/ekrishgupta/Hush/internal/transfer"
+	"github.com/ekrishgupta/Hush/internal/trust"
 	"github.com/ekrishgupta/Hush/internal/ui"
 )
 
@@ -18,35 +31,173 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	h, err := network.NewHost()
+	// "hush join <code>" applies an invite before starting, and
+	// "hush new <name>" creates a room we own and can moderate
+	var (
+		joining  *invite.Invite
+		creating string
+	)
+	if len(os.Args) > 1 {
+		switch {
+		case os.Args[1] == "join" && len(os.Args) > 2:
+			// The code may have been wrapped across lines when copied
+			inv, err := invite.Parse(strings.Join(os.Args[2:], ""))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invite error: %v\n", err)
+				os.Exit(1)
+			}
+			joining = &inv
+		case os.Args[1] == "new" && len(os.Args) == 3:
+			creating = os.Args[2]
+		default:
+			fmt.Fprintln(os.Stderr, "usage: hush [join <invite code> | new <room name>]")
+			os.Exit(2)
+		}
+	}
+
+	// Settings, including who is muted and blocked
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		os.Exit(1)
+	}
+	blocks := block.New(cfg)
+	keymap, err := ui.NewKeyMap(cfg.Keys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: keys: %v\n", err)
+		os.Exit(1)
+	}
+	clock, err := ui.NewClock(cfg.TimeFormat, cfg.TimeZone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: time_zone: %v\n", err)
+		os.Exit(1)
+	}
+	var colors *theme.Theme
+	if cfg.Theme != "" {
+		if colors, err = theme.Load(cfg.Theme); err != nil {
+			fmt.Fprintf(os.Stderr, "theme error: %v, using the default colors\n", err)
+		}
+	}
+
+	h, err := network.NewHost(network.TUIIdentity, libp2p.ConnectionGater(blocks))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "host error: %v\n", err)
 		os.Exit(1)
 	}
 	defer h.Close()
+	blocks.SetNetwork(h.Network())
+
+	// Issue invites, and redeem the one we were given
+	invitePath, err := invite.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invite error: %v\n", err)
+		os.Exit(1)
+	}
+	invites, err := invite.NewService(h, invitePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invite error: %v\n", err)
+		os.Exit(1)
+	}
+	if joining != nil {
+		if err := invites.Join(ctx, *joining); err != nil {
+			fmt.Fprintf(os.Stderr, "invite error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := cfg.Update(joining.Apply); err != nil {
+			fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if creating != "" {
+		room, err := moderation.OwnedRoom(creating, h.ID())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "room error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := cfg.Update(func(cfg *config.Config) { cfg.Room = room }); err != nil {
+			fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Start mDNS discovery
+	// Start mDNS discovery, and dial peers we were pointed at
 	if err := network.SetupDiscovery(h); err != nil {
 		fmt.Fprintf(os.Stderr, "discovery error: %v\n", err)
 		os.Exit(1)
 	}
+	network.Bootstrap(ctx, h, cfg.Bootstrap)
 
-	// Set up GossipSub
-	topic, sub, err := network.SetupPubSub(ctx, h)
+	// Set up GossipSub, scoring down peers whose traffic we have to drop
+	limiter := chat.NewLimiter(chat.DefaultReceiveRate, chat.DefaultReceiveBurst)
+	ps, err := network.NewPubSub(ctx, h,
+		pubsub.WithBlacklist(blocks),
+		network.PeerScore(limiter.Score),
+	)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "pubsub error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Create chat and start listening
-	c := chat.NewChat(topic, sub, h.ID())
-	msgChan := c.ListenForMessages(ctx)
+	// Serve and download files over direct streams, caching what we fetch
+	store, err := blobstore.Open(blobstore.DefaultDir(), blobstore.DefaultMaxBytes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "attachment cache error: %v\n", err)
+		os.Exit(1)
+	}
+	files := transfer.NewService(h, store, transfer.DefaultDir(), transfer.WithBlocked(blocks.Contains))
+
+	// Remember which key each name uses and flag impersonation
+	trustPath, err := trust.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trust store error: %v\n", err)
+		os.Exit(1)
+	}
+	trusted, err := trust.Open(trustPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trust store error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Join the rooms we were in last time, and the one to show first.
+	// Each enforces its own kicks and bans, and owned ones are encrypted.
+	modPath, err := moderation.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "moderation error: %v\n", err)
+		os.Exit(1)
+	}
+	joined := rooms.New(h, ps, cfg, rooms.Services{
+		Limiter: limiter,
+		Scored:  true,
+		Files:   files,
+		Trust:   trusted,
+		ModPath: modPath,
+	})
+	invites.SetAdmit(joined.Admit)
+	for _, room := range cfg.Rooms {
+		if _, err := joined.Join(ctx, room); err != nil {
+			fmt.Fprintf(os.Stderr, "room error: skipping %s: %v\n", room, err)
+		}
+	}
+	current := cmp.Or(cfg.Room, network.TopicName)
+	if _, err := joined.Join(ctx, current); err != nil {
+		fmt.Fprintf(os.Stderr, "room error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// 2. Launch TUI
-	// The model is initialized with the ready chat instance.
+	// The model is initialized with the rooms ready.
 	// We pass an empty username because the first screen is the "Welcome" prompt.
-	model := ui.NewModel("", c, msgChan)
-	p := tea.NewProgram(model, tea.WithAltScreen())
+	model := ui.NewModel("", joined, current, ui.Services{
+		Files:   files,
+		Trust:   trusted,
+		Blocks:  blocks,
+		Invites: invites,
+		Keys:    &keymap,
+		Theme:   colors,
+		Clock:   &clock,
+	})
+	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithOutput(ui.Output))
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "tui error: %v\n", err)
 		os.Exit(1)